@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kanekitakitos/cmd-vault/internal/project"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasListCmd, aliasSetCmd, aliasRmCmd)
+	aliasSetCmd.ValidArgsFunction = completeCommandNames
+}
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage short names that commands can be run by",
+	Long: `Manage aliases: short names for commands with long descriptive ones. A
+command can have several aliases; each alias belongs to one command and can't
+be the name of another. 'run' and 'watch' accept an alias wherever they take
+a name, and names come first when both match:
+
+  cmd-vault alias set k8s/logs/tail-production tp
+  cmd-vault run tp`,
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the commands that have aliases",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		commands, err := store.GetAllCommands()
+		if err != nil {
+			return err
+		}
+		listed := 0
+		for _, c := range commands {
+			if len(c.Aliases) > 0 {
+				fmt.Printf("%-20s  %s\n", strings.Join(c.Aliases, ", "), c.Name)
+				listed++
+			}
+		}
+		if listed == 0 {
+			fmt.Println("No aliases.")
+		}
+		return nil
+	},
+}
+
+var aliasSetCmd = &cobra.Command{
+	Use:   "set [name] [alias...]",
+	Short: "Add aliases to a command",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		c, err := store.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no command found with name %s", args[0])
+		}
+		aliases := c.Aliases
+		for _, a := range args[1:] {
+			if !slices.Contains(aliases, a) {
+				aliases = append(aliases, a)
+			}
+		}
+		if err := store.SetAliases(c.ID, aliases); err != nil {
+			return err
+		}
+		fmt.Println("Saved.")
+		return nil
+	},
+}
+
+var aliasRmCmd = &cobra.Command{
+	Use:   "rm [alias...]",
+	Short: "Remove aliases",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		for _, a := range args {
+			c, err := store.GetByAlias(a)
+			if err != nil {
+				return err
+			}
+			if c == nil {
+				return fmt.Errorf("no alias named %s", a)
+			}
+			aliases := slices.DeleteFunc(c.Aliases, func(s string) bool { return s == a })
+			if err := store.SetAliases(c.ID, aliases); err != nil {
+				return err
+			}
+		}
+		fmt.Println("Deleted.")
+		return nil
+	},
+}
+
+// completeCommandNames completes the first argument with the names and
+// aliases of the saved commands and those of the current project.
+func completeCommandNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	store, _, err := openStore()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer store.Close()
+	commands, err := store.GetAllCommands()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if p, err := project.Load(wd); err == nil && p != nil {
+			commands = append(commands, p.Commands...)
+		}
+	}
+	var out []string
+	for _, c := range commands {
+		if strings.HasPrefix(c.Name, toComplete) {
+			out = append(out, c.Name+"\t"+c.Note)
+		}
+		for _, a := range c.Aliases {
+			if strings.HasPrefix(a, toComplete) {
+				out = append(out, a+"\t"+c.Name)
+			}
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kanekitakitos/cmd-vault/internal/backup"
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+const noDirBackups = "are plain files; keep them in git or any file backup"
+
+var (
+	backupList bool
+	doctorFix  bool
+)
+
+func init() {
+	rootCmd.AddCommand(backupCmd, restoreCmd, doctorCmd)
+	backupCmd.Flags().BoolVar(&backupList, "list", false, "list the backups of the vault instead of taking one")
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "delete the orphaned rows found")
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Take a timestamped backup of the vault",
+	Long: `Take a backup of the vault with SQLite's online backup API, which is safe
+while other cmd-vault processes use it. An encrypted vault is backed up
+encrypted. Backups are kept in the user config directory; once there are
+more than backup_keep of them (10 by default), the oldest are removed.
+
+A backup is also taken before a schema upgrade, before 'sync' changes the
+vault, before 'restore' replaces it and before 'doctor --fix'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireSQLite(noDirBackups); err != nil {
+			return err
+		}
+		if backupList {
+			return listBackups()
+		}
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		path, err := createBackup(dbPath, "manual", store.(*db.Store).Backup)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Backup written to", path)
+		return nil
+	},
+}
+
+func listBackups() error {
+	dir, err := vaultDir(dbPath, "backups")
+	if err != nil {
+		return err
+	}
+	backups, err := backup.List(dir)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups yet.")
+		return nil
+	}
+	for _, b := range backups {
+		fmt.Printf("%s  %-9s  %8.1f KB  %s\n", b.Time.Format("2006-01-02 15:04:05"), b.Reason, float64(b.Size)/1024, b.Path)
+	}
+	return nil
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [file]",
+	Short: "Replace the vault with a backup",
+	Long: `Replace the vault with a backup, given as a path or as the file name shown
+by 'backup --list'. The backup is checked first: it has to pass SQLite's
+integrity check and have a schema this cmd-vault knows. The current vault
+is backed up before it is replaced, so a restore can be undone with another
+restore.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireSQLite(noDirBackups); err != nil {
+			return err
+		}
+		src, err := backupPath(args[0])
+		if err != nil {
+			return err
+		}
+		if err := db.CheckFile(src, backupUnlocker); err != nil {
+			return fmt.Errorf("%s can't be restored: %w", src, err)
+		}
+		previous := ""
+		if info, err := os.Stat(dbPath); err == nil && info.Size() > 0 {
+			previous, err = createBackup(dbPath, "restore", func(dest string) error { return db.BackupFile(dbPath, dest) })
+			if err != nil {
+				return err
+			}
+		}
+		if err := db.Restore(src, dbPath); err != nil {
+			return err
+		}
+		if previous == "" {
+			fmt.Println("Restored.")
+			return nil
+		}
+		fmt.Printf("Restored. The previous vault was saved to %s.\n", previous)
+		return nil
+	},
+}
+
+// backupPath finds a backup given as a path, or by its name in the backup
+// directory of the vault.
+func backupPath(arg string) (string, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, nil
+	}
+	dir, err := vaultDir(dbPath, "backups")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.Base(arg))
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("no backup found at %s", arg)
+	}
+	return path, nil
+}
+
+// backupUnlocker opens encrypted backups, which usually share the key of
+// the vault.
+func backupUnlocker(salt []byte) (*seal.Key, error) {
+	if key := seal.CachedKey(vaultID(dbPath), salt); key != nil {
+		return key, nil
+	}
+	passphrase, err := askVaultPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	return seal.DeriveKey(passphrase, salt)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the vault database for problems",
+	Long: `Check the vault database: run SQLite's integrity check, compare its schema
+version with the one this cmd-vault writes, and look for orphaned rows such
+as history or schedules of commands that no longer exist. --fix deletes the
+orphaned rows, after taking a backup.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireSQLite("have no database to check"); err != nil {
+			return err
+		}
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		st := store.(*db.Store)
+
+		health, err := st.Check()
+		if err != nil {
+			return err
+		}
+		ok := true
+		fmt.Println("Vault:", dbPath)
+		if len(health.Problems) == 0 {
+			fmt.Println("Integrity: ok")
+		} else {
+			ok = false
+			fmt.Printf("Integrity: %d problem(s)\n", len(health.Problems))
+			for _, p := range health.Problems {
+				fmt.Println("  " + p)
+			}
+		}
+		switch v, want := st.OpenedVersion(), db.SchemaVersion(); {
+		case v > want:
+			ok = false
+			fmt.Printf("Schema: version %d is newer than this cmd-vault (%d); upgrade cmd-vault\n", v, want)
+		case v < want:
+			fmt.Printf("Schema: upgraded from version %d to %d\n", v, want)
+		default:
+			fmt.Printf("Schema: version %d, up to date\n", v)
+		}
+		if len(health.Orphans) == 0 {
+			fmt.Println("Orphaned rows: none")
+		} else {
+			fmt.Println("Orphaned rows:")
+			for _, o := range health.Orphans {
+				fmt.Printf("  %d in %s (%s)\n", o.Count, o.Table, o.Reason)
+			}
+			if doctorFix {
+				if _, err := createBackup(dbPath, "doctor", st.Backup); err != nil {
+					return err
+				}
+				n, err := st.RemoveOrphans()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Removed %d orphaned row(s).\n", n)
+			} else {
+				ok = false
+				fmt.Println("Run 'cmd-vault doctor --fix' to delete them.")
+			}
+		}
+		if !ok {
+			return errors.New("the vault has problems")
+		}
+		return nil
+	},
+}
+
+// createBackup takes a backup of the vault at location by calling write,
+// and removes the oldest backups beyond backup_keep.
+func createBackup(location, reason string, write func(path string) error) (string, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return "", err
+	}
+	dir, err := vaultDir(location, "backups")
+	if err != nil {
+		return "", err
+	}
+	return backup.Create(dir, reason, cfg.BackupKeep, write)
+}
+
+// backupStore backs up an SQLite vault before a change to many commands.
+// Directory vaults are left to git.
+func backupStore(store storage.Store, reason string) error {
+	st, ok := store.(*db.Store)
+	if !ok {
+		return nil
+	}
+	_, err := createBackup(dbPath, reason, st.Backup)
+	return err
+}
+
+// backupBeforeUpgrade backs up a plain vault file whose schema is about to
+// be upgraded. Encrypted files are only readable once decrypted.
+func backupBeforeUpgrade(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && info.Size() == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	version, err := db.FileVersion(path)
+	if errors.Is(err, db.ErrEncrypted) {
+		return nil
+	}
+	if err != nil || version >= db.SchemaVersion() {
+		return err
+	}
+	_, err = createBackup(path, "upgrade", func(dest string) error { return db.BackupFile(path, dest) })
+	return err
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var transferTo string
+
+func init() {
+	rootCmd.AddCommand(copyCmd, moveCmd)
+	for _, c := range []*cobra.Command{copyCmd, moveCmd} {
+		c.Flags().StringVar(&transferTo, "to", "", "target vault: a name from the config, or a location")
+		_ = c.MarkFlagRequired("to")
+	}
+}
+
+var copyCmd = &cobra.Command{
+	Use:   "copy [name...] --to [vault]",
+	Short: "Copy commands to another vault",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return transfer(args, false)
+	},
+}
+
+var moveCmd = &cobra.Command{
+	Use:   "move [name...] --to [vault]",
+	Short: "Move commands to another vault",
+	Long: `Move commands to another vault. They are copied there with their aliases
+and put in the trash of this vault, so 'cmd-vault undo' brings them back
+here, without the aliases.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return transfer(args, true)
+	},
+}
+
+// transfer copies the named commands and their aliases to the vault given
+// with --to, deleting them here when move is set. Nothing changes when a
+// name is missing here or a name or alias is already taken there.
+func transfer(names []string, move bool) error {
+	store, cfg, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	location := targetLocation(cfg, transferTo)
+	if vaultID(location) == vaultID(dbPath) {
+		return errors.New("the commands are already in that vault")
+	}
+	var commands []*models.Command
+	seen := map[int]bool{}
+	for _, name := range names {
+		c, err := store.GetByName(name)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no command found with name %s", name)
+		}
+		if !seen[c.ID] {
+			seen[c.ID] = true
+			commands = append(commands, c)
+		}
+	}
+
+	target, err := openLocation(location, askVaultPassphrase)
+	if err != nil {
+		return err
+	}
+	copies := make([]*models.Command, len(commands))
+	for i, c := range commands {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if err := checkFree(target, name); err != nil {
+				target.Close()
+				return err
+			}
+		}
+		copies[i] = &models.Command{
+			Name:        c.Name,
+			CommandStr:  c.CommandStr,
+			Note:        c.Note,
+			Interpreter: c.Interpreter,
+			Tags:        c.Tags,
+			Env:         c.Env,
+			CreatedAt:   time.Now(),
+		}
+	}
+	added, err := target.InsertCommands(copies)
+	if err != nil {
+		target.Close()
+		return err
+	}
+	for i, c := range commands {
+		if len(c.Aliases) == 0 {
+			continue
+		}
+		if err := target.SetAliases(int(added[i]), c.Aliases); err != nil {
+			target.Close()
+			return fmt.Errorf("%s was copied without its aliases: %w", c.Name, err)
+		}
+	}
+	// An encrypted vault is written back when it is closed.
+	if err := target.Close(); err != nil {
+		return err
+	}
+
+	if !move {
+		fmt.Printf("Copied %d command(s) to %s.\n", len(commands), transferTo)
+		return nil
+	}
+	// The aliases are free again only once the trashed commands give
+	// them up.
+	var ids []int
+	for _, c := range commands {
+		if len(c.Aliases) > 0 {
+			if err := store.SetAliases(c.ID, nil); err != nil {
+				return err
+			}
+		}
+		ids = append(ids, c.ID)
+	}
+	if err := store.DeleteCommands(ids); err != nil {
+		return err
+	}
+	fmt.Printf("Moved %d command(s) to %s.\n", len(commands), transferTo)
+	return nil
+}
+
+// checkFree fails when name is the name or an alias of a command in the
+// target vault.
+func checkFree(target storage.Store, name string) error {
+	if c, err := target.GetByName(name); err != nil {
+		return err
+	} else if c != nil {
+		return fmt.Errorf("a command named %s already exists in %s", name, transferTo)
+	}
+	if c, err := target.GetByAlias(name); err != nil {
+		return err
+	} else if c != nil {
+		return fmt.Errorf("%s is an alias of %s in %s", name, c.Name, transferTo)
+	}
+	return nil
+}
+
+// targetLocation resolves a vault given on the command line: a name from
+// the registry, or otherwise a location.
+func targetLocation(cfg config.Config, vault string) string {
+	if location, ok := cfg.Vaults[vault]; ok {
+		return location
+	}
+	return vault
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/dirstore"
+	"github.com/kanekitakitos/cmd-vault/internal/schedule"
+	"github.com/kanekitakitos/cmd-vault/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run scheduled commands until interrupted",
+	Long: `Run scheduled commands until interrupted. Results are recorded in the run
+history ('cmd-vault history'). A command is never started again while its
+previous run is still going; runs missed while the daemon was not running
+follow the catch-up policy of their schedule.
+
+Directory vaults are read again before every check. Encrypted vaults can't
+be used: they are only read when opened.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		d := &schedule.Daemon{Store: store}
+		switch st := store.(type) {
+		case *dirstore.Store:
+			d.Reload = st.Reload
+		case *db.Store:
+			if st.Encrypted() {
+				return errors.New("the daemon can't use an encrypted vault, which is only read when it is opened; decrypt it or schedule from a plain vault")
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		logger := log.New(os.Stdout, "", log.LstdFlags)
+		logger.Printf("daemon started, using %s", dbPath)
+		vars, err := profileVars(store)
+		if err != nil {
+			return err
+		}
+		if envProfile != "" {
+			logger.Printf("applying environment profile %s", envProfile)
+		}
+		d.Log, d.Profile = logger, vars
+		// Secrets have to be unlocked up front since nobody is around to
+		// type the passphrase when a scheduled command needs one.
+		hasSecrets, err := secrets.Initialized(store)
+		if err != nil {
+			return err
+		}
+		if hasSecrets {
+			v, err := unlockSecrets(store)
+			if err != nil {
+				return err
+			}
+			d.Secrets = v.Get
+			logger.Printf("secrets unlocked")
+		}
+		if d.Redactor, err = outputRedactor(cfg); err != nil {
+			return err
+		}
+		d.Run(ctx)
+		logger.Printf("daemon stopped")
+		return nil
+	},
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/editor"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	editWithEditor  bool
+	editNewName     string
+	editCommandStr  string
+	editNote        string
+	editInterpreter string
+	editTags        string
+	editEnv         []string
+	editUnsetEnv    []string
+)
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+	editCmd.Flags().BoolVar(&editWithEditor, "editor", false, "edit the command as a document in $VISUAL/$EDITOR")
+	editCmd.Flags().StringVar(&editNewName, "name", "", "rename the command")
+	editCmd.Flags().StringVar(&editCommandStr, "cmd", "", "replace the command body")
+	editCmd.Flags().StringVar(&editNote, "note", "", "replace the note")
+	editCmd.Flags().StringVar(&editInterpreter, "shell", "", "set the interpreter")
+	editCmd.Flags().StringVar(&editTags, "tags", "", "replace the tags (comma separated)")
+	editCmd.Flags().StringArrayVar(&editEnv, "env", nil, "set an environment variable, as KEY=value (repeatable)")
+	editCmd.Flags().StringArrayVar(&editUnsetEnv, "unset-env", nil, "remove an environment variable (repeatable)")
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Edit a saved command",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		c, err := store.GetByName(name)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no command found with name %s", name)
+		}
+
+		var edited *models.Command
+		if editWithEditor {
+			edited, err = editInEditor(c)
+		} else {
+			edited, err = editFromFlags(cmd, c)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := applyEdit(store, c, edited); err != nil {
+			return err
+		}
+		fmt.Println("Saved.")
+		return nil
+	},
+}
+
+// editInEditor opens c as a document in the user's editor until it parses,
+// or the user gives up.
+func editInEditor(c *models.Command) (*models.Command, error) {
+	path, err := editor.WriteTemp(document.Encode(c), ".md")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		text, err := editor.Edit(path)
+		if err != nil {
+			return nil, fmt.Errorf("editor failed: %w", err)
+		}
+		edited, err := document.Decode(text)
+		if err == nil {
+			return edited, nil
+		}
+		fmt.Fprintln(os.Stderr, "Invalid document:", err)
+		fmt.Fprint(os.Stderr, "Re-edit? [Y/n] ")
+		answer, _ := in.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "n" || a == "no" {
+			return nil, errors.New("edit aborted")
+		}
+	}
+}
+
+// editFromFlags applies the flags that were given to a copy of c.
+func editFromFlags(cmd *cobra.Command, c *models.Command) (*models.Command, error) {
+	edited := *c
+	changed := false
+	if cmd.Flags().Changed("name") {
+		edited.Name = strings.TrimSpace(editNewName)
+		changed = true
+	}
+	if cmd.Flags().Changed("cmd") {
+		edited.CommandStr = editCommandStr
+		changed = true
+	}
+	if cmd.Flags().Changed("note") {
+		edited.Note = strings.TrimSpace(editNote)
+		changed = true
+	}
+	if cmd.Flags().Changed("shell") {
+		edited.Interpreter = strings.ToLower(strings.TrimSpace(editInterpreter))
+		changed = true
+	}
+	if cmd.Flags().Changed("tags") {
+		edited.Tags = models.ParseTags(editTags)
+		changed = true
+	}
+	if len(editEnv) > 0 || len(editUnsetEnv) > 0 {
+		edited.Env = append([]string(nil), c.Env...)
+		for _, key := range editUnsetEnv {
+			edited.Env = models.UnsetEnv(edited.Env, key)
+		}
+		for _, kv := range editEnv {
+			if err := models.ValidateEnvVar(kv); err != nil {
+				return nil, err
+			}
+			edited.Env = models.SetEnv(edited.Env, kv)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, errors.New("nothing to change: pass --editor or at least one field flag")
+	}
+	if err := document.Validate(&edited); err != nil {
+		return nil, err
+	}
+	return &edited, nil
+}
+
+// applyEdit copies the editable fields of edited onto c and saves it.
+func applyEdit(store storage.Store, c, edited *models.Command) error {
+	if edited.Name != c.Name {
+		existing, err := store.GetByName(edited.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("a command named %s already exists", edited.Name)
+		}
+		owner, err := store.GetByAlias(edited.Name)
+		if err != nil {
+			return err
+		}
+		if owner != nil && owner.ID != c.ID {
+			return fmt.Errorf("%s is an alias of %s", edited.Name, owner.Name)
+		}
+	}
+	c.Name = edited.Name
+	c.CommandStr = edited.CommandStr
+	c.Note = edited.Note
+	c.Interpreter = edited.Interpreter
+	c.Tags = edited.Tags
+	c.Env = edited.Env
+	return store.UpdateCommand(c)
+}
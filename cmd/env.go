@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envListCmd, envShowCmd, envSetCmd, envUnsetCmd, envRmCmd)
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environment profiles (applied with --env-profile)",
+	Long: `Manage environment profiles: named sets of environment variables that are
+added to the environment of every command run with --env-profile, or picked
+in the TUI. Variables set on a command itself win over the profile:
+
+  cmd-vault env set staging API_URL=https://staging.example.com REGION=eu-west-1
+  cmd-vault run deploy --env-profile staging`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List environment profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		profiles, err := store.GetEnvProfiles()
+		if err != nil {
+			return err
+		}
+		if len(profiles) == 0 {
+			fmt.Println("No environment profiles.")
+			return nil
+		}
+		for _, p := range profiles {
+			fmt.Printf("%-20s  %d variable(s)\n", p.Name, len(p.Vars))
+		}
+		return nil
+	},
+}
+
+var envShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print the variables of a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := findProfile(store, args[0])
+		if err != nil {
+			return err
+		}
+		for _, kv := range p.Vars {
+			fmt.Println(kv)
+		}
+		return nil
+	},
+}
+
+var envSetCmd = &cobra.Command{
+	Use:   "set [name] [KEY=value...]",
+	Short: "Create a profile or set variables in it",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := strings.TrimSpace(args[0])
+		for _, kv := range args[1:] {
+			if err := models.ValidateEnvVar(kv); err != nil {
+				return err
+			}
+		}
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := store.GetEnvProfileByName(name)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			p = &models.EnvProfile{Name: name, CreatedAt: time.Now()}
+		}
+		for _, kv := range args[1:] {
+			p.Vars = models.SetEnv(p.Vars, kv)
+		}
+		if err := store.SaveEnvProfile(p); err != nil {
+			return err
+		}
+		fmt.Println("Saved.")
+		return nil
+	},
+}
+
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset [name] [KEY...]",
+	Short: "Remove variables from a profile",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := findProfile(store, args[0])
+		if err != nil {
+			return err
+		}
+		for _, key := range args[1:] {
+			p.Vars = models.UnsetEnv(p.Vars, key)
+		}
+		if err := store.SaveEnvProfile(p); err != nil {
+			return err
+		}
+		fmt.Println("Saved.")
+		return nil
+	},
+}
+
+var envRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Delete a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := findProfile(store, args[0])
+		if err != nil {
+			return err
+		}
+		if err := store.DeleteEnvProfile(p.ID); err != nil {
+			return err
+		}
+		fmt.Println("Deleted.")
+		return nil
+	},
+}
+
+func findProfile(store storage.Store, name string) (*models.EnvProfile, error) {
+	p, err := store.GetEnvProfileByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("no environment profile named %s", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyLimit  int
+	historyOutput bool
+)
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 20, "how many runs to show")
+	historyCmd.Flags().BoolVar(&historyOutput, "output", false, "print the output of each run")
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [name]",
+	Short: "Show recorded runs of scheduled commands",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		commandID := 0
+		if len(args) == 1 {
+			c, err := store.GetByName(args[0])
+			if err != nil {
+				return err
+			}
+			if c == nil {
+				return fmt.Errorf("no command found with name %s", args[0])
+			}
+			commandID = c.ID
+		}
+		runs, err := store.Runs(commandID, historyLimit)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("No runs recorded.")
+			return nil
+		}
+		// Output is redacted when it is recorded; patterns added since then
+		// still apply when it is shown.
+		redactor, err := outputRedactor(cfg)
+		if err != nil {
+			return err
+		}
+		for _, r := range runs {
+			status := "ok"
+			if r.Error != "" {
+				status = "FAILED: " + redactor.Redact(r.Error)
+			}
+			fmt.Printf("%s  %-20s  %4d  %8s  %-8s  %s\n", r.StartedAt.Local().Format("2006-01-02 15:04:05"), r.CommandName, r.ExitCode, r.Duration.Round(time.Millisecond), r.Source, status)
+			if historyOutput && r.Output != "" {
+				fmt.Println(redactor.Redact(r.Output))
+			}
+		}
+		return nil
+	},
+}
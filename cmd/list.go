@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/project"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var listSearch string
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVarP(&listSearch, "search", "s", "", "only list commands whose name, note, body, tags or aliases contain this text")
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list [folder/]",
+	Short: "List the saved commands, or those in a folder",
+	Long: `List the saved commands by name. A name such as k8s/logs/tail puts the
+command in the folder k8s/logs; given a folder, only the commands in it and
+its subfolders are listed:
+
+  cmd-vault list k8s/
+
+--search narrows the list to the commands that contain a text, ignoring
+case, in their name, note, body, tags or aliases:
+
+  cmd-vault list --search kubectl
+
+Commands of the project of the current directory are listed too.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		p, err := project.Load(wd)
+		if err != nil {
+			return err
+		}
+		folder := ""
+		if len(args) > 0 {
+			folder = models.CleanFolder(args[0])
+		}
+		listed, err := listedCommands(store, p, folder, listSearch)
+		if err != nil {
+			return err
+		}
+		if len(listed) == 0 {
+			switch {
+			case listSearch != "":
+				fmt.Printf("No commands match %q.\n", listSearch)
+				return nil
+			case folder != "":
+				return fmt.Errorf("no commands in %s/", folder)
+			}
+			fmt.Println("No commands.")
+			return nil
+		}
+		for _, c := range listed {
+			name := c.Name
+			if c.Project != "" {
+				name += " [" + p.Name() + "]"
+			}
+			fmt.Printf("  %-30s  %s\n", name, c.Note)
+		}
+		return nil
+	},
+}
+
+// listedCommands returns the commands of store and of project p, which may
+// be nil, that are in folder and match query, sorted by name. An empty
+// query matches every command.
+func listedCommands(store storage.CommandStore, p *project.Project, folder, query string) ([]models.Command, error) {
+	commands, err := store.SearchCommands(query)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		for _, c := range p.Commands {
+			if storage.Matches(&c, query) {
+				commands = append(commands, c)
+			}
+		}
+	}
+	var listed []models.Command
+	for _, c := range commands {
+		if models.InFolder(c.Name, folder) {
+			listed = append(listed, c)
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+	return listed, nil
+}
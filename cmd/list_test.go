@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/project"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+func TestListedCommands(t *testing.T) {
+	store := storage.NewMemory()
+	for _, c := range []models.Command{
+		{Name: "k8s/logs/tail", CommandStr: "kubectl logs -f app", Note: "Follow the app logs"},
+		{Name: "k8s/apply", CommandStr: "kubectl apply -f .", Note: "Apply manifests"},
+		{Name: "build", CommandStr: "make", Note: "Build", Tags: []string{"ci"}},
+	} {
+		c.CreatedAt = time.Now()
+		if _, err := store.InsertCommand(&c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build, _ := store.GetByName("build")
+	if err := store.SetAliases(build.ID, []string{"mk"}); err != nil {
+		t.Fatal(err)
+	}
+	p := &project.Project{Root: "/src/app", Commands: []models.Command{
+		{Name: "k8s/port-forward", CommandStr: "kubectl port-forward svc/app 8080", Note: "Forward", Project: "/src/app"},
+		{Name: "test", CommandStr: "go test ./...", Note: "Test"},
+	}}
+
+	tests := []struct {
+		folder, query string
+		want          []string
+	}{
+		{"", "", []string{"build", "k8s/apply", "k8s/logs/tail", "k8s/port-forward", "test"}},
+		{"k8s", "", []string{"k8s/apply", "k8s/logs/tail", "k8s/port-forward"}},
+		{"", "KUBECTL", []string{"k8s/apply", "k8s/logs/tail", "k8s/port-forward"}},
+		{"k8s/logs", "kubectl", []string{"k8s/logs/tail"}},
+		{"", "mk", []string{"build"}},
+		{"", "ci", []string{"build"}},
+		{"", "go test", []string{"test"}},
+		{"", "nothing", nil},
+	}
+	for _, tt := range tests {
+		listed, err := listedCommands(store, p, tt.folder, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, c := range listed {
+			names = append(names, c.Name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("folder %q, search %q: got %v, want %v", tt.folder, tt.query, names, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin [name]",
+	Short: "Pin a command to the top of the list, or list the pinned ones",
+	Long: `Pin a command so that it stays at the top of the TUI list. Pinned commands
+are numbered in the order they were pinned: the keys 1-9 run them in the TUI
+and 'cmd-vault run --fav 3' runs the third. Without a name, list them.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if len(args) == 0 {
+			pinned, err := pinnedCommands(store)
+			if err != nil {
+				return err
+			}
+			if len(pinned) == 0 {
+				fmt.Println("No pinned commands.")
+			}
+			for i, c := range pinned {
+				fmt.Printf("  %d  %-20s  %s\n", i+1, c.Name, c.Note)
+			}
+			return nil
+		}
+		return setPinned(store, args[0], true)
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin [name]",
+	Short: "Unpin a command",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		return setPinned(store, args[0], false)
+	},
+}
+
+func setPinned(store storage.Store, name string, pinned bool) error {
+	c, err := store.GetByName(name)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return fmt.Errorf("no command found with name %s", name)
+	}
+	if c.Pinned() == pinned {
+		return nil
+	}
+	return store.SetPinned(c.ID, pinned)
+}
+
+// pinnedCommands returns the pinned commands in their numbered order.
+func pinnedCommands(store storage.Store) ([]models.Command, error) {
+	commands, err := store.GetAllCommands()
+	if err != nil {
+		return nil, err
+	}
+	return commands[:models.SortPinned(commands)], nil
+}
+
+// favorite returns the nth pinned command, counting from 1.
+func favorite(store storage.Store, n int) (*models.Command, error) {
+	pinned, err := pinnedCommands(store)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > len(pinned) {
+		return nil, fmt.Errorf("no pinned command %d (%d pinned)", n, len(pinned))
+	}
+	return &pinned[n-1], nil
+}
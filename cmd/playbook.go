@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	playbookNote      string
+	playbookKeepGoing bool
+)
+
+func init() {
+	rootCmd.AddCommand(playbookCmd, runPlaybookCmd)
+	playbookCmd.AddCommand(playbookAddCmd, playbookListCmd, playbookShowCmd, playbookRmCmd)
+	playbookAddCmd.Flags().StringVar(&playbookNote, "note", "", "describe the playbook")
+	runPlaybookCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "run even if a step looks dangerous")
+	runPlaybookCmd.Flags().BoolVar(&playbookKeepGoing, "keep-going", false, "run every step even after a failure")
+}
+
+var playbookCmd = &cobra.Command{
+	Use:   "playbook",
+	Short: "Manage playbooks (sequences of saved commands)",
+}
+
+var playbookAddCmd = &cobra.Command{
+	Use:   "add [name] [step...]",
+	Short: "Create or replace a playbook",
+	Long: `Create or replace a playbook from an ordered list of steps.
+
+Each step is a saved command name, optionally followed by @dir to run it in
+another working directory and ? to continue when it fails:
+
+  cmd-vault playbook add release pull build test@./api deploy
+  cmd-vault playbook add nightly "lint?" test`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p := &models.Playbook{Name: args[0], Note: playbookNote, CreatedAt: time.Now()}
+		for _, spec := range args[1:] {
+			st, err := parseStep(store, spec)
+			if err != nil {
+				return err
+			}
+			p.Steps = append(p.Steps, st)
+		}
+
+		existing, err := store.GetPlaybookByName(p.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			p.ID = existing.ID
+			if !cmd.Flags().Changed("note") {
+				p.Note = existing.Note
+			}
+			if err := store.UpdatePlaybook(p); err != nil {
+				return err
+			}
+			fmt.Println("Updated.")
+			return nil
+		}
+		if _, err := store.InsertPlaybook(p); err != nil {
+			return err
+		}
+		fmt.Println("Added.")
+		return nil
+	},
+}
+
+// parseStep turns "name[@dir][?]" into a step referencing a saved command.
+func parseStep(store storage.Store, spec string) (models.PlaybookStep, error) {
+	var st models.PlaybookStep
+	if strings.HasSuffix(spec, "?") {
+		st.ContinueOnError = true
+		spec = strings.TrimSuffix(spec, "?")
+	}
+	name, dir, _ := strings.Cut(spec, "@")
+	c, err := store.GetByName(name)
+	if err != nil {
+		return st, err
+	}
+	if c == nil {
+		return st, fmt.Errorf("no command found with name %s", name)
+	}
+	st.CommandID = c.ID
+	st.CommandName = c.Name
+	st.WorkDir = dir
+	return st, nil
+}
+
+var playbookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List playbooks",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		playbooks, err := store.GetAllPlaybooks()
+		if err != nil {
+			return err
+		}
+		for _, p := range playbooks {
+			fmt.Printf("%s (%d steps)  %s\n", p.Name, len(p.Steps), p.Note)
+		}
+		return nil
+	},
+}
+
+var playbookShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the steps of a playbook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := findPlaybook(store, args[0])
+		if err != nil {
+			return err
+		}
+		for i, st := range p.Steps {
+			fmt.Printf("%2d. %s%s\n", i+1, st.CommandName, stepSuffix(st))
+		}
+		return nil
+	},
+}
+
+func stepSuffix(st models.PlaybookStep) string {
+	var s string
+	if st.WorkDir != "" {
+		s += "  in " + st.WorkDir
+	}
+	if st.ContinueOnError {
+		s += "  (continue on error)"
+	}
+	return s
+}
+
+var playbookRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Delete a playbook",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := findPlaybook(store, args[0])
+		if err != nil {
+			return err
+		}
+		if err := store.DeletePlaybook(p.ID); err != nil {
+			return err
+		}
+		fmt.Println("Deleted.")
+		return nil
+	},
+}
+
+func findPlaybook(store storage.Store, name string) (*models.Playbook, error) {
+	p, err := store.GetPlaybookByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("no playbook found with name %s", name)
+	}
+	return p, nil
+}
+
+var runPlaybookCmd = &cobra.Command{
+	Use:   "run-playbook [name]",
+	Short: "Run the steps of a playbook in order",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		p, err := findPlaybook(store, args[0])
+		if err != nil {
+			return err
+		}
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		// Check every step up front so a playbook doesn't stop half way.
+		for _, ps := range p.Steps {
+			c, err := store.GetByID(ps.CommandID)
+			if err != nil {
+				return err
+			}
+			if c == nil {
+				continue
+			}
+			if err := checkDangerous(cfg, c); err != nil {
+				return err
+			}
+		}
+
+		vars, err := profileVars(store)
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		steps := runner.PlaybookSteps(p, wd, vars, store.GetByID)
+		for i := range steps {
+			if steps[i].Err != nil {
+				continue
+			}
+			body, secretVars, err := resolveSecrets(store, steps[i].Body, steps[i].Interpreter)
+			if err != nil {
+				return err
+			}
+			steps[i].Body, steps[i].Env = body, runner.WithEnv(steps[i].Env, secretVars)
+		}
+		for i, st := range steps {
+			fmt.Printf("==> [%d/%d] %s\n", i+1, len(steps), st.Name)
+			start := time.Now()
+			err := st.Run(os.Stdout, os.Stdin)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err == nil {
+				fmt.Printf("==> [%d/%d] %s ok (%s)\n", i+1, len(steps), st.Name, elapsed)
+				_ = store.IncrementUsage(p.Steps[i].CommandID)
+				continue
+			}
+			failed++
+			fmt.Printf("==> [%d/%d] %s FAILED (%s): %v\n", i+1, len(steps), st.Name, elapsed, err)
+			if !st.ContinueOnError && !playbookKeepGoing {
+				return fmt.Errorf("playbook %s stopped at step %d", p.Name, i+1)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("playbook %s finished with %d failed step(s)", p.Name, failed)
+		}
+		fmt.Println("Done.")
+		return nil
+	},
+}
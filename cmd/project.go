@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/project"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(projectCmd)
+}
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Show the project commands of the current directory",
+	Long: `Show the commands of the project the current directory belongs to. A
+project is the nearest directory, going up from here, with a ` + project.FileName + `
+file: commands in the same format as 'cmd-vault edit --editor', one after the
+other. Project commands show up in the TUI next to your own and run in the
+project root; when a name exists in both, 'run' picks the one in your vault.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		p, err := project.Load(wd)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			fmt.Printf("No %s file in %s or above.\n", project.FileName, wd)
+			return nil
+		}
+		fmt.Printf("Project %s (%s)\n", p.Name(), p.File)
+		for _, c := range p.Commands {
+			fmt.Printf("  %-20s  %s\n", c.Name, c.Note)
+		}
+		return nil
+	},
+}
+
+// findCommand looks name up in the vault, first as a name and then as an
+// alias, then in the project of the current directory.
+func findCommand(store storage.Store, name string) (*models.Command, error) {
+	c, err := store.GetByName(name)
+	if err != nil || c != nil {
+		return c, err
+	}
+	if c, err = store.GetByAlias(name); err != nil || c != nil {
+		return c, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	p, err := project.Load(wd)
+	if err != nil {
+		return nil, err
+	}
+	if c = p.Lookup(name); c == nil {
+		return nil, fmt.Errorf("no command found with name %s", name)
+	}
+	return c, nil
+}
+
+// workDir is where c runs: the root of its project, or the current directory.
+func workDir(c *models.Command) (string, error) {
+	if c.Project != "" {
+		return c.Project, nil
+	}
+	return os.Getwd()
+}
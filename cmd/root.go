@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
-	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/secrets"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
 	"github.com/kanekitakitos/cmd-vault/internal/tui"
 	"github.com/spf13/cobra"
 )
@@ -14,21 +18,137 @@ var (
 	gitCommit = "none"
 )
 
+var (
+	dbPath     string
+	vaultName  string
+	configPath string
+	envProfile string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "lazycmd.db", "vault to use: a sqlite database file, or dir://path for a plain-text directory")
+	rootCmd.PersistentFlags().StringVar(&vaultName, "vault", "", "named vault from the config to use instead of --db")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "path to config file (default: user config dir)")
+	rootCmd.PersistentFlags().StringVar(&envProfile, "env-profile", "", "environment profile to apply to the commands that run")
+}
+
+// activeProfile loads the profile chosen with --env-profile, or nil when none was.
+func activeProfile(store storage.Store) (*models.EnvProfile, error) {
+	if envProfile == "" {
+		return nil, nil
+	}
+	return findProfile(store, envProfile)
+}
+
+// profileVars returns the variables of the active profile.
+func profileVars(store storage.Store) ([]string, error) {
+	p, err := activeProfile(store)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return p.Vars, nil
+}
+
+// openStore loads the config, opens the database and applies housekeeping
+// such as purging expired trash.
+func openStore() (storage.Store, config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, cfg, err
+	}
+	store, err := openLocation(dbPath, askVaultPassphrase)
+	if err != nil {
+		return nil, cfg, err
+	}
+	if _, err := store.PurgeTrash(cfg.TrashRetention()); err != nil {
+		store.Close()
+		return nil, cfg, err
+	}
+	return store, cfg, nil
+}
+
+// tuiOpener opens vaults for the vault switcher of the TUI, which asks for
+// passphrases itself: a locked vault reports tui.ErrLocked until it gets one.
+func tuiOpener(cfg config.Config) func(location, passphrase string) (storage.Store, error) {
+	return func(location, passphrase string) (storage.Store, error) {
+		store, err := openLocation(location, func() (string, error) {
+			if passphrase == "" {
+				passphrase = os.Getenv(secrets.PassphraseEnv)
+			}
+			if passphrase == "" {
+				return "", tui.ErrLocked
+			}
+			return passphrase, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := store.PurgeTrash(cfg.TrashRetention()); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return store, nil
+	}
+}
+
+// resolveDBPath picks the vault. --vault names one from the registry in the
+// config; without --db the config's db, a location or a vault name, is used.
+// vaultName ends up with the registered name of the vault, if it has one.
+func resolveDBPath(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	if flags.Changed("db") && flags.Changed("vault") {
+		return errors.New("use either --db or --vault")
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	if vaultName == "" && !flags.Changed("db") && cfg.DB != "" {
+		if _, ok := cfg.Vaults[cfg.DB]; ok {
+			vaultName = cfg.DB
+		} else {
+			dbPath = cfg.DB
+		}
+	}
+	if vaultName == "" {
+		vaultName = cfg.VaultName(dbPath)
+		return nil
+	}
+	location, ok := cfg.Vaults[vaultName]
+	if !ok {
+		return fmt.Errorf("no vault named %s in the config", vaultName)
+	}
+	dbPath = location
+	return nil
+}
+
 var rootCmd = &cobra.Command{
 	Use:     "cmd-vault",
 	Short:   "Cmd-Vault - retro TUI for saved shell commands",
 	Version: fmt.Sprintf("%s (commit: %s)", version, gitCommit),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return resolveDBPath(cmd)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// When no args, start interactive TUI
 		// Open DB
-		store, err := db.Open(dbPath)
+		store, cfg, err := openStore()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Failed to open database:", err)
 			os.Exit(1)
 		}
-		defer store.Close()
 
-		if err := tui.RunTUI(store); err != nil {
+		// os.Exit skips deferred calls, and an encrypted vault is only
+		// written back when the store is closed.
+		profile, err := activeProfile(store)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			store.Close()
+			os.Exit(1)
+		}
+		// The TUI may switch vaults, so it closes the store itself.
+		vaults := tui.Vaults{Current: vaultName, Open: tuiOpener(cfg)}
+		if err := tui.RunTUI(store, cfg, profile, vaults); err != nil {
 			fmt.Fprintln(os.Stderr, "TUI error:", err)
 			os.Exit(1)
 		}
@@ -3,46 +3,120 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
 	"github.com/spf13/cobra"
 )
 
-var dbPath string
+var (
+	runInDirs []string
+	runJobs   int
+	runSets   []string
+	runDryRun bool
+	runFav    int
+)
 
 func init() {
 	rootCmd.AddCommand(runCmd)
-	runCmd.Flags().StringVar(&dbPath, "db", "lazycmd.db", "path to sqlite database file")
+	runCmd.ValidArgsFunction = completeCommandNames
+	runCmd.Flags().StringArrayVar(&runInDirs, "in", nil, "run in this directory instead of the current one (repeatable)")
+	runCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "run even if the command looks dangerous")
+	runCmd.Flags().IntVar(&runJobs, "jobs", 0, "how many directories to run in at once with --in (default from config)")
+	runCmd.Flags().StringArrayVar(&runSets, "set", nil, "fill a {{placeholder}} in the command, as name=value (repeatable)")
+	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "print what would run instead of running it")
+	runCmd.Flags().IntVar(&runFav, "fav", 0, "run the pinned command with this number instead of a named one")
 }
 
 var runCmd = &cobra.Command{
-	Use:   "run [name]",
+	Use:   "run [name] [args...]",
 	Short: "Run a saved command by name",
-	Args:  cobra.ExactArgs(1),
+	Long: `Run a saved command by name. Extra arguments are appended to the last line
+of the command and {{placeholders}} are filled from --set, or from their
+{{name:default}} value:
+
+  cmd-vault run deploy --set env=staging -- --verbose
+  cmd-vault run deploy --set env=staging --dry-run
+
+With --fav, the pinned command with that number runs (see 'cmd-vault pin')
+and every argument is appended to it:
+
+  cmd-vault run --fav 3 -- --verbose`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if runFav != 0 {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		name := args[0]
-		store, err := db.Open(dbPath)
+		store, cfg, err := openStore()
 		if err != nil {
 			return err
 		}
 		defer store.Close()
 
-		c, err := store.GetByName(name)
+		var c *models.Command
+		if runFav != 0 {
+			c, err = favorite(store, runFav)
+		} else {
+			c, err = findCommand(store, args[0])
+			args = args[1:]
+		}
 		if err != nil {
 			return err
 		}
-		if c == nil {
-			return fmt.Errorf("no command found with name %s", name)
+		// Work on a copy so that the stored command is never touched.
+		expanded := *c
+		if expanded.CommandStr, err = expandCommand(c, args); err != nil {
+			return err
+		}
+		c = &expanded
+		vars, err := profileVars(store)
+		if err != nil {
+			return err
+		}
+		vars = append(vars, c.Env...)
+		if runDryRun {
+			return printDryRun(cfg, c, vars)
+		}
+		if err := checkDangerous(cfg, c); err != nil {
+			return err
+		}
+		body, secretVars, err := resolveSecrets(store, c.CommandStr, c.Interpreter)
+		if err != nil {
+			return err
+		}
+		c.CommandStr = body
+		vars = append(vars, secretVars...)
+
+		if len(runInDirs) > 0 {
+			jobs := runJobs
+			if jobs <= 0 {
+				jobs = cfg.ParallelJobs
+			}
+			return runInManyDirs(store, cfg, c, runner.Environ(vars), jobs)
 		}
 
-		// Use Windows cmd /C as specified
-		execCmd := exec.Command("cmd", "/C", c.CommandStr)
-		execCmd.Stdout = os.Stdout
-		execCmd.Stderr = os.Stderr
-		execCmd.Stdin = os.Stdin
+		// The command body is written to a script file and run by its interpreter
+		wd, err := workDir(c)
+		if err != nil {
+			return err
+		}
+		script, err := runner.Prepare(c.CommandStr, c.Interpreter, wd, runner.Environ(vars))
+		if err != nil {
+			return err
+		}
+		defer script.Cleanup()
+		script.Cmd.Stdout = os.Stdout
+		script.Cmd.Stderr = os.Stderr
+		script.Cmd.Stdin = os.Stdin
 
-		if err := execCmd.Run(); err != nil {
+		if err := script.Cmd.Run(); err != nil {
 			return fmt.Errorf("command execution failed: %w", err)
 		}
 
@@ -54,3 +128,98 @@ var runCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// runInManyDirs runs c in every --in directory in parallel, then prints each
+// directory's output followed by a summary.
+func runInManyDirs(store storage.Store, cfg config.Config, c *models.Command, env []string, jobs int) error {
+	redactor, err := outputRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	dirs := make([]string, len(runInDirs))
+	for i, dir := range runInDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		dirs[i] = abs
+	}
+
+	results := runner.RunInDirs(c.CommandStr, c.Interpreter, env, dirs, jobs)
+	failed := 0
+	for _, res := range results {
+		fmt.Printf("==> %s\n", res.Dir)
+		fmt.Print(redactor.Redact(string(res.Output)))
+		if res.Err != nil {
+			failed++
+			fmt.Printf("error: %s\n", redactor.Redact(res.Err.Error()))
+		}
+		fmt.Println()
+	}
+	for _, res := range results {
+		fmt.Printf("%4d  %8s  %s\n", res.ExitCode, res.Duration.Round(time.Millisecond), res.Dir)
+	}
+
+	if err := store.IncrementUsage(c.ID); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s failed in %d of %d directories", c.Name, failed, len(results))
+	}
+	fmt.Println("Done.")
+	return nil
+}
+
+// expandCommand fills the placeholders of c from --set and appends args.
+func expandCommand(c *models.Command, args []string) (string, error) {
+	values := map[string]string{}
+	for _, kv := range runSets {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return "", fmt.Errorf("--set needs name=value, got %s", kv)
+		}
+		values[k] = v
+	}
+	body, err := runner.Expand(c.CommandStr, values)
+	if err != nil {
+		return "", err
+	}
+	return runner.AppendArgs(body, c.Interpreter, args)
+}
+
+// printDryRun shows what running c with vars would do in each target
+// directory, masked like command output.
+func printDryRun(cfg config.Config, c *models.Command, vars []string) error {
+	redactor, err := outputRedactor(cfg)
+	if err != nil {
+		return err
+	}
+	dirs := runInDirs
+	if len(dirs) == 0 {
+		wd, err := workDir(c)
+		if err != nil {
+			return err
+		}
+		dirs = []string{wd}
+	}
+	for i, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		p, err := runner.NewPreview(c.CommandStr, c.Interpreter, abs, vars)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(redactor.Redact(p.String()))
+	}
+	if checker, err := cfg.Checker(); err == nil {
+		if reasons := checker.Check(c.CommandStr); len(reasons) > 0 {
+			fmt.Printf("\nWarning: looks dangerous (%s); running it needs --yes.\n", strings.Join(reasons, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// assumeYes is set by --yes on the commands that execute saved commands.
+var assumeYes bool
+
+// checkDangerous refuses to run c when it matches a dangerous command rule,
+// unless --yes was given.
+func checkDangerous(cfg config.Config, c *models.Command) error {
+	checker, err := cfg.Checker()
+	if err != nil {
+		return err
+	}
+	reasons := checker.Check(c.CommandStr)
+	if len(reasons) == 0 || assumeYes {
+		return nil
+	}
+	return fmt.Errorf("%s looks dangerous (%s); re-run with --yes to run it anyway", c.Name, strings.Join(reasons, ", "))
+}
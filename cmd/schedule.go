@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/schedule"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scheduleDir     string
+	scheduleCatchUp string
+)
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleAddCmd, scheduleListCmd, scheduleRmCmd)
+	scheduleAddCmd.Flags().StringVar(&scheduleDir, "dir", "", "directory to run the command in (default: current directory)")
+	scheduleAddCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "schedule the command even if it looks dangerous")
+	scheduleAddCmd.Flags().StringVar(&scheduleCatchUp, "catch-up", models.CatchUpSkip, "what to do about runs missed while the daemon was not running: skip or once")
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage recurring runs of saved commands (executed by 'cmd-vault daemon')",
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add [name] [cron]",
+	Short: "Run a saved command on a cron schedule",
+	Long: `Run a saved command on a cron schedule. The expression has five fields
+(minute hour day-of-month month day-of-week) or is one of @hourly, @daily,
+@weekly, @monthly and @yearly:
+
+  cmd-vault schedule add backup "30 2 * * *"
+  cmd-vault schedule add sync "*/15 9-17 * * 1-5" --catch-up once`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, spec := args[0], args[1]
+		cron, err := schedule.Parse(spec)
+		if err != nil {
+			return err
+		}
+		if scheduleCatchUp != models.CatchUpSkip && scheduleCatchUp != models.CatchUpOnce {
+			return fmt.Errorf("--catch-up must be %s or %s", models.CatchUpSkip, models.CatchUpOnce)
+		}
+		dir := scheduleDir
+		if dir == "" {
+			if dir, err = os.Getwd(); err != nil {
+				return err
+			}
+		}
+		if dir, err = filepath.Abs(dir); err != nil {
+			return err
+		}
+
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		c, err := store.GetByName(name)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no command found with name %s", name)
+		}
+		if err := checkDangerous(cfg, c); err != nil {
+			return err
+		}
+		sc := &models.Schedule{CommandID: c.ID, Spec: spec, Dir: dir, CatchUp: scheduleCatchUp, CreatedAt: time.Now()}
+		id, err := store.InsertSchedule(sc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added schedule %d. Next run: %s\n", id, formatNext(cron.Next(time.Now())))
+		return nil
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List schedules and when they run next",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		schedules, err := store.GetAllSchedules()
+		if err != nil {
+			return err
+		}
+		if len(schedules) == 0 {
+			fmt.Println("No schedules.")
+			return nil
+		}
+		now := time.Now()
+		for _, sc := range schedules {
+			next := "invalid expression"
+			if cron, err := schedule.Parse(sc.Spec); err == nil {
+				from := sc.LastRun
+				if from.IsZero() || from.Before(now) {
+					from = now
+				}
+				next = formatNext(cron.Next(from))
+			}
+			fmt.Printf("%3d  %-20s  %-16s  next: %s  catch-up: %s  in %s\n", sc.ID, sc.CommandName, sc.Spec, next, sc.CatchUp, sc.Dir)
+		}
+		return nil
+	},
+}
+
+func formatNext(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+var scheduleRmCmd = &cobra.Command{
+	Use:   "rm [id]",
+	Short: "Delete a schedule",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("schedule id must be a number, got %s", args[0])
+		}
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if err := store.DeleteSchedule(id); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("no schedule with id %d", id)
+			}
+			return err
+		}
+		fmt.Println("Deleted.")
+		return nil
+	},
+}
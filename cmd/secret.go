@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/redact"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/secrets"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretSetCmd, secretGetCmd, secretRmCmd, secretListCmd)
+}
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage encrypted secrets referenced from commands as {{secret:name}}",
+	Long: `Manage secrets. Values are encrypted with a key derived from a passphrase,
+which is asked for the first time a secret is needed and can also be given in
+the ` + secrets.PassphraseEnv + ` environment variable. Commands refer to secrets
+as {{secret:name}}. When the command runs, the reference becomes an
+environment variable of the interpreter ($CMDVAULT_SECRET_1 and so on) that
+holds the value, so the value is never written to the script file; like any
+variable it isn't expanded inside single quotes:
+
+  cmd-vault secret set github-token
+  cmd-vault edit release --cmd 'gh release create --token {{secret:github-token}}'`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set [name]",
+	Short: "Store a secret, reading its value from the terminal or stdin",
+	Long: `Store a secret. The value is asked for without echoing it, or read from
+the first line of stdin when that isn't a terminal:
+
+  cmd-vault secret set github-token
+  gh auth token | cmd-vault secret set github-token
+
+It is never taken as an argument, which would leave it in the shell history
+and the process list.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		v, err := unlockSecrets(store)
+		if err != nil {
+			return err
+		}
+		value, err := readHidden("Value for " + args[0] + ": ")
+		if err != nil {
+			return err
+		}
+		if err := v.Set(args[0], value); err != nil {
+			return err
+		}
+		fmt.Println("Saved.")
+		return nil
+	},
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get [name]",
+	Short: "Print the value of a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		v, err := unlockSecrets(store)
+		if err != nil {
+			return err
+		}
+		value, err := v.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var secretRmCmd = &cobra.Command{
+	Use:   "rm [name]",
+	Short: "Delete a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if err := store.DeleteSecret(args[0]); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("no secret named %s", args[0])
+			}
+			return err
+		}
+		fmt.Println("Deleted.")
+		return nil
+	},
+}
+
+var secretListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List secret names (never their values)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		list, err := store.Secrets()
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No secrets.")
+			return nil
+		}
+		for _, s := range list {
+			fmt.Printf("%-30s  updated %s\n", s.Name, s.UpdatedAt.Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+// unlocked caches the secrets vault once its passphrase has been given.
+var unlocked *secrets.Vault
+
+// unlockSecrets returns the secrets vault of store, asking for the
+// passphrase unless it is set in the environment.
+func unlockSecrets(store storage.Store) (*secrets.Vault, error) {
+	if unlocked != nil {
+		return unlocked, nil
+	}
+	passphrase := os.Getenv(secrets.PassphraseEnv)
+	if passphrase == "" {
+		initialized, err := secrets.Initialized(store)
+		if err != nil {
+			return nil, err
+		}
+		if initialized {
+			passphrase, err = readHidden("Secrets passphrase: ")
+		} else {
+			passphrase, err = choosePassphrase("secrets")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	v, err := secrets.Unlock(store, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	unlocked = v
+	return v, nil
+}
+
+// choosePassphrase asks twice for a new passphrase for what.
+func choosePassphrase(what string) (string, error) {
+	first, err := readHidden("New " + what + " passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	second, err := readHidden("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if first != second {
+		return "", errors.New("passphrases do not match")
+	}
+	return first, nil
+}
+
+// resolveSecrets turns the {{secret:name}} references of body into
+// environment variables of interpreter and returns the variables to run it
+// with, unlocking the secrets only when there are any.
+func resolveSecrets(store storage.Store, body, interpreter string) (string, []string, error) {
+	if len(runner.SecretRefs(body)) == 0 {
+		return body, nil, nil
+	}
+	v, err := unlockSecrets(store)
+	if err != nil {
+		return "", nil, err
+	}
+	return runner.ResolveSecrets(body, interpreter, v.Get)
+}
+
+// outputRedactor returns the redactor for captured output, masking the
+// values of the secrets too once they have been unlocked.
+func outputRedactor(cfg config.Config) (*redact.Redactor, error) {
+	r, err := cfg.Redactor()
+	if err != nil {
+		return nil, err
+	}
+	if unlocked != nil {
+		values, err := unlocked.Values()
+		if err != nil {
+			return nil, err
+		}
+		r.AddValues(values...)
+	}
+	return r, nil
+}
+
+// stdin is shared by every prompt so that piped input isn't lost between them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readHidden prompts on stderr and reads a line without echoing it when
+// stdin is a terminal.
+func readHidden(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if term.IsTerminal(os.Stdin.Fd()) {
+		b, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
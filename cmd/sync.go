@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/kanekitakitos/cmd-vault/internal/dirstore"
+	"github.com/kanekitakitos/cmd-vault/internal/gitsync"
+	"github.com/kanekitakitos/cmd-vault/internal/tui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncRemote string
+	syncBranch string
+	syncOurs   bool
+	syncTheirs bool
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringVar(&syncRemote, "remote", "", "git repository to sync with (default from config)")
+	syncCmd.Flags().StringVar(&syncBranch, "branch", "", "branch to sync (default from config, or "+gitsync.DefaultBranch+")")
+	syncCmd.Flags().BoolVar(&syncOurs, "ours", false, "settle every conflict with the local version")
+	syncCmd.Flags().BoolVar(&syncTheirs, "theirs", false, "settle every conflict with the remote version")
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Merge the commands with a git repository and push them",
+	Long: `Merge the commands with those in a git repository and push the result, so
+that several machines can share a vault. Commands are stored as one text
+document per command under commands/.
+
+Changes made on one side since the last sync are taken as they are; a
+command edited on both sides is merged field by field. When both sides
+changed the same field, or one side deleted a command the other edited, a
+conflict view lets you keep the local or the remote version of each command
+(or pass --ours or --theirs). Commands deleted by the sync go to the trash,
+and a single 'cmd-vault undo' takes back everything the sync changed here.
+
+  cmd-vault sync --remote git@github.com:me/commands.git`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if syncOurs && syncTheirs {
+			return errors.New("--ours and --theirs can't be used together")
+		}
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		remote, branch := syncRemote, syncBranch
+		if remote == "" {
+			remote = cfg.SyncRemote
+		}
+		if branch == "" {
+			branch = cfg.SyncBranch
+		}
+		if remote == "" {
+			return errors.New("no sync remote: pass --remote or set sync_remote in the config file")
+		}
+		dir, err := syncDir()
+		if err != nil {
+			return err
+		}
+		repo, err := gitsync.Open(dir, remote, branch)
+		if err != nil {
+			return err
+		}
+		if err := repo.Fetch(); err != nil {
+			return err
+		}
+		base, err := repo.Base()
+		if err != nil {
+			return err
+		}
+		theirs, err := repo.RemoteCommands()
+		if err != nil {
+			return err
+		}
+		ours, err := gitsync.Local(store)
+		if err != nil {
+			return err
+		}
+
+		merge := gitsync.ThreeWay(base, ours, theirs)
+		if err := resolveConflicts(merge); err != nil {
+			return err
+		}
+		if gitsync.Diff(ours, merge.Result()) != (gitsync.Changes{}) {
+			if err := backupStore(store, "sync"); err != nil {
+				return err
+			}
+		}
+		// Apply before pushing: a push that fails leaves the clone at the
+		// last sync, so the next sync merges these changes again, while a
+		// pushed result that failed to apply would be undone by the next
+		// sync as if it had been edited here.
+		ch, err := gitsync.Apply(store, merge.Result())
+		if err != nil {
+			return err
+		}
+		host, _ := os.Hostname()
+		if err := repo.Push(merge.Result(), "Sync from "+host); err != nil {
+			return fmt.Errorf("%w (the changes were applied here; run sync again to push them)", err)
+		}
+		fmt.Printf("Synced: %d added, %d updated, %d deleted here.\n", ch.Added, ch.Updated, ch.Deleted)
+		return nil
+	},
+}
+
+// resolveConflicts settles the conflicts of merge from --ours or --theirs,
+// or in the conflict view.
+func resolveConflicts(merge *gitsync.Merge) error {
+	if len(merge.Conflicts) == 0 {
+		return nil
+	}
+	if syncOurs || syncTheirs {
+		choice := gitsync.KeepLocal
+		if syncTheirs {
+			choice = gitsync.KeepRemote
+		}
+		for _, c := range merge.Conflicts {
+			c.Choice = choice
+		}
+		return nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		var names []string
+		for _, c := range merge.Conflicts {
+			names = append(names, c.Name)
+		}
+		return fmt.Errorf("%d conflict(s) in %s; run sync in a terminal or pass --ours or --theirs", len(names), strings.Join(names, ", "))
+	}
+	ok, err := tui.ResolveConflicts(merge.Conflicts)
+	if err != nil {
+		return err
+	}
+	if !ok || !merge.Resolved() {
+		return errors.New("sync cancelled")
+	}
+	return nil
+}
+
+// syncDir is the working clone of the current vault, kept in the user
+// config directory.
+func syncDir() (string, error) {
+	return vaultDir(dbPath, "sync")
+}
+
+// vaultDir is a directory kept for the vault at location in the user config
+// directory, such as its sync clone or its backups.
+func vaultDir(location, kind string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	id := vaultID(location)
+	if dir, ok := dirstore.Path(location); ok {
+		id = dirstore.Scheme + vaultID(dir)
+	}
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(base, "cmd-vault", kind, hex.EncodeToString(sum[:8])), nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var restoreAs string
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashEmptyCmd)
+	trashRestoreCmd.Flags().StringVar(&restoreAs, "as", "", "restore under a different name")
+}
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage deleted commands",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List commands in the trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		trashed, err := store.TrashedCommands()
+		if err != nil {
+			return err
+		}
+		if len(trashed) == 0 {
+			fmt.Println("Trash is empty.")
+			return nil
+		}
+		for _, c := range trashed {
+			line := fmt.Sprintf("%s  %s", c.DeletedAt.Local().Format("2006-01-02 15:04"), c.Name)
+			if cfg.TrashRetentionDays > 0 {
+				line += fmt.Sprintf("  (purged %s)", c.DeletedAt.Add(cfg.TrashRetention()).Local().Format("2006-01-02"))
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore [name]",
+	Short: "Restore a command from the trash",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		c, err := store.GetTrashedByName(name)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no command named %s in the trash", name)
+		}
+		restored, err := store.RestoreCommand(c.ID, restoreAs)
+		if err != nil {
+			return err
+		}
+		if restoreAs == "" && restored != name {
+			fmt.Printf("Restored as %s (name %s is taken).\n", restored, name)
+			return nil
+		}
+		fmt.Println("Restored.")
+		return nil
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete everything in the trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		n, err := store.EmptyTrash()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d command(s).\n", n)
+		return nil
+	},
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var undoList bool
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(redoCmd)
+	undoCmd.Flags().BoolVar(&undoList, "list", false, "show the operation journal instead of undoing")
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo the last change to the vault",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if undoList {
+			ops, err := store.Operations()
+			if err != nil {
+				return err
+			}
+			for _, op := range ops {
+				status := ""
+				if op.Undone {
+					status = " (undone)"
+				}
+				fmt.Printf("%s  %s%s\n", op.CreatedAt.Local().Format("2006-01-02 15:04:05"), op.Label, status)
+			}
+			return nil
+		}
+
+		op, err := store.Undo()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Undid:", op.Label)
+		return nil
+	},
+}
+
+var redoCmd = &cobra.Command{
+	Use:   "redo",
+	Short: "Redo the last undone change to the vault",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		op, err := store.Redo()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Redid:", op.Label)
+		return nil
+	},
+}
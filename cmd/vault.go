@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanekitakitos/cmd-vault/internal/backup"
+	"github.com/kanekitakitos/cmd-vault/internal/config"
+	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/dirstore"
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/kanekitakitos/cmd-vault/internal/secrets"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+	vaultCmd.AddCommand(vaultListCmd, vaultEncryptCmd, vaultDecryptCmd, vaultRekeyCmd, vaultLockCmd)
+}
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "List the named vaults and encrypt the vault file at rest",
+	Long: `Named vaults are listed under "vaults" in the config file, each with its
+location, and picked with --vault:
+
+  "vaults": {
+    "work": "~/vaults/work.db",
+    "notes": "dir://~/notes"
+  }
+
+The whole vault file can be encrypted with a passphrase. An encrypted vault is
+decrypted into memory when it is opened and written back encrypted when
+cmd-vault exits, so the plain database never touches the disk. The key is
+cached for ` + seal.SessionTTL.String() + ` in the login session ($XDG_RUNTIME_DIR) when
+there is one; the passphrase can also be given in ` + secrets.PassphraseEnv + `.
+The time counts from when the passphrase was entered, not from the last use,
+and expired keys are removed whenever cmd-vault closes a vault. 'vault lock'
+forgets the key at once.
+
+Changes to an encrypted vault are written back when cmd-vault exits, under a
+lock file next to the vault. When another process wrote the vault back in
+the meantime, the vault is left alone and the changes are saved to a
+.conflict file next to it instead.
+
+'vault encrypt' also encrypts the backups already taken of the vault, which
+would otherwise keep its contents in plain text.`,
+}
+
+var vaultListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the named vaults of the config",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return err
+		}
+		if len(cfg.Vaults) == 0 {
+			fmt.Println("No named vaults - add them under \"vaults\" in the config file.")
+			return nil
+		}
+		for _, name := range cfg.VaultNames() {
+			mark := " "
+			if name == vaultName {
+				mark = "*"
+			}
+			fmt.Printf("%s %-12s  %s\n", mark, name, cfg.Vaults[name])
+		}
+		return nil
+	},
+}
+
+var vaultEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the vault with a new passphrase",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireSQLite("can't be encrypted; keep private values in 'cmd-vault secret'"); err != nil {
+			return err
+		}
+		encrypted, err := db.IsEncrypted(dbPath)
+		if err != nil {
+			return err
+		}
+		if encrypted {
+			return errors.New("the vault is already encrypted; use 'vault rekey' to change the passphrase")
+		}
+		key, salt, err := newVaultKey()
+		if err != nil {
+			return err
+		}
+		if err := db.Encrypt(dbPath, key, salt); err != nil {
+			return err
+		}
+		_ = seal.CacheKey(vaultID(dbPath), salt, key)
+		fmt.Println("Vault encrypted.")
+		return encryptBackups(key, salt)
+	},
+}
+
+// encryptBackups encrypts the plain backups of a vault that was just
+// encrypted, so that its contents don't stay readable next to it. Backups
+// that can't be encrypted are listed so they can be removed by hand.
+func encryptBackups(key *seal.Key, salt []byte) error {
+	dir, err := vaultDir(dbPath, "backups")
+	if err != nil {
+		return err
+	}
+	backups, err := backup.List(dir)
+	if err != nil {
+		return fmt.Errorf("the backups in %s may still be plain: %w", dir, err)
+	}
+	var encrypted int
+	var failed []string
+	for _, b := range backups {
+		if done, err := db.IsEncrypted(b.Path); err == nil && done {
+			continue
+		}
+		info, err := os.Stat(b.Path)
+		if err == nil {
+			err = db.EncryptFile(b.Path, key, salt)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("  %s: %v", b.Path, err))
+			continue
+		}
+		// Keep the modification time, which orders backups taken in the
+		// same second.
+		_ = os.Chtimes(b.Path, info.ModTime(), info.ModTime())
+		encrypted++
+	}
+	if encrypted > 0 {
+		fmt.Printf("Encrypted %d backup(s) in %s.\n", encrypted, dir)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("these backups are still plain; remove them if they hold anything private:\n%s", strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+var vaultDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Store the vault as a plain SQLite database again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireSQLite("can't be encrypted; keep private values in 'cmd-vault secret'"); err != nil {
+			return err
+		}
+		store, err := openVault(dbPath, askVaultPassphrase)
+		if err != nil {
+			return err
+		}
+		if !store.Encrypted() {
+			store.Close()
+			return errors.New("the vault is not encrypted")
+		}
+		if err := store.Decrypt(); err != nil {
+			return err
+		}
+		_ = seal.ForgetKey(vaultID(dbPath))
+		fmt.Println("Vault decrypted.")
+		return nil
+	},
+}
+
+var vaultRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Change the passphrase of an encrypted vault",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireSQLite("can't be encrypted; keep private values in 'cmd-vault secret'"); err != nil {
+			return err
+		}
+		store, err := openVault(dbPath, askVaultPassphrase)
+		if err != nil {
+			return err
+		}
+		if !store.Encrypted() {
+			store.Close()
+			return errors.New("the vault is not encrypted; use 'vault encrypt'")
+		}
+		key, salt, err := newVaultKey()
+		if err != nil {
+			store.Close()
+			return err
+		}
+		store.Rekey(key, salt)
+		if err := store.Close(); err != nil {
+			return err
+		}
+		_ = seal.CacheKey(vaultID(dbPath), salt, key)
+		fmt.Println("Passphrase changed.")
+		return nil
+	},
+}
+
+var vaultLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Forget the cached key, so the passphrase is asked for again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := seal.ForgetKey(vaultID(dbPath)); err != nil {
+			return err
+		}
+		fmt.Println("Locked.")
+		return nil
+	},
+}
+
+// openLocation opens the vault at location, either a SQLite file or a
+// dir:// directory. ask supplies the passphrase of an encrypted vault whose
+// key isn't cached.
+func openLocation(location string, ask func() (string, error)) (storage.Store, error) {
+	if dir, ok := dirstore.Path(location); ok {
+		store, err := dirstore.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	store, err := openVault(location, ask)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// requireSQLite rejects directory vaults for commands that work on the
+// database file, saying why.
+func requireSQLite(why string) error {
+	if _, ok := dirstore.Path(dbPath); ok {
+		return errors.New("directory vaults " + why)
+	}
+	return nil
+}
+
+// vaultStore is a SQLite vault that clears expired keys out of the key
+// cache when it is closed, rather than leaving them on disk until the next
+// unlock.
+type vaultStore struct {
+	*db.Store
+}
+
+func (s *vaultStore) Close() error {
+	err := s.Store.Close()
+	_ = seal.ForgetExpiredKeys()
+	return err
+}
+
+// openVault opens the vault at path, unlocking it first when it is encrypted.
+func openVault(path string, ask func() (string, error)) (*vaultStore, error) {
+	if err := backupBeforeUpgrade(path); err != nil {
+		return nil, err
+	}
+	store, err := db.Open(path)
+	if !errors.Is(err, db.ErrEncrypted) {
+		if err != nil {
+			return nil, err
+		}
+		return &vaultStore{store}, nil
+	}
+	id := vaultID(path)
+	var key *seal.Key
+	var salt []byte
+	store, err = db.OpenEncrypted(path, func(s []byte) (*seal.Key, error) {
+		if k := seal.CachedKey(id, s); k != nil {
+			return k, nil
+		}
+		passphrase, err := ask()
+		if err != nil {
+			return nil, err
+		}
+		salt = s
+		key, err = seal.DeriveKey(passphrase, s)
+		return key, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Only a key that was just unlocked is cached: caching it again on
+	// every open would keep the session from ever expiring.
+	if key != nil {
+		_ = seal.CacheKey(id, salt, key)
+	}
+	// An encrypted vault is upgraded in memory: until it is closed the
+	// file still holds the old schema.
+	if store.OpenedVersion() < db.SchemaVersion() {
+		if _, err := createBackup(path, "upgrade", func(dest string) error { return db.BackupFile(path, dest) }); err != nil {
+			store.Discard()
+			return nil, fmt.Errorf("backup before the upgrade: %w", err)
+		}
+	}
+	return &vaultStore{store}, nil
+}
+
+// askVaultPassphrase takes the vault passphrase from the environment, or
+// asks for it on the terminal.
+func askVaultPassphrase() (string, error) {
+	if passphrase := os.Getenv(secrets.PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	return readHidden("Vault passphrase: ")
+}
+
+// newVaultKey asks for a new vault passphrase and derives its key.
+func newVaultKey() (*seal.Key, []byte, error) {
+	passphrase, err := choosePassphrase("vault")
+	if err != nil {
+		return nil, nil, err
+	}
+	if passphrase == "" {
+		return nil, nil, errors.New("the passphrase can't be empty")
+	}
+	salt, err := seal.NewSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := seal.DeriveKey(passphrase, salt)
+	return key, salt, err
+}
+
+// vaultID identifies the vault at path in the key cache.
+func vaultID(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
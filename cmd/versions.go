@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	versionsDiff     int
+	versionsRollback int
+)
+
+func init() {
+	rootCmd.AddCommand(versionsCmd)
+	versionsCmd.Flags().IntVar(&versionsDiff, "diff", 0, "show what version N changed compared to the version before it")
+	versionsCmd.Flags().IntVar(&versionsRollback, "rollback", 0, "roll the command back to version N")
+}
+
+var versionsCmd = &cobra.Command{
+	Use:   "versions [name]",
+	Short: "Show the edit history of a command",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		store, _, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		c, err := store.GetByName(name)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("no command found with name %s", name)
+		}
+		versions, err := store.Versions(c.ID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case versionsRollback > 0:
+			v := findVersion(versions, versionsRollback)
+			if v == nil {
+				return fmt.Errorf("%s has no version %d", name, versionsRollback)
+			}
+			if err := store.RollbackCommand(c.ID, v.ID); err != nil {
+				return err
+			}
+			fmt.Printf("Rolled %s back to version %d.\n", name, v.Number)
+		case versionsDiff > 0:
+			v := findVersion(versions, versionsDiff)
+			if v == nil {
+				return fmt.Errorf("%s has no version %d", name, versionsDiff)
+			}
+			fmt.Print(versionDiff(versions, v))
+		default:
+			for _, v := range versions {
+				fmt.Printf("%3d  %s  %s\n", v.Number, v.CreatedAt.Local().Format("2006-01-02 15:04:05"), firstLine(v.Command.CommandStr))
+			}
+		}
+		return nil
+	},
+}
+
+func findVersion(versions []models.Version, number int) *models.Version {
+	for i := range versions {
+		if versions[i].Number == number {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+// versionDiff renders what v changed compared to the version recorded before it.
+func versionDiff(versions []models.Version, v *models.Version) string {
+	var previous *models.Command
+	if p := findVersion(versions, v.Number-1); p != nil {
+		previous = &p.Command
+	}
+	return document.Diff(previous, &v.Command)
+}
+
+func firstLine(s string) string {
+	for i, r := range s {
+		if r == '\n' {
+			return s[:i] + " ..."
+		}
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/watch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchPath     string
+	watchGlobs    []string
+	watchDebounce time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.ValidArgsFunction = completeCommandNames
+	watchCmd.Flags().StringVar(&watchPath, "path", ".", "directory to watch for changes")
+	watchCmd.Flags().StringArrayVar(&watchGlobs, "glob", nil, "only react to files matching this pattern (repeatable)")
+	watchCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "run even if the command looks dangerous")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 300*time.Millisecond, "wait for changes to settle this long before re-running")
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [name]",
+	Short: "Re-run a saved command whenever files change",
+	Long: `Run a saved command in the current directory and run it again whenever a
+matching file under --path changes. A run still in progress when files change
+is stopped first. Press Ctrl+C to stop watching.
+
+  cmd-vault watch test --path ./src --glob '*.go'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		store, cfg, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		c, err := findCommand(store, name)
+		if err != nil {
+			return err
+		}
+		if err := checkDangerous(cfg, c); err != nil {
+			return err
+		}
+		wd, err := workDir(c)
+		if err != nil {
+			return err
+		}
+		vars, err := profileVars(store)
+		if err != nil {
+			return err
+		}
+		body, secretVars, err := resolveSecrets(store, c.CommandStr, c.Interpreter)
+		if err != nil {
+			return err
+		}
+		env := runner.Environ(vars, c.Env, secretVars)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		w := &watch.Watcher{Root: watchPath, Globs: watchGlobs, Debounce: watchDebounce}
+		changes, err := w.Watch(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Watching %s for changes. Press Ctrl+C to stop.\n", watchPath)
+
+		var job *runner.Job
+		var done <-chan struct{}
+		start := func(iteration int) error {
+			job, err = runner.StartJobTo(iteration, c.Name, body, c.Interpreter, wd, env, os.Stdout)
+			if err != nil {
+				return err
+			}
+			done = job.Done()
+			_ = store.IncrementUsage(c.ID)
+			return nil
+		}
+		iteration := 1
+		fmt.Printf("==> [%d] %s\n", iteration, c.Name)
+		if err := start(iteration); err != nil {
+			return err
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				if job != nil {
+					job.Cancel()
+					<-job.Done()
+				}
+				fmt.Println("Stopped watching.")
+				return nil
+			case <-done:
+				done = nil
+				if err := job.Err(); err != nil {
+					fmt.Printf("==> [%d] %s FAILED (%s): %v\n", job.ID, c.Name, job.Elapsed().Round(time.Millisecond), err)
+				} else {
+					fmt.Printf("==> [%d] %s ok (%s)\n", job.ID, c.Name, job.Elapsed().Round(time.Millisecond))
+				}
+			case files, ok := <-changes:
+				if !ok {
+					changes = nil
+					continue
+				}
+				if done != nil {
+					job.Cancel()
+					<-done
+					done = nil
+					fmt.Printf("==> [%d] %s canceled\n", job.ID, c.Name)
+				}
+				iteration++
+				fmt.Printf("==> [%d] %s (changed: %s)\n", iteration, c.Name, summarizeFiles(files))
+				if err := start(iteration); err != nil {
+					return err
+				}
+			}
+		}
+	},
+}
+
+// summarizeFiles lists the first few changed files.
+func summarizeFiles(files []string) string {
+	const shown = 3
+	if len(files) <= shown {
+		return strings.Join(files, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(files[:shown], ", "), len(files)-shown)
+}
@@ -0,0 +1,109 @@
+// Package backup keeps timestamped copies of a vault file in a directory
+// and rotates them, so that only the newest few are kept. A backup is named
+// after when and why it was taken:
+//
+//	20261019-153000-manual.db
+//	20261019-160212-migration.db
+package backup
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultKeep is how many backups are kept when the config doesn't say.
+const DefaultKeep = 10
+
+const (
+	timeLayout = "20060102-150405"
+	ext        = ".db"
+)
+
+// Backup is one backup file.
+type Backup struct {
+	Path   string
+	Time   time.Time
+	Reason string
+	Size   int64
+
+	modTime time.Time // orders backups taken in the same second
+}
+
+// Create takes a backup in dir by calling write with the path of the new
+// file, then removes the oldest backups beyond keep. keep <= 0 keeps them
+// all.
+func Create(dir, reason string, keep int, write func(path string) error) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format(timeLayout)+"-"+reason+ext)
+	if err := write(path); err != nil {
+		return "", err
+	}
+	return path, Rotate(dir, keep)
+}
+
+// List returns the backups in dir, newest first. A directory that doesn't
+// exist has none.
+func List(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ext)
+		if !ok || e.IsDir() || len(name) < len(timeLayout)+2 {
+			continue
+		}
+		t, err := time.ParseInLocation(timeLayout, name[:len(timeLayout)], time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Backup{
+			Path:   filepath.Join(dir, e.Name()),
+			Time:   t,
+			Reason: name[len(timeLayout)+1:],
+			Size:   info.Size(),
+
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].Time.Equal(backups[j].Time) {
+			return backups[i].Time.After(backups[j].Time)
+		}
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups, nil
+}
+
+// Rotate removes the oldest backups in dir beyond keep. keep <= 0 keeps
+// them all.
+func Rotate(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(b.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
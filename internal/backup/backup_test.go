@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func touch(t *testing.T, dir, name string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(backups []Backup) []string {
+	var out []string
+	for _, b := range backups {
+		out = append(out, filepath.Base(b.Path))
+	}
+	return out
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	touch(t, dir, "20260101-100000-manual.db", now)
+	touch(t, dir, "20260301-090000-migration.db", now)
+	// Taken in the same second: the later file comes first.
+	touch(t, dir, "20260201-120000-sync.db", now.Add(-time.Minute))
+	touch(t, dir, "20260201-120000-restore.db", now)
+	for _, name := range []string{"notes.txt", "20260101-100000.db", "yesterday-manual.db", "20260101-100000-.db"} {
+		touch(t, dir, name, now)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "20260401-100000-manual.db"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20260301-090000-migration.db", "20260201-120000-restore.db", "20260201-120000-sync.db", "20260101-100000-manual.db"}
+	if got := names(backups); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("List = %v, want %v", got, want)
+	}
+	b := backups[0]
+	if b.Reason != "migration" || !b.Time.Equal(time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)) || b.Size != int64(len("20260301-090000-migration.db")) {
+		t.Errorf("first backup %+v", b)
+	}
+
+	if backups, err := List(filepath.Join(dir, "missing")); err != nil || backups != nil {
+		t.Errorf("List of a missing directory = %v, %v", backups, err)
+	}
+}
+
+func TestCreateRotates(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	old := time.Now().Add(-time.Hour)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"20200101-000000-manual.db", "20200102-000000-manual.db", "20200103-000000-manual.db"} {
+		touch(t, dir, name, old)
+	}
+
+	var written string
+	path, err := Create(dir, "sync", 2, func(p string) error {
+		written = p
+		return os.WriteFile(p, []byte("vault"), 0o600)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != written || filepath.Dir(path) != dir || !strings.HasSuffix(path, "-sync.db") {
+		t.Errorf("Create wrote %s and returned %s", written, path)
+	}
+	backups, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(backups); len(got) != 2 || got[0] != filepath.Base(path) || got[1] != "20200103-000000-manual.db" {
+		t.Errorf("after rotation %v, want the new backup and the newest old one", got)
+	}
+}
+
+func TestCreateInNewDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	if _, err := Create(dir, "manual", DefaultKeep, func(p string) error { return os.WriteFile(p, nil, 0o600) }); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		t.Errorf("backup directory mode %v is readable by others", perm)
+	}
+}
+
+func TestCreateFailure(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "20200101-000000-manual.db", time.Now())
+	if _, err := Create(dir, "manual", 1, func(string) error { return os.ErrPermission }); err == nil {
+		t.Fatal("Create hid the error of write")
+	}
+	// A failed backup doesn't rotate the good ones away.
+	if backups, _ := List(dir); len(backups) != 1 {
+		t.Errorf("%d backups left, want 1", len(backups))
+	}
+}
+
+func TestRotateKeepsAll(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"20200101-000000-manual.db", "20200102-000000-manual.db"} {
+		touch(t, dir, name, time.Now())
+	}
+	if err := Rotate(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := List(dir); len(backups) != 2 {
+		t.Errorf("Rotate(0) left %d backups, want 2", len(backups))
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/backup"
+	"github.com/kanekitakitos/cmd-vault/internal/redact"
+	"github.com/kanekitakitos/cmd-vault/internal/safety"
+)
+
+// Config holds user settings read from config.json.
+type Config struct {
+	// DB is the vault used when neither --db nor --vault is given: a SQLite
+	// database file, dir://path for a directory of plain-text files, or the
+	// name of a vault in Vaults.
+	DB string `json:"db"`
+
+	// Vaults names vault locations, so that they can be picked with
+	// --vault and switched between in the TUI.
+	Vaults map[string]string `json:"vaults"`
+
+	// SyncRemote is the git repository 'cmd-vault sync' pushes to and
+	// pulls from, and SyncBranch its branch (main when empty).
+	SyncRemote string `json:"sync_remote"`
+	SyncBranch string `json:"sync_branch"`
+
+	// TrashRetentionDays is how long deleted commands stay in the trash
+	// before being purged. Zero keeps them forever.
+	TrashRetentionDays int `json:"trash_retention_days"`
+
+	// BackupKeep is how many backups of a vault are kept; older ones are
+	// removed when a new one is taken. Zero keeps them all.
+	BackupKeep int `json:"backup_keep"`
+
+	// ParallelJobs limits how many directories a command runs in at once
+	// when it is run across several directories.
+	ParallelJobs int `json:"parallel_jobs"`
+
+	// DangerousPatterns are regular expressions that mark a command as
+	// dangerous in addition to the built-in rules.
+	DangerousPatterns []string `json:"dangerous_patterns"`
+
+	// RedactPatterns are regular expressions whose matches are masked in
+	// command output, in addition to the built-in credential patterns. If
+	// a pattern has a capture group only the group is masked.
+	RedactPatterns []string `json:"redact_patterns"`
+}
+
+// Default returns the settings used when no config file exists.
+func Default() Config {
+	return Config{
+		TrashRetentionDays: 30,
+		BackupKeep:         backup.DefaultKeep,
+		ParallelJobs:       4,
+	}
+}
+
+// DefaultPath returns the location of the config file in the user's config directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cmd-vault", "config.json"), nil
+}
+
+// Load reads the config file at path, or the default location when path is
+// empty. Fields missing from the file keep their default values.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		p, err := DefaultPath()
+		if err != nil {
+			return cfg, nil
+		}
+		path = p
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, name := range cfg.VaultNames() {
+		if cfg.Vaults[name] == "" {
+			return cfg, fmt.Errorf("%s: vault %s has no location", path, name)
+		}
+		cfg.Vaults[name] = expandHome(cfg.Vaults[name])
+	}
+	if _, err := cfg.Checker(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := cfg.Redactor(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// VaultNames returns the names of the vaults in the registry, sorted.
+func (c Config) VaultNames() []string {
+	names := make([]string, 0, len(c.Vaults))
+	for name := range c.Vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VaultName returns the name the registry gives to location, or "" when it
+// isn't registered.
+func (c Config) VaultName(location string) string {
+	for _, name := range c.VaultNames() {
+		if c.Vaults[name] == location {
+			return name
+		}
+	}
+	return ""
+}
+
+// expandHome replaces a leading ~ in a file path with the home directory.
+// dir:// locations expand it themselves.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// TrashRetention returns TrashRetentionDays as a duration.
+func (c Config) TrashRetention() time.Duration {
+	return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+}
+
+// Checker returns the dangerous command checker for DangerousPatterns.
+func (c Config) Checker() (*safety.Checker, error) {
+	return safety.New(c.DangerousPatterns)
+}
+
+// Redactor returns the output redactor for RedactPatterns.
+func (c Config) Redactor() (*redact.Redactor, error) {
+	return redact.New(c.RedactPatterns)
+}
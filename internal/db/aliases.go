@@ -0,0 +1,77 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// GetByAlias returns the live command with the given alias, or nil if there
+// is none.
+func (s *Store) GetByAlias(alias string) (*models.Command, error) {
+	row := s.conn.QueryRow(`SELECT `+commandColumns+` FROM commands WHERE deleted_at IS NULL
+		AND id = (SELECT command_id FROM command_aliases WHERE alias = ?)`, alias)
+	c, err := scanCommand(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SetAliases replaces the aliases of the live command id.
+func (s *Store) SetAliases(id int, aliases []string) error {
+	for _, a := range aliases {
+		if err := models.CheckAlias(a); err != nil {
+			return err
+		}
+	}
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	c, err := getByID(tx, id)
+	if err != nil {
+		return err
+	}
+	if c == nil || !c.DeletedAt.IsZero() {
+		return fmt.Errorf("command %d does not exist", id)
+	}
+	for _, a := range aliases {
+		if taken, err := nameTaken(tx, a); err != nil {
+			return err
+		} else if taken {
+			return fmt.Errorf("a command named %s already exists", a)
+		}
+		if owner, err := aliasOwner(tx, a, id); err != nil {
+			return err
+		} else if owner != "" {
+			return fmt.Errorf("alias %s is already used by %s", a, owner)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM command_aliases WHERE command_id = ?`, id); err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO command_aliases (alias, command_id) VALUES (?, ?)`, a, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// aliasOwner returns the name of the command other than id that has alias,
+// or "" when there is none.
+func aliasOwner(tx *sql.Tx, alias string, id int) (string, error) {
+	var owner string
+	err := tx.QueryRow(`SELECT c.name FROM command_aliases a JOIN commands c ON c.id = a.command_id
+		WHERE a.alias = ? AND a.command_id != ?`, alias, id).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return owner, err
+}
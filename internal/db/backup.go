@@ -0,0 +1,310 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/mattn/go-sqlite3"
+)
+
+// SchemaVersion is the schema version of the vaults this build writes.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// OpenedVersion returns the schema version the vault had before Open
+// applied pending migrations.
+func (s *Store) OpenedVersion() int {
+	return s.version
+}
+
+// FileVersion returns the schema version of the plain vault file at path
+// without opening it as a vault, so that no migration runs.
+func FileVersion(path string) (int, error) {
+	encrypted, err := IsEncrypted(path)
+	if err != nil {
+		return 0, err
+	}
+	if encrypted {
+		return 0, ErrEncrypted
+	}
+	conn, err := openReadOnly(path)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var version int
+	err = conn.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+func openReadOnly(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", "file:"+path+"?mode=ro&_busy_timeout=5000")
+}
+
+// Backup writes a copy of the vault to path with SQLite's online backup
+// API, so the vault can stay in use meanwhile. An encrypted vault is
+// written encrypted, with its key.
+func (s *Store) Backup(path string) error {
+	if s.key != nil {
+		data, err := s.Serialize()
+		if err != nil {
+			return err
+		}
+		return writeEncrypted(path, s.key, s.salt, data)
+	}
+	return backupTo(s.conn, path)
+}
+
+// BackupFile copies the vault file at src to path without opening it as a
+// vault, for instance before migrations change it. Encrypted files are
+// copied as they are.
+func BackupFile(src, path string) error {
+	encrypted, err := IsEncrypted(src)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(path, data)
+	}
+	conn, err := openReadOnly(src)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return backupTo(conn, path)
+}
+
+// EncryptFile encrypts the plain vault file at path, such as a backup, in
+// place with key and salt. Unlike Encrypt it doesn't open the file as a
+// vault, so no migration runs. Encrypted files are left as they are.
+func EncryptFile(path string, key *seal.Key, salt []byte) error {
+	encrypted, err := IsEncrypted(path)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return nil
+	}
+	conn, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	data, err := serialize(conn)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	return writeEncrypted(path, key, salt, data)
+}
+
+// backupTo copies the main database of src to a new file at path.
+func backupTo(src *sql.DB, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".cmd-vault-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	defer os.Remove(tmp)
+
+	dst, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	err = copyDatabase(src, dst)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func copyDatabase(src, dst *sql.DB) error {
+	ctx := context.Background()
+	sc, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	dc, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+	return sc.Raw(func(srcRaw any) error {
+		return dc.Raw(func(dstRaw any) error {
+			b, err := dstRaw.(*sqlite3.SQLiteConn).Backup("main", srcRaw.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// Health is what Check found in a vault.
+type Health struct {
+	// Problems lists what PRAGMA integrity_check reported; it is empty
+	// for a sound database.
+	Problems []string
+	Orphans  []Orphans
+}
+
+// Orphans counts the rows of a table that refer to something that no
+// longer exists.
+type Orphans struct {
+	Table  string
+	Reason string
+	Count  int
+}
+
+// orphanChecks find rows left behind by older versions or by edits made
+// outside cmd-vault. Runs are not among them: the run history of a purged
+// command is kept on purpose. Neither are playbook steps of a purged
+// command, which the playbook keeps and reports as no longer existing.
+var orphanChecks = []struct {
+	table, reason, where string
+}{
+	{"command_versions", "command no longer exists", `command_id NOT IN (SELECT id FROM commands)`},
+	{"schedules", "command no longer exists", `command_id NOT IN (SELECT id FROM commands)`},
+	{"command_aliases", "command no longer exists", `command_id NOT IN (SELECT id FROM commands)`},
+	{"playbook_steps", "playbook no longer exists", `playbook_id NOT IN (SELECT id FROM playbooks)`},
+}
+
+// Check runs PRAGMA integrity_check on the vault and counts orphaned rows.
+func (s *Store) Check() (*Health, error) {
+	problems, err := integrityCheck(s.conn)
+	if err != nil {
+		return nil, err
+	}
+	h := &Health{Problems: problems}
+	for _, c := range orphanChecks {
+		var n int
+		if err := s.conn.QueryRow(`SELECT COUNT(*) FROM ` + c.table + ` WHERE ` + c.where).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			h.Orphans = append(h.Orphans, Orphans{Table: c.table, Reason: c.reason, Count: n})
+		}
+	}
+	return h, nil
+}
+
+// RemoveOrphans deletes the rows Check reports as orphaned and returns how
+// many there were.
+func (s *Store) RemoveOrphans() (int64, error) {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var total int64
+	for _, c := range orphanChecks {
+		res, err := tx.Exec(`DELETE FROM ` + c.table + ` WHERE ` + c.where)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, tx.Commit()
+}
+
+func integrityCheck(conn *sql.DB) ([]string, error) {
+	rows, err := conn.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// CheckFile makes sure the file at path can be used as a vault without
+// changing it: an SQLite database that passes PRAGMA integrity_check, has
+// the commands table and a schema version this build knows. An encrypted
+// file is decrypted in memory with unlock and checked there.
+func CheckFile(path string, unlock Unlocker) error {
+	encrypted, err := IsEncrypted(path)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		s, err := OpenEncrypted(path, unlock)
+		if err != nil {
+			return err
+		}
+		// Migrations ran in memory; don't write them back to path.
+		defer s.Discard()
+		return checkVault(s.conn, s.version)
+	}
+	conn, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var version int
+	if err := conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("not a vault: %w", err)
+	}
+	return checkVault(conn, version)
+}
+
+func checkVault(conn *sql.DB, version int) error {
+	problems, err := integrityCheck(conn)
+	if err != nil {
+		return fmt.Errorf("not a vault: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", problems[0])
+	}
+	var tables int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'commands'`).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return errors.New("not a vault: it has no commands table")
+	}
+	if version > SchemaVersion() {
+		return fmt.Errorf("schema version %d is newer than this cmd-vault (%d)", version, SchemaVersion())
+	}
+	return nil
+}
+
+// Restore replaces the vault file at path with the backup at src, which
+// should have passed CheckFile.
+func Restore(src, path string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
@@ -1,12 +1,19 @@
 package db
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 const schema = `
@@ -20,24 +27,203 @@ CREATE TABLE IF NOT EXISTS commands (
 );
 `
 
+// migrations are applied in order on top of schema; PRAGMA user_version
+// records how many have already run against a database file.
+var migrations = []string{
+	`ALTER TABLE commands ADD COLUMN interpreter TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE commands ADD COLUMN tags TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE operations (
+		id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL,
+		label TEXT NOT NULL,
+		changes TEXT NOT NULL,
+		undone INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	)`,
+	// Trashed commands keep their row, so names only have to be unique
+	// among live commands. SQLite can't drop a constraint, hence the rebuild.
+	`CREATE TABLE commands_new (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		command_str TEXT NOT NULL,
+		note TEXT NOT NULL,
+		usage_count INTEGER DEFAULT 0,
+		created_at TEXT NOT NULL,
+		interpreter TEXT NOT NULL DEFAULT '',
+		tags TEXT NOT NULL DEFAULT '',
+		deleted_at TEXT
+	);
+	INSERT INTO commands_new (id, name, command_str, note, usage_count, created_at, interpreter, tags)
+		SELECT id, name, command_str, note, usage_count, created_at, interpreter, tags FROM commands;
+	DROP TABLE commands;
+	ALTER TABLE commands_new RENAME TO commands;
+	CREATE UNIQUE INDEX commands_live_name ON commands(name) WHERE deleted_at IS NULL;`,
+	`CREATE TABLE command_versions (
+		id INTEGER PRIMARY KEY,
+		command_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		command_str TEXT NOT NULL,
+		note TEXT NOT NULL,
+		interpreter TEXT NOT NULL,
+		tags TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX command_versions_command ON command_versions(command_id);
+	INSERT INTO command_versions (command_id, name, command_str, note, interpreter, tags, created_at)
+		SELECT id, name, command_str, note, interpreter, tags, created_at FROM commands;`,
+	`CREATE TABLE playbooks (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+	CREATE TABLE playbook_steps (
+		id INTEGER PRIMARY KEY,
+		playbook_id INTEGER NOT NULL REFERENCES playbooks(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		command_id INTEGER NOT NULL,
+		work_dir TEXT NOT NULL DEFAULT '',
+		continue_on_error INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE schedules (
+		id INTEGER PRIMARY KEY,
+		command_id INTEGER NOT NULL,
+		spec TEXT NOT NULL,
+		dir TEXT NOT NULL,
+		catch_up TEXT NOT NULL DEFAULT 'skip',
+		last_run TEXT,
+		created_at TEXT NOT NULL
+	);
+	CREATE TABLE runs (
+		id INTEGER PRIMARY KEY,
+		command_id INTEGER NOT NULL,
+		command_name TEXT NOT NULL,
+		source TEXT NOT NULL,
+		started_at TEXT NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		exit_code INTEGER NOT NULL,
+		output TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX runs_command ON runs(command_id, started_at);`,
+	`ALTER TABLE commands ADD COLUMN env TEXT NOT NULL DEFAULT '';
+	ALTER TABLE command_versions ADD COLUMN env TEXT NOT NULL DEFAULT '';
+	CREATE TABLE env_profiles (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		vars TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);`,
+	`CREATE TABLE secrets (
+		id INTEGER PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		value BLOB NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE TABLE secret_key (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		salt BLOB NOT NULL,
+		verifier BLOB NOT NULL
+	);`,
+	`ALTER TABLE commands ADD COLUMN pinned_at TEXT`,
+	`CREATE TABLE command_aliases (
+		alias TEXT PRIMARY KEY,
+		command_id INTEGER NOT NULL
+	);
+	CREATE INDEX command_aliases_command ON command_aliases(command_id);`,
+}
+
+// commandColumns is the column list scanCommand expects, in order. The
+// aliases come from their own table.
+const commandColumns = `id, name, command_str, note, interpreter, tags, env, usage_count, created_at, deleted_at, pinned_at,
+	(SELECT group_concat(alias, ',') FROM command_aliases WHERE command_id = commands.id)`
+
+// Store is the SQLite backend of storage.Store.
 type Store struct {
 	conn *sql.DB
+
+	// Set for encrypted vaults, which live in memory and are written back
+	// to path by Close.
+	path    string
+	key     *seal.Key
+	salt    []byte
+	rekeyed bool
+	sum     [sha256.Size]byte // of the file as it was opened
+
+	// version is the schema version the vault had when it was opened,
+	// before migrations.
+	version int
 }
 
+var _ storage.Store = (*Store)(nil)
+
+// Open opens the vault at path, creating it if needed. Encrypted vaults
+// have to be opened with OpenEncrypted.
 func Open(path string) (*Store, error) {
+	encrypted, err := IsEncrypted(path)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return nil, ErrEncrypted
+	}
 	conn, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_foreign_keys=ON")
 	if err != nil {
 		return nil, err
 	}
 	s := &Store{conn: conn}
-	if _, err := conn.Exec(schema); err != nil {
+	if err := s.init(); err != nil {
 		conn.Close()
 		return nil, err
 	}
 	return s, nil
 }
 
+// init creates the schema and applies pending migrations.
+func (s *Store) init() error {
+	if _, err := s.conn.Exec(schema); err != nil {
+		return err
+	}
+	return s.migrate()
+}
+
+// migrate brings the schema up to date with the migrations list.
+func (s *Store) migrate() error {
+	var version int
+	if err := s.conn.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	s.version = version
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.conn.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the vault, first writing an encrypted vault back to its
+// file when it changed.
 func (s *Store) Close() error {
+	if s.key != nil {
+		if err := s.persist(); err != nil {
+			s.conn.Close()
+			return err
+		}
+	}
 	if s.conn == nil {
 		return nil
 	}
@@ -45,22 +231,98 @@ func (s *Store) Close() error {
 }
 
 func (s *Store) InsertCommand(c *models.Command) (int64, error) {
-	if c.Name == "" {
-		return 0, errors.New("name is required")
+	ids, err := s.InsertCommands([]*models.Command{c})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// InsertCommands adds several commands in one transaction, as a single
+// undoable operation.
+func (s *Store) InsertCommands(cs []*models.Command) ([]int64, error) {
+	return s.ApplyBatch("add", storage.Batch{Insert: cs})
+}
+
+// ApplyBatch makes the changes of b in one transaction, as a single
+// undoable operation.
+func (s *Store) ApplyBatch(kind string, b storage.Batch) ([]int64, error) {
+	for _, c := range b.Update {
+		if c == nil {
+			return nil, errors.New("nil command")
+		}
+		c.Normalize()
+	}
+	for _, c := range b.Insert {
+		c.Normalize()
+		if c.Name == "" {
+			return nil, errors.New("name is required")
+		}
+		if c.Note == "" {
+			return nil, errors.New("note is required")
+		}
 	}
-	if c.Note == "" {
-		return 0, errors.New("note is required")
+	var ids []int
+	for _, c := range b.Update {
+		ids = append(ids, c.ID)
 	}
-	stmt := `INSERT INTO commands (name, command_str, note, usage_count, created_at) VALUES (?, ?, ?, ?, ?)`
-	res, err := s.conn.Exec(stmt, c.Name, c.CommandStr, c.Note, c.UsageCount, c.CreatedAt.Format(time.RFC3339))
+	ids = append(ids, b.Delete...)
+	var inserted []int64
+	now := time.Now().Format(time.RFC3339)
+	err := s.journaled(kind, ids, func(tx *sql.Tx) ([]int, error) {
+		touched := slices.Clone(ids)
+		for _, c := range b.Update {
+			if err := updateCommand(tx, c); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range b.Delete {
+			if _, err := tx.Exec(`UPDATE commands SET deleted_at=? WHERE id=? AND deleted_at IS NULL`, now, id); err != nil {
+				return nil, err
+			}
+		}
+		for _, c := range b.Insert {
+			id, err := insertCommand(tx, c)
+			if err != nil {
+				return nil, err
+			}
+			inserted = append(inserted, id)
+			touched = append(touched, int(id))
+		}
+		return touched, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+func insertCommand(tx *sql.Tx, c *models.Command) (int64, error) {
+	if owner, err := aliasOwner(tx, c.Name, 0); err != nil {
+		return 0, err
+	} else if owner != "" {
+		return 0, fmt.Errorf("%s is an alias of %s", c.Name, owner)
+	}
+	stmt := `INSERT INTO commands (name, command_str, note, interpreter, tags, env, usage_count, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := tx.Exec(stmt, c.Name, c.CommandStr, c.Note, c.Interpreter, joinTags(c.Tags), joinEnv(c.Env), c.UsageCount, c.CreatedAt.Format(time.RFC3339))
 	if err != nil {
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
+func updateCommand(tx *sql.Tx, c *models.Command) error {
+	if owner, err := aliasOwner(tx, c.Name, c.ID); err != nil {
+		return err
+	} else if owner != "" {
+		return fmt.Errorf("%s is an alias of %s", c.Name, owner)
+	}
+	_, err := tx.Exec(`UPDATE commands SET name=?, command_str=?, note=?, interpreter=?, tags=?, env=?, usage_count=? WHERE id=?`, c.Name, c.CommandStr, c.Note, c.Interpreter, joinTags(c.Tags), joinEnv(c.Env), c.UsageCount, c.ID)
+	return err
+}
+
 func (s *Store) GetAllCommands() ([]models.Command, error) {
-	rows, err := s.conn.Query(`SELECT id, name, command_str, note, usage_count, created_at FROM commands ORDER BY created_at DESC`)
+	rows, err := s.conn.Query(`SELECT ` + commandColumns + ` FROM commands WHERE deleted_at IS NULL ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -76,8 +338,44 @@ func (s *Store) GetAllCommands() ([]models.Command, error) {
 	return out, nil
 }
 
+// SearchCommands returns the live commands whose name, note, body, tags or
+// aliases contain query, ignoring case.
+func (s *Store) SearchCommands(query string) ([]models.Command, error) {
+	q := strings.ToLower(query)
+	rows, err := s.conn.Query(`SELECT `+commandColumns+` FROM commands WHERE deleted_at IS NULL
+		AND (instr(lower(name), ?) > 0 OR instr(lower(note), ?) > 0 OR instr(lower(command_str), ?) > 0 OR instr(lower(tags), ?) > 0
+			OR id IN (SELECT command_id FROM command_aliases WHERE instr(lower(alias), ?) > 0))
+		ORDER BY created_at DESC`, q, q, q, q, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Command
+	for rows.Next() {
+		c, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
 func (s *Store) GetByName(name string) (*models.Command, error) {
-	row := s.conn.QueryRow(`SELECT id, name, command_str, note, usage_count, created_at FROM commands WHERE name = ?`, name)
+	row := s.conn.QueryRow(`SELECT `+commandColumns+` FROM commands WHERE name = ? AND deleted_at IS NULL`, name)
+	c, err := scanCommand(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetByID returns a live command by id, or nil if there is none.
+func (s *Store) GetByID(id int) (*models.Command, error) {
+	row := s.conn.QueryRow(`SELECT `+commandColumns+` FROM commands WHERE id = ? AND deleted_at IS NULL`, id)
 	c, err := scanCommand(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -91,10 +389,31 @@ func (s *Store) GetByName(name string) (*models.Command, error) {
 // scanCommand is a helper to scan a command from a sql.Row or sql.Rows.
 func scanCommand(s interface{ Scan(...interface{}) error }) (models.Command, error) {
 	var c models.Command
-	var createdAt string
-	if err := s.Scan(&c.ID, &c.Name, &c.CommandStr, &c.Note, &c.UsageCount, &createdAt); err != nil {
+	var tags, env, createdAt string
+	var deletedAt, pinnedAt, aliases sql.NullString
+	if err := s.Scan(&c.ID, &c.Name, &c.CommandStr, &c.Note, &c.Interpreter, &tags, &env, &c.UsageCount, &createdAt, &deletedAt, &pinnedAt, &aliases); err != nil {
 		return models.Command{}, err
 	}
+	if aliases.Valid {
+		c.Aliases = strings.Split(aliases.String, ",")
+		sort.Strings(c.Aliases)
+	}
+	if deletedAt.Valid {
+		t, err := time.Parse(time.RFC3339, deletedAt.String)
+		if err != nil {
+			return models.Command{}, err
+		}
+		c.DeletedAt = t
+	}
+	if pinnedAt.Valid {
+		t, err := time.Parse(time.RFC3339Nano, pinnedAt.String)
+		if err != nil {
+			return models.Command{}, err
+		}
+		c.PinnedAt = t
+	}
+	c.Tags = models.ParseTags(tags)
+	c.Env = splitEnv(env)
 	parsedTime, err := time.Parse(time.RFC3339, createdAt)
 	if err != nil {
 		return models.Command{}, err
@@ -103,16 +422,40 @@ func scanCommand(s interface{ Scan(...interface{}) error }) (models.Command, err
 	return c, nil
 }
 
+// joinEnv stores environment variables one KEY=value pair per line.
+func joinEnv(vars []string) string {
+	return strings.Join(vars, "\n")
+}
+
+func splitEnv(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// joinTags stores tags as a comma separated list.
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
 func (s *Store) UpdateCommand(c *models.Command) error {
 	if c == nil {
 		return errors.New("nil command")
 	}
-	_, err := s.conn.Exec(`UPDATE commands SET name=?, command_str=?, note=?, usage_count=? WHERE id=?`, c.Name, c.CommandStr, c.Note, c.UsageCount, c.ID)
-	return err
+	c.Normalize()
+	return s.journaled("edit", []int{c.ID}, func(tx *sql.Tx) ([]int, error) {
+		return []int{c.ID}, updateCommand(tx, c)
+	})
 }
 
 func (s *Store) DeleteCommand(id int) error {
-	_, err := s.conn.Exec(`DELETE FROM commands WHERE id=?`, id)
+	return s.DeleteCommands([]int{id})
+}
+
+// DeleteCommands moves several commands to the trash as a single undoable operation.
+func (s *Store) DeleteCommands(ids []int) error {
+	_, err := s.ApplyBatch("delete", storage.Batch{Delete: ids})
 	return err
 }
 
@@ -120,3 +463,12 @@ func (s *Store) IncrementUsage(id int) error {
 	_, err := s.conn.Exec(`UPDATE commands SET usage_count = usage_count + 1 WHERE id = ?`, id)
 	return err
 }
+
+func (s *Store) SetPinned(id int, pinned bool) error {
+	var at interface{}
+	if pinned {
+		at = time.Now().Format(time.RFC3339Nano)
+	}
+	_, err := s.conn.Exec(`UPDATE commands SET pinned_at = ? WHERE id = ?`, at, id)
+	return err
+}
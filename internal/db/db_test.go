@@ -0,0 +1,110 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/kanekitakitos/cmd-vault/internal/storage/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := db.Open(filepath.Join(t.TempDir(), "vault.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestEncryptFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := db.Open(filepath.Join(dir, "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertCommand(&models.Command{Name: "hello", CommandStr: "echo hi", Note: "greets", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "backup.db")
+	if err := s.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	salt, err := seal.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := seal.DeriveKey("pw", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second call finds the file encrypted and leaves it alone.
+	for range 2 {
+		if err := db.EncryptFile(backup, key, salt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if encrypted, err := db.IsEncrypted(backup); err != nil || !encrypted {
+		t.Fatalf("IsEncrypted = %v, %v after EncryptFile", encrypted, err)
+	}
+	enc, err := db.OpenEncrypted(backup, func([]byte) (*seal.Key, error) { return key, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Discard()
+	cmds, err := enc.GetAllCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].Name != "hello" {
+		t.Errorf("the encrypted backup holds %v, want the hello command", cmds)
+	}
+}
+
+func TestCheckAfterPurge(t *testing.T) {
+	s, err := db.Open(filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	id, err := s.InsertCommand(&models.Command{Name: "hello", CommandStr: "echo hi", Note: "greets", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertPlaybook(&models.Playbook{Name: "morning", Steps: []models.PlaybookStep{{CommandID: int(id)}}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteCommand(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.EmptyTrash(); err != nil || n != 1 {
+		t.Fatalf("EmptyTrash = %d, %v", n, err)
+	}
+
+	// The playbook keeps its step to report the command as gone; that is
+	// not something for doctor to fix.
+	h, err := s.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Problems) != 0 || len(h.Orphans) != 0 {
+		t.Errorf("Check after a purge = %+v", h)
+	}
+	if n, err := s.RemoveOrphans(); err != nil || n != 0 {
+		t.Errorf("RemoveOrphans = %d, %v", n, err)
+	}
+	p, err := s.GetPlaybookByName("morning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Steps) != 1 || p.Steps[0].CommandID != int(id) {
+		t.Errorf("steps after doctor %+v", p.Steps)
+	}
+}
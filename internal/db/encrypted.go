@@ -0,0 +1,280 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/filelock"
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/mattn/go-sqlite3"
+)
+
+// encryptedMagic starts vault files encrypted with 'cmd-vault vault encrypt'.
+// It is followed by the key salt and the sealed SQLite database image.
+const encryptedMagic = "CMDVAULT-ENCRYPTED-1\n"
+
+// ErrEncrypted is returned by Open for a vault that needs OpenEncrypted.
+var ErrEncrypted = errors.New("the vault is encrypted")
+
+// Unlocker returns the key of an encrypted vault given its salt.
+type Unlocker func(salt []byte) (*seal.Key, error)
+
+// IsEncrypted reports whether the vault file at path is encrypted. A file
+// that doesn't exist yet is not.
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, len(encryptedMagic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false, nil
+	}
+	return string(head) == encryptedMagic, nil
+}
+
+// OpenEncrypted decrypts the vault at path into memory with the key returned
+// by unlock. The decrypted database never touches the disk; Close encrypts
+// it again and replaces the file when anything changed, unless another
+// process replaced it in the meantime.
+func OpenEncrypted(path string, unlock Unlocker) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) || len(data) < len(encryptedMagic)+seal.SaltSize {
+		return nil, fmt.Errorf("%s is not an encrypted vault", path)
+	}
+	data = data[len(encryptedMagic):]
+	salt, sealed := data[:seal.SaltSize], data[seal.SaltSize:]
+	key, err := unlock(salt)
+	if err != nil {
+		return nil, err
+	}
+	image, err := key.Open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openImage(image)
+	if err != nil {
+		return nil, err
+	}
+	s.path, s.key, s.salt, s.sum = path, key, salt, sum
+	return s, nil
+}
+
+// openImage loads a database file image into a private in-memory database.
+// A deserialized database can't grow, so the image is copied into a regular
+// in-memory one with the backup API.
+func openImage(image []byte) (*Store, error) {
+	src, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	conn, err := sql.Open("sqlite3", ":memory:?_foreign_keys=ON")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection would get its own empty in-memory database.
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
+
+	if err := copyImage(src, conn, image); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := &Store{conn: conn}
+	if err := s.init(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func copyImage(src, dst *sql.DB, image []byte) error {
+	ctx := context.Background()
+	sc, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	dc, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+	return sc.Raw(func(srcRaw any) error {
+		from := srcRaw.(*sqlite3.SQLiteConn)
+		if err := from.Deserialize(image, "main"); err != nil {
+			return err
+		}
+		return dc.Raw(func(dstRaw any) error {
+			b, err := dstRaw.(*sqlite3.SQLiteConn).Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// Encrypted reports whether the store was opened with OpenEncrypted.
+func (s *Store) Encrypted() bool {
+	return s.key != nil
+}
+
+// Serialize returns the vault as the contents of an SQLite database file.
+func (s *Store) Serialize() ([]byte, error) {
+	return serialize(s.conn)
+}
+
+// serialize returns the main database of conn as an SQLite file image.
+func serialize(conn *sql.DB) ([]byte, error) {
+	c, err := conn.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var data []byte
+	err = c.Raw(func(raw any) error {
+		data, err = raw.(*sqlite3.SQLiteConn).Serialize("main")
+		return err
+	})
+	return data, err
+}
+
+// Discard closes the vault without writing an encrypted vault back.
+func (s *Store) Discard() error {
+	s.key = nil
+	return s.conn.Close()
+}
+
+// Rekey makes Close write the encrypted vault back under key and salt.
+func (s *Store) Rekey(key *seal.Key, salt []byte) {
+	s.key, s.salt, s.rekeyed = key, salt, true
+}
+
+// Decrypt writes the encrypted vault back to its file as a plain SQLite
+// database and closes the store.
+func (s *Store) Decrypt() error {
+	if s.key == nil {
+		return errors.New("the vault is not encrypted")
+	}
+	data, err := s.Serialize()
+	if err != nil {
+		return err
+	}
+	key := s.key
+	s.key = nil
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+	return s.writeBack(key, data, func() error { return writeFileAtomic(s.path, data) })
+}
+
+// Encrypt replaces the plain vault at path with an encrypted one sealed with
+// key. salt is stored with it so the key can be derived again.
+func Encrypt(path string, key *seal.Key, salt []byte) error {
+	s, err := Open(path)
+	if err != nil {
+		return err
+	}
+	data, err := s.Serialize()
+	s.Close()
+	if err != nil {
+		return err
+	}
+	return writeEncrypted(path, key, salt, data)
+}
+
+// persist writes an encrypted vault back to its file if it changed.
+func (s *Store) persist() error {
+	var changes int
+	if err := s.conn.QueryRow(`SELECT total_changes()`).Scan(&changes); err != nil {
+		return err
+	}
+	if changes == 0 && !s.rekeyed {
+		return nil
+	}
+	data, err := s.Serialize()
+	if err != nil {
+		return err
+	}
+	return s.writeBack(s.key, data, func() error { return writeEncrypted(s.path, s.key, s.salt, data) })
+}
+
+// writeBack runs write, which replaces the vault file, holding the lock
+// file of the vault. When another process replaced the file since it was
+// opened, image is sealed with key into a conflict file next to it instead
+// and an error says where, so that neither side's changes are lost.
+func (s *Store) writeBack(key *seal.Key, image []byte, write func() error) error {
+	lock, err := filelock.Acquire(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	current, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(current) == s.sum {
+		return write()
+	}
+	aside := fmt.Sprintf("%s.conflict-%s", s.path, time.Now().Format("20060102-150405"))
+	if err := writeEncrypted(aside, key, s.salt, image); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s was changed by another cmd-vault process while it was open; the changes made here were saved to %s instead (open it with 'cmd-vault --db %s' to copy them over)", s.path, aside, aside)
+}
+
+func writeEncrypted(path string, key *seal.Key, salt, image []byte) error {
+	sealed, err := key.Seal(image)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString(encryptedMagic)
+	b.Write(salt)
+	b.Write(sealed)
+	return writeFileAtomic(path, b.Bytes())
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new file, never a truncated one.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".cmd-vault-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// SaveEnvProfile creates the profile, or replaces the variables of the
+// profile with the same name.
+func (s *Store) SaveEnvProfile(p *models.EnvProfile) error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	_, err := s.conn.Exec(`INSERT INTO env_profiles (name, vars, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET vars = excluded.vars`,
+		p.Name, joinEnv(p.Vars), p.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (s *Store) DeleteEnvProfile(id int) error {
+	_, err := s.conn.Exec(`DELETE FROM env_profiles WHERE id=?`, id)
+	return err
+}
+
+func (s *Store) GetEnvProfiles() ([]models.EnvProfile, error) {
+	rows, err := s.conn.Query(`SELECT id, name, vars, created_at FROM env_profiles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.EnvProfile
+	for rows.Next() {
+		p, err := scanEnvProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GetEnvProfileByName returns the named profile, or nil if there is none.
+func (s *Store) GetEnvProfileByName(name string) (*models.EnvProfile, error) {
+	p, err := scanEnvProfile(s.conn.QueryRow(`SELECT id, name, vars, created_at FROM env_profiles WHERE name = ?`, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func scanEnvProfile(s interface{ Scan(...interface{}) error }) (models.EnvProfile, error) {
+	var p models.EnvProfile
+	var vars, createdAt string
+	if err := s.Scan(&p.ID, &p.Name, &vars, &createdAt); err != nil {
+		return models.EnvProfile{}, err
+	}
+	p.Vars = splitEnv(vars)
+	parsedTime, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return models.EnvProfile{}, err
+	}
+	p.CreatedAt = parsedTime
+	return p, nil
+}
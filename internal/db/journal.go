@@ -0,0 +1,215 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// change is the state of one command before and after an operation.
+// A nil state means the command did not exist.
+type change struct {
+	ID     int             `json:"id"`
+	Before *models.Command `json:"before"`
+	After  *models.Command `json:"after"`
+}
+
+// journaled runs fn in a transaction and records the state of every command
+// it touched as a single operation. ids lists the commands that exist before
+// fn runs; fn returns all ids it touched, including newly created ones.
+func (s *Store) journaled(kind string, ids []int, fn func(tx *sql.Tx) ([]int, error)) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before := map[int]*models.Command{}
+	for _, id := range ids {
+		c, err := getByID(tx, id)
+		if err != nil {
+			return err
+		}
+		before[id] = c
+	}
+
+	touched, err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	var changes []change
+	var names []string
+	for _, id := range touched {
+		after, err := getByID(tx, id)
+		if err != nil {
+			return err
+		}
+		ch := change{ID: id, Before: before[id], After: after}
+		if ch.Before == nil && ch.After == nil {
+			continue
+		}
+		changes = append(changes, ch)
+		if ch.After != nil {
+			if err := recordVersion(tx, ch.After); err != nil {
+				return err
+			}
+			names = append(names, ch.After.Name)
+		} else if ch.Before != nil {
+			names = append(names, ch.Before.Name)
+		}
+	}
+	if len(changes) == 0 {
+		return tx.Commit()
+	}
+	if err := recordOperation(tx, kind, kind+" "+strings.Join(names, ", "), changes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordOperation appends an operation to the journal, dropping the redo
+// history it invalidates and anything beyond JournalSize.
+func recordOperation(tx *sql.Tx, kind, label string, changes []change) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM operations WHERE undone = 1`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO operations (kind, label, changes, undone, created_at) VALUES (?, ?, ?, 0, ?)`,
+		kind, label, string(data), time.Now().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM operations WHERE id NOT IN (SELECT id FROM operations ORDER BY id DESC LIMIT ?)`, storage.JournalSize)
+	return err
+}
+
+// Undo reverts the most recent operation that hasn't been undone yet.
+func (s *Store) Undo() (*storage.Operation, error) {
+	return s.replay(`SELECT id, kind, label, changes, undone, created_at FROM operations WHERE undone = 0 ORDER BY id DESC LIMIT 1`, true)
+}
+
+// Redo re-applies the most recently undone operation.
+func (s *Store) Redo() (*storage.Operation, error) {
+	return s.replay(`SELECT id, kind, label, changes, undone, created_at FROM operations WHERE undone = 1 ORDER BY id ASC LIMIT 1`, false)
+}
+
+func (s *Store) replay(query string, undo bool) (*storage.Operation, error) {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var op storage.Operation
+	var data, createdAt string
+	err = tx.QueryRow(query).Scan(&op.ID, &op.Kind, &op.Label, &data, &op.Undone, &createdAt)
+	if err == sql.ErrNoRows {
+		if undo {
+			return nil, storage.ErrNothingToUndo
+		}
+		return nil, storage.ErrNothingToRedo
+	}
+	if err != nil {
+		return nil, err
+	}
+	op.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+
+	var changes []change
+	if err := json.Unmarshal([]byte(data), &changes); err != nil {
+		return nil, fmt.Errorf("corrupt journal entry %d: %w", op.ID, err)
+	}
+	if undo {
+		for i := len(changes) - 1; i >= 0; i-- {
+			if err := restoreState(tx, changes[i].ID, changes[i].Before); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, ch := range changes {
+			if err := restoreState(tx, ch.ID, ch.After); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, ch := range changes {
+		c, err := getByID(tx, ch.ID)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			if err := recordVersion(tx, c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	op.Undone = undo
+	if _, err := tx.Exec(`UPDATE operations SET undone = ? WHERE id = ?`, op.Undone, op.ID); err != nil {
+		return nil, err
+	}
+	return &op, tx.Commit()
+}
+
+// restoreState puts the command with the given id into state c, removing it
+// when c is nil. The live usage count is kept so undo doesn't lose runs.
+func restoreState(tx *sql.Tx, id int, c *models.Command) error {
+	current, err := getByID(tx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c == nil:
+		if _, err = tx.Exec(`DELETE FROM commands WHERE id = ?`, id); err == nil {
+			_, err = tx.Exec(`DELETE FROM command_aliases WHERE command_id = ?`, id)
+		}
+	case current != nil:
+		_, err = tx.Exec(`UPDATE commands SET name=?, command_str=?, note=?, interpreter=?, tags=?, env=?, deleted_at=? WHERE id=?`,
+			c.Name, c.CommandStr, c.Note, c.Interpreter, joinTags(c.Tags), joinEnv(c.Env), deletedAt(c), id)
+	default:
+		_, err = tx.Exec(`INSERT INTO commands (id, name, command_str, note, interpreter, tags, env, usage_count, created_at, deleted_at, pinned_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, c.Name, c.CommandStr, c.Note, c.Interpreter, joinTags(c.Tags), joinEnv(c.Env), c.UsageCount, c.CreatedAt.Format(time.RFC3339), deletedAt(c), pinnedAt(c))
+	}
+	if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+		return fmt.Errorf("cannot restore %q: another command now uses that name", c.Name)
+	}
+	return err
+}
+
+// Operations lists the journal, newest first.
+func (s *Store) Operations() ([]storage.Operation, error) {
+	rows, err := s.conn.Query(`SELECT id, kind, label, undone, created_at FROM operations ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []storage.Operation
+	for rows.Next() {
+		var op storage.Operation
+		var createdAt string
+		if err := rows.Scan(&op.ID, &op.Kind, &op.Label, &op.Undone, &createdAt); err != nil {
+			return nil, err
+		}
+		op.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		out = append(out, op)
+	}
+	return out, rows.Err()
+}
+
+// getByID loads a command inside a transaction, returning nil if it doesn't exist.
+func getByID(tx *sql.Tx, id int) (*models.Command, error) {
+	c, err := scanCommand(tx.QueryRow(`SELECT `+commandColumns+` FROM commands WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+func (s *Store) InsertPlaybook(p *models.Playbook) (int64, error) {
+	if p.Name == "" {
+		return 0, errors.New("name is required")
+	}
+	if len(p.Steps) == 0 {
+		return 0, errors.New("a playbook needs at least one step")
+	}
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO playbooks (name, note, created_at) VALUES (?, ?, ?)`, p.Name, p.Note, p.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := insertSteps(tx, id, p.Steps); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdatePlaybook saves the name, note and steps of an existing playbook.
+func (s *Store) UpdatePlaybook(p *models.Playbook) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE playbooks SET name=?, note=? WHERE id=?`, p.Name, p.Note, p.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM playbook_steps WHERE playbook_id=?`, p.ID); err != nil {
+		return err
+	}
+	if err := insertSteps(tx, int64(p.ID), p.Steps); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertSteps(tx *sql.Tx, playbookID int64, steps []models.PlaybookStep) error {
+	for i, st := range steps {
+		if _, err := tx.Exec(`INSERT INTO playbook_steps (playbook_id, position, command_id, work_dir, continue_on_error) VALUES (?, ?, ?, ?, ?)`,
+			playbookID, i, st.CommandID, st.WorkDir, st.ContinueOnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeletePlaybook(id int) error {
+	_, err := s.conn.Exec(`DELETE FROM playbooks WHERE id=?`, id)
+	return err
+}
+
+func (s *Store) GetAllPlaybooks() ([]models.Playbook, error) {
+	rows, err := s.conn.Query(`SELECT id, name, note, created_at FROM playbooks ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Playbook
+	for rows.Next() {
+		p, err := scanPlaybook(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].Steps, err = s.playbookSteps(out[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetPlaybookByName(name string) (*models.Playbook, error) {
+	p, err := scanPlaybook(s.conn.QueryRow(`SELECT id, name, note, created_at FROM playbooks WHERE name = ?`, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if p.Steps, err = s.playbookSteps(p.ID); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// playbookSteps loads the steps of a playbook in order. CommandName is empty
+// for steps whose command has been purged; trashed commands keep their name.
+func (s *Store) playbookSteps(playbookID int) ([]models.PlaybookStep, error) {
+	rows, err := s.conn.Query(`SELECT st.command_id, COALESCE(c.name, ''), st.work_dir, st.continue_on_error
+		FROM playbook_steps st LEFT JOIN commands c ON c.id = st.command_id
+		WHERE st.playbook_id = ? ORDER BY st.position`, playbookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.PlaybookStep
+	for rows.Next() {
+		var st models.PlaybookStep
+		if err := rows.Scan(&st.CommandID, &st.CommandName, &st.WorkDir, &st.ContinueOnError); err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+func scanPlaybook(s interface{ Scan(...interface{}) error }) (models.Playbook, error) {
+	var p models.Playbook
+	var createdAt string
+	if err := s.Scan(&p.ID, &p.Name, &p.Note, &createdAt); err != nil {
+		return models.Playbook{}, err
+	}
+	parsedTime, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return models.Playbook{}, err
+	}
+	p.CreatedAt = parsedTime
+	return p, nil
+}
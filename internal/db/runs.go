@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// InsertRun records a run and drops the oldest runs of the same command
+// beyond storage.RunHistorySize.
+func (s *Store) InsertRun(r *models.Run) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO runs (command_id, command_name, source, started_at, duration_ms, exit_code, output, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.CommandID, r.CommandName, r.Source, r.StartedAt.Format(time.RFC3339), r.Duration.Milliseconds(), r.ExitCode, r.Output, r.Error); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM runs WHERE command_id = ? AND id NOT IN
+		(SELECT id FROM runs WHERE command_id = ? ORDER BY id DESC LIMIT ?)`, r.CommandID, r.CommandID, storage.RunHistorySize); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Runs lists recorded runs, newest first. A commandID of 0 lists the runs
+// of every command.
+func (s *Store) Runs(commandID, limit int) ([]models.Run, error) {
+	rows, err := s.conn.Query(`SELECT id, command_id, command_name, source, started_at, duration_ms, exit_code, output, error
+		FROM runs WHERE ? = 0 OR command_id = ? ORDER BY id DESC LIMIT ?`, commandID, commandID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Run
+	for rows.Next() {
+		var r models.Run
+		var startedAt string
+		var ms int64
+		if err := rows.Scan(&r.ID, &r.CommandID, &r.CommandName, &r.Source, &startedAt, &ms, &r.ExitCode, &r.Output, &r.Error); err != nil {
+			return nil, err
+		}
+		if r.StartedAt, err = time.Parse(time.RFC3339, startedAt); err != nil {
+			return nil, err
+		}
+		r.Duration = time.Duration(ms) * time.Millisecond
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+const scheduleColumns = `s.id, s.command_id, COALESCE(c.name, ''), s.spec, s.dir, s.catch_up, s.last_run, s.created_at`
+
+func (s *Store) InsertSchedule(sc *models.Schedule) (int64, error) {
+	if sc.Spec == "" {
+		return 0, errors.New("a schedule needs a cron expression")
+	}
+	res, err := s.conn.Exec(`INSERT INTO schedules (command_id, spec, dir, catch_up, created_at) VALUES (?, ?, ?, ?, ?)`,
+		sc.CommandID, sc.Spec, sc.Dir, sc.CatchUp, sc.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) DeleteSchedule(id int) error {
+	res, err := s.conn.Exec(`DELETE FROM schedules WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// GetAllSchedules lists every schedule in the order they were added.
+// CommandName is empty when the command has been purged.
+func (s *Store) GetAllSchedules() ([]models.Schedule, error) {
+	rows, err := s.conn.Query(`SELECT ` + scheduleColumns + ` FROM schedules s LEFT JOIN commands c ON c.id = s.command_id ORDER BY s.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Schedule
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// SetScheduleLastRun records the scheduled time of the latest run so that
+// the next one is computed from it.
+func (s *Store) SetScheduleLastRun(id int, at time.Time) error {
+	_, err := s.conn.Exec(`UPDATE schedules SET last_run=? WHERE id=?`, at.Format(time.RFC3339), id)
+	return err
+}
+
+func scanSchedule(s interface{ Scan(...interface{}) error }) (models.Schedule, error) {
+	var sc models.Schedule
+	var lastRun sql.NullString
+	var createdAt string
+	if err := s.Scan(&sc.ID, &sc.CommandID, &sc.CommandName, &sc.Spec, &sc.Dir, &sc.CatchUp, &lastRun, &createdAt); err != nil {
+		return models.Schedule{}, err
+	}
+	var err error
+	if sc.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return models.Schedule{}, err
+	}
+	if lastRun.Valid {
+		if sc.LastRun, err = time.Parse(time.RFC3339, lastRun.String); err != nil {
+			return models.Schedule{}, err
+		}
+	}
+	return sc, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// SecretKey returns the salt of the secrets key and the value used to check
+// a passphrase against it, or nils when no secret was ever stored.
+func (s *Store) SecretKey() (salt, verifier []byte, err error) {
+	err = s.conn.QueryRow(`SELECT salt, verifier FROM secret_key WHERE id = 1`).Scan(&salt, &verifier)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	return salt, verifier, err
+}
+
+// SetSecretKey records the salt and verifier of a new secrets key.
+func (s *Store) SetSecretKey(salt, verifier []byte) error {
+	_, err := s.conn.Exec(`INSERT OR REPLACE INTO secret_key (id, salt, verifier) VALUES (1, ?, ?)`, salt, verifier)
+	return err
+}
+
+// PutSecret stores the encrypted value of the named secret, replacing an
+// earlier value.
+func (s *Store) PutSecret(name string, value []byte) error {
+	now := time.Now().Format(time.RFC3339)
+	_, err := s.conn.Exec(`INSERT INTO secrets (name, value, created_at, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		name, value, now, now)
+	return err
+}
+
+// SecretValue returns the encrypted value of the named secret, or nil if
+// there is none.
+func (s *Store) SecretValue(name string) ([]byte, error) {
+	var value []byte
+	err := s.conn.QueryRow(`SELECT value FROM secrets WHERE name = ?`, name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *Store) DeleteSecret(name string) error {
+	res, err := s.conn.Exec(`DELETE FROM secrets WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Secrets lists the stored secrets by name, without their values.
+func (s *Store) Secrets() ([]models.Secret, error) {
+	rows, err := s.conn.Query(`SELECT id, name, created_at, updated_at FROM secrets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Secret
+	for rows.Next() {
+		var sec models.Secret
+		var createdAt, updatedAt string
+		if err := rows.Scan(&sec.ID, &sec.Name, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		if sec.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		if sec.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, sec)
+	}
+	return out, rows.Err()
+}
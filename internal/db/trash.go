@@ -0,0 +1,154 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// deletedAt converts a command's trash timestamp to a nullable column value.
+func deletedAt(c *models.Command) interface{} {
+	if c.DeletedAt.IsZero() {
+		return nil
+	}
+	return c.DeletedAt.Format(time.RFC3339)
+}
+
+func pinnedAt(c *models.Command) interface{} {
+	if !c.Pinned() {
+		return nil
+	}
+	return c.PinnedAt.Format(time.RFC3339Nano)
+}
+
+// TrashedCommands lists commands in the trash, most recently deleted first.
+func (s *Store) TrashedCommands() ([]models.Command, error) {
+	rows, err := s.conn.Query(`SELECT ` + commandColumns + ` FROM commands WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Command
+	for rows.Next() {
+		c, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetTrashedByName returns the most recently trashed command with the given
+// name, or nil if there is none.
+func (s *Store) GetTrashedByName(name string) (*models.Command, error) {
+	row := s.conn.QueryRow(`SELECT `+commandColumns+` FROM commands WHERE name = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC LIMIT 1`, name)
+	c, err := scanCommand(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// RestoreCommand takes a command out of the trash. If name is empty the
+// command keeps its own name, or gets a free variant of it when a live
+// command took the name in the meantime. The final name is returned.
+func (s *Store) RestoreCommand(id int, name string) (string, error) {
+	err := s.journaled("restore", []int{id}, func(tx *sql.Tx) ([]int, error) {
+		c, err := getByID(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil || c.DeletedAt.IsZero() {
+			return nil, fmt.Errorf("command %d is not in the trash", id)
+		}
+		if name == "" {
+			if name, err = freeName(tx, c.Name); err != nil {
+				return nil, err
+			}
+		} else if taken, err := nameTaken(tx, name); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, fmt.Errorf("a command named %s already exists", name)
+		}
+		_, err = tx.Exec(`UPDATE commands SET name=?, deleted_at=NULL WHERE id=?`, name, id)
+		return []int{id}, err
+	})
+	return name, err
+}
+
+// PurgeCommand permanently removes a command from the trash.
+func (s *Store) PurgeCommand(id int) error {
+	_, err := s.purge(`DELETE FROM commands WHERE id=? AND deleted_at IS NOT NULL`, id)
+	return err
+}
+
+// EmptyTrash permanently removes every trashed command and reports how many.
+func (s *Store) EmptyTrash() (int64, error) {
+	return s.purge(`DELETE FROM commands WHERE deleted_at IS NOT NULL`)
+}
+
+// PurgeTrash permanently removes commands trashed longer than retention ago.
+// A zero retention keeps the trash forever.
+func (s *Store) PurgeTrash(retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention).Format(time.RFC3339)
+	return s.purge(`DELETE FROM commands WHERE deleted_at IS NOT NULL AND deleted_at < ?`, cutoff)
+}
+
+// purge runs a hard delete of commands together with the rows that belong to them.
+func (s *Store) purge(query string, args ...interface{}) (int64, error) {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return n, err
+	}
+	if _, err := tx.Exec(`DELETE FROM command_versions WHERE command_id NOT IN (SELECT id FROM commands)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM schedules WHERE command_id NOT IN (SELECT id FROM commands)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM command_aliases WHERE command_id NOT IN (SELECT id FROM commands)`); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func nameTaken(tx *sql.Tx, name string) (bool, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM commands WHERE name = ? AND deleted_at IS NULL`, name).Scan(&n)
+	return n > 0, err
+}
+
+// freeName returns name, or name-restored, name-restored-2, ... whichever
+// is not used by a live command.
+func freeName(tx *sql.Tx, name string) (string, error) {
+	candidate := name
+	for i := 1; ; i++ {
+		taken, err := nameTaken(tx, candidate)
+		if err != nil || !taken {
+			return candidate, err
+		}
+		if i == 1 {
+			candidate = name + "-restored"
+		} else {
+			candidate = fmt.Sprintf("%s-restored-%d", name, i)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// recordVersion stores the editable fields of c as a new version unless they
+// are the same as the latest recorded version.
+func recordVersion(tx *sql.Tx, c *models.Command) error {
+	var name, commandStr, note, interpreter, tags, env string
+	err := tx.QueryRow(`SELECT name, command_str, note, interpreter, tags, env FROM command_versions WHERE command_id = ? ORDER BY id DESC LIMIT 1`, c.ID).
+		Scan(&name, &commandStr, &note, &interpreter, &tags, &env)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && name == c.Name && commandStr == c.CommandStr && note == c.Note && interpreter == c.Interpreter && tags == joinTags(c.Tags) && env == joinEnv(c.Env) {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO command_versions (command_id, name, command_str, note, interpreter, tags, env, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Name, c.CommandStr, c.Note, c.Interpreter, joinTags(c.Tags), joinEnv(c.Env), time.Now().Format(time.RFC3339))
+	return err
+}
+
+// Versions lists the recorded versions of a command, newest first.
+func (s *Store) Versions(commandID int) ([]models.Version, error) {
+	rows, err := s.conn.Query(`SELECT id, name, command_str, note, interpreter, tags, env, created_at FROM command_versions WHERE command_id = ? ORDER BY id DESC`, commandID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []models.Version
+	for rows.Next() {
+		v := models.Version{Command: models.Command{ID: commandID}}
+		var tags, env, createdAt string
+		if err := rows.Scan(&v.ID, &v.Command.Name, &v.Command.CommandStr, &v.Command.Note, &v.Command.Interpreter, &tags, &env, &createdAt); err != nil {
+			return nil, err
+		}
+		v.Command.Tags = models.ParseTags(tags)
+		v.Command.Env = splitEnv(env)
+		if v.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Number = len(out) - i
+	}
+	return out, nil
+}
+
+// RollbackCommand restores a command's editable fields from one of its
+// versions. The rollback is itself journaled and recorded as a new version.
+func (s *Store) RollbackCommand(commandID, versionID int) error {
+	return s.journaled("rollback", []int{commandID}, func(tx *sql.Tx) ([]int, error) {
+		var name, commandStr, note, interpreter, tags, env string
+		err := tx.QueryRow(`SELECT name, command_str, note, interpreter, tags, env FROM command_versions WHERE id = ? AND command_id = ?`, versionID, commandID).
+			Scan(&name, &commandStr, &note, &interpreter, &tags, &env)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("version %d does not belong to command %d", versionID, commandID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		v := models.Command{Name: name, CommandStr: commandStr, Note: note, Interpreter: interpreter, Tags: models.ParseTags(tags), Env: splitEnv(env)}
+		v.Normalize()
+		_, err = tx.Exec(`UPDATE commands SET name=?, command_str=?, note=?, interpreter=?, tags=?, env=? WHERE id=?`,
+			v.Name, v.CommandStr, v.Note, v.Interpreter, joinTags(v.Tags), joinEnv(v.Env), commandID)
+		if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+			return nil, fmt.Errorf("cannot roll back: another command now uses the name %s", name)
+		}
+		return []int{commandID}, err
+	})
+}
@@ -0,0 +1,53 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name, a, b string
+		want       []Line
+	}{
+		{"both empty", "", "", nil},
+		{"added", "", "a\nb\n", []Line{{Insert, "a"}, {Insert, "b"}}},
+		{"removed", "a\nb", "", []Line{{Delete, "a"}, {Delete, "b"}}},
+		{"same", "a\nb\n", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"line ends", "a\r\nb\r\n", "a\nb\n", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"changed line", "a\nb\nc", "a\nB\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "B"}, {Equal, "c"}}},
+		{"inserted in the middle", "a\nc", "a\nb\nc", []Line{{Equal, "a"}, {Insert, "b"}, {Equal, "c"}}},
+		{"removed at the end", "a\nb\nc", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}, {Delete, "c"}}},
+		{"moved", "a\nb\nc", "b\nc\na", []Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}}},
+		{"blank lines count", "a\n\nb", "a\nb", []Line{{Equal, "a"}, {Delete, ""}, {Equal, "b"}}},
+	}
+	for _, tt := range tests {
+		if got := Lines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Lines = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLinesKeepsLongestCommonPart(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6"
+	b := "0\n2\n3\nx\n5\n6\n7"
+	var equal int
+	for _, l := range Lines(a, b) {
+		if l.Op == Equal {
+			equal++
+		}
+	}
+	if equal != 4 {
+		t.Errorf("%d equal lines, want 4", equal)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format([]Line{{Equal, "a"}, {Delete, "b"}, {Insert, "c"}})
+	if want := " a\n-b\n+c\n"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+	if got := Format(nil); got != "" {
+		t.Errorf("Format(nil) = %q", got)
+	}
+}
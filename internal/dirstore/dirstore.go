@@ -0,0 +1,504 @@
+// Package dirstore keeps a vault as a directory of plain-text files so that
+// it can be versioned and reviewed with git. Every live command is one file
+// under commands/, in the front-matter format of package document:
+//
+//	~/vault/
+//	  commands/deploy.txt
+//	  commands/k8s/logs.txt
+//	  .state.json
+//	  .lock
+//	  .gitignore
+//
+// The command files are the source of truth: files added, edited or removed
+// by hand (or by a git pull) are picked up the next time the vault is
+// opened or changed. .state.json holds everything else — ids, usage counts,
+// trash, version history, the undo journal, runs, playbooks, schedules,
+// profiles and encrypted secrets — and is ignored by git by default, like
+// the .lock file that processes take turns on.
+package dirstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/filelock"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// Scheme prefixes vault locations that are directories, as in dir://~/vault.
+const Scheme = "dir://"
+
+const (
+	commandsDir = "commands"
+	stateFile   = ".state.json"
+	lockFile    = ".lock"
+)
+
+// Path returns the directory of a dir:// location, with a leading ~
+// expanded to the home directory. ok is false for other locations.
+func Path(location string) (dir string, ok bool) {
+	dir, ok = strings.CutPrefix(location, Scheme)
+	if !ok {
+		return "", false
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, dir[1:])
+		}
+	}
+	return dir, true
+}
+
+// Store is a storage.Store kept in a directory. The vault is held in memory
+// and written back after every change; only command files whose text
+// changed are rewritten, so diffs stay small.
+//
+// Several processes may have the vault open at once. Every change takes
+// the lock file of the vault, reads the directory again and writes back
+// only the files it changed, so changes made elsewhere are kept.
+type Store struct {
+	*storage.Memory
+	dir string
+
+	mu sync.Mutex // serialises changes within the process
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// Open opens the vault in dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, commandsDir), 0o755); err != nil {
+		return nil, err
+	}
+	if err := writeGitignore(dir); err != nil {
+		return nil, err
+	}
+	s := &Store{Memory: storage.NewMemory(), dir: dir}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the vault from the directory again, picking up changes made
+// by other processes.
+func (s *Store) Reload() error {
+	return s.locked(s.load)
+}
+
+// locked runs fn holding the lock file of the vault.
+func (s *Store) locked(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, err := filelock.Acquire(filepath.Join(s.dir, lockFile))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	return fn()
+}
+
+// load reads the state and command files into memory. Command files
+// changed by hand are taken in and recorded in the state file right away,
+// so that every process gives new commands the same ids.
+func (s *Store) load() error {
+	snap, err := readState(s.dir)
+	if err != nil {
+		return err
+	}
+	files, err := readCommands(s.dir)
+	if err != nil {
+		return err
+	}
+	changed := reconcile(&snap, files)
+	s.Memory.Load(snap)
+	if !changed {
+		return nil
+	}
+	texts := commandTexts(s.dir, snap)
+	return s.save(texts)
+}
+
+// update applies change to the vault as it is on disk and writes back what
+// it changed.
+func (s *Store) update(change func() error) error {
+	return s.locked(func() error {
+		if err := s.load(); err != nil {
+			return err
+		}
+		before := commandTexts(s.dir, s.Memory.Snapshot())
+		if err := change(); err != nil {
+			return err
+		}
+		return s.save(before)
+	})
+}
+
+// Dir returns the directory of the vault.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func readState(dir string) (storage.Snapshot, error) {
+	var snap storage.Snapshot
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("%s: %w", stateFile, err)
+	}
+	return snap, nil
+}
+
+// commandFile is a command read from its file.
+type commandFile struct {
+	command *models.Command
+	path    string
+	modTime time.Time
+}
+
+// readCommands decodes every command file, keyed by command name.
+func readCommands(dir string) (map[string]commandFile, error) {
+	root := filepath.Join(dir, commandsDir)
+	files := map[string]commandFile{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, document.Ext) {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		c, err := document.Decode(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if other, ok := files[c.Name]; ok {
+			return fmt.Errorf("%s: command %s is also defined in %s", path, c.Name, other.path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[c.Name] = commandFile{command: c, path: path, modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// reconcile brings the live commands of snap in line with the command
+// files. Edited commands get a new version, commands whose file is gone
+// move to the trash and new files become new commands. It reports whether
+// anything changed.
+func reconcile(snap *storage.Snapshot, files map[string]commandFile) bool {
+	changed := false
+	now := time.Now()
+	seen := map[string]bool{}
+	for i := range snap.Commands {
+		c := &snap.Commands[i]
+		if !c.DeletedAt.IsZero() {
+			continue
+		}
+		f, ok := files[c.Name]
+		if !ok {
+			c.DeletedAt = now
+			changed = true
+			continue
+		}
+		seen[c.Name] = true
+		if document.Encode(c) == document.Encode(f.command) {
+			continue
+		}
+		c.CommandStr, c.Note, c.Interpreter = f.command.CommandStr, f.command.Note, f.command.Interpreter
+		c.Tags, c.Env = f.command.Tags, f.command.Env
+		addVersion(snap, *c, now)
+		changed = true
+	}
+	for name, f := range files {
+		if seen[name] {
+			continue
+		}
+		c := *f.command
+		c.ID = snap.NextCommandID()
+		c.CreatedAt = f.modTime
+		snap.Commands = append(snap.Commands, c)
+		addVersion(snap, c, now)
+		changed = true
+	}
+	return changed
+}
+
+func addVersion(snap *storage.Snapshot, c models.Command, at time.Time) {
+	v := models.Command{ID: c.ID, Name: c.Name, CommandStr: c.CommandStr, Note: c.Note, Interpreter: c.Interpreter, Tags: c.Tags, Env: c.Env}
+	snap.Versions = append(snap.Versions, storage.VersionRecord{ID: snap.NextVersionID(), Command: v, CreatedAt: at})
+}
+
+// writeGitignore keeps the state and lock files out of git, adding them to
+// the .gitignore of the vault when they are missing.
+func writeGitignore(dir string) error {
+	path := filepath.Join(dir, ".gitignore")
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	text := string(data)
+	lines := strings.Split(text, "\n")
+	for _, name := range []string{stateFile, lockFile} {
+		if slices.Contains(lines, name) {
+			continue
+		}
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		text += name + "\n"
+	}
+	if text == string(data) {
+		return nil
+	}
+	return os.WriteFile(path, []byte(text), 0o644)
+}
+
+// commandTexts maps the file of every live command in snap to its text.
+func commandTexts(dir string, snap storage.Snapshot) map[string]string {
+	root := filepath.Join(dir, commandsDir)
+	texts := map[string]string{}
+	for i := range snap.Commands {
+		if c := &snap.Commands[i]; c.DeletedAt.IsZero() {
+			texts[filepath.Join(root, document.FileName(c.Name))] = document.Encode(c)
+		}
+	}
+	return texts
+}
+
+// save writes the files of the commands whose text changed since before
+// and removes those of the commands that are no longer live, then rewrites
+// the state file. Other files are left alone.
+func (s *Store) save(before map[string]string) error {
+	snap := s.Memory.Snapshot()
+	after := commandTexts(s.dir, snap)
+	root := filepath.Join(s.dir, commandsDir)
+	for path := range before {
+		if _, ok := after[path]; ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Remove folders left empty, deepest first.
+		for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	for path, text := range after {
+		if old, ok := before[path]; ok && old == text {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, []byte(text)); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, stateFile), append(data, '\n'))
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) InsertCommand(c *models.Command) (int64, error) {
+	var id int64
+	err := s.update(func() (err error) {
+		id, err = s.Memory.InsertCommand(c)
+		return err
+	})
+	return id, err
+}
+
+func (s *Store) InsertCommands(cs []*models.Command) ([]int64, error) {
+	var ids []int64
+	err := s.update(func() (err error) {
+		ids, err = s.Memory.InsertCommands(cs)
+		return err
+	})
+	return ids, err
+}
+
+func (s *Store) ApplyBatch(kind string, b storage.Batch) ([]int64, error) {
+	var ids []int64
+	err := s.update(func() (err error) {
+		ids, err = s.Memory.ApplyBatch(kind, b)
+		return err
+	})
+	return ids, err
+}
+
+func (s *Store) UpdateCommand(c *models.Command) error {
+	return s.update(func() error { return s.Memory.UpdateCommand(c) })
+}
+
+func (s *Store) DeleteCommand(id int) error {
+	return s.update(func() error { return s.Memory.DeleteCommand(id) })
+}
+
+func (s *Store) DeleteCommands(ids []int) error {
+	return s.update(func() error { return s.Memory.DeleteCommands(ids) })
+}
+
+func (s *Store) IncrementUsage(id int) error {
+	return s.update(func() error { return s.Memory.IncrementUsage(id) })
+}
+
+func (s *Store) SetAliases(id int, aliases []string) error {
+	return s.update(func() error { return s.Memory.SetAliases(id, aliases) })
+}
+
+func (s *Store) SetPinned(id int, pinned bool) error {
+	return s.update(func() error { return s.Memory.SetPinned(id, pinned) })
+}
+
+func (s *Store) RestoreCommand(id int, name string) (string, error) {
+	err := s.update(func() (err error) {
+		name, err = s.Memory.RestoreCommand(id, name)
+		return err
+	})
+	return name, err
+}
+
+func (s *Store) PurgeCommand(id int) error {
+	return s.update(func() error { return s.Memory.PurgeCommand(id) })
+}
+
+func (s *Store) EmptyTrash() (int64, error) {
+	var n int64
+	err := s.update(func() (err error) {
+		n, err = s.Memory.EmptyTrash()
+		return err
+	})
+	return n, err
+}
+
+func (s *Store) PurgeTrash(retention time.Duration) (int64, error) {
+	var n int64
+	err := s.update(func() (err error) {
+		n, err = s.Memory.PurgeTrash(retention)
+		return err
+	})
+	return n, err
+}
+
+func (s *Store) RollbackCommand(commandID, versionID int) error {
+	return s.update(func() error { return s.Memory.RollbackCommand(commandID, versionID) })
+}
+
+func (s *Store) Undo() (*storage.Operation, error) {
+	var op *storage.Operation
+	err := s.update(func() (err error) {
+		op, err = s.Memory.Undo()
+		return err
+	})
+	return op, err
+}
+
+func (s *Store) Redo() (*storage.Operation, error) {
+	var op *storage.Operation
+	err := s.update(func() (err error) {
+		op, err = s.Memory.Redo()
+		return err
+	})
+	return op, err
+}
+
+func (s *Store) InsertRun(r *models.Run) error {
+	return s.update(func() error { return s.Memory.InsertRun(r) })
+}
+
+func (s *Store) InsertPlaybook(p *models.Playbook) (int64, error) {
+	var id int64
+	err := s.update(func() (err error) {
+		id, err = s.Memory.InsertPlaybook(p)
+		return err
+	})
+	return id, err
+}
+
+func (s *Store) UpdatePlaybook(p *models.Playbook) error {
+	return s.update(func() error { return s.Memory.UpdatePlaybook(p) })
+}
+
+func (s *Store) DeletePlaybook(id int) error {
+	return s.update(func() error { return s.Memory.DeletePlaybook(id) })
+}
+
+func (s *Store) InsertSchedule(sc *models.Schedule) (int64, error) {
+	var id int64
+	err := s.update(func() (err error) {
+		id, err = s.Memory.InsertSchedule(sc)
+		return err
+	})
+	return id, err
+}
+
+func (s *Store) DeleteSchedule(id int) error {
+	return s.update(func() error { return s.Memory.DeleteSchedule(id) })
+}
+
+func (s *Store) SetScheduleLastRun(id int, at time.Time) error {
+	return s.update(func() error { return s.Memory.SetScheduleLastRun(id, at) })
+}
+
+func (s *Store) SaveEnvProfile(p *models.EnvProfile) error {
+	return s.update(func() error { return s.Memory.SaveEnvProfile(p) })
+}
+
+func (s *Store) DeleteEnvProfile(id int) error {
+	return s.update(func() error { return s.Memory.DeleteEnvProfile(id) })
+}
+
+func (s *Store) SetSecretKey(salt, verifier []byte) error {
+	return s.update(func() error { return s.Memory.SetSecretKey(salt, verifier) })
+}
+
+func (s *Store) PutSecret(name string, value []byte) error {
+	return s.update(func() error { return s.Memory.PutSecret(name, value) })
+}
+
+func (s *Store) DeleteSecret(name string) error {
+	return s.update(func() error { return s.Memory.DeleteSecret(name) })
+}
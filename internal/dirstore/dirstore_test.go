@@ -0,0 +1,19 @@
+package dirstore_test
+
+import (
+	"testing"
+
+	"github.com/kanekitakitos/cmd-vault/internal/dirstore"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/kanekitakitos/cmd-vault/internal/storage/storagetest"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := dirstore.Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
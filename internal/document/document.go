@@ -0,0 +1,233 @@
+// Package document converts commands to and from a plain-text form that can
+// be edited by hand: a small front-matter header followed by the command body.
+// The env field may be repeated, once per environment variable.
+//
+//	---
+//	name: deploy
+//	note: Deploy the current branch
+//	interpreter: bash
+//	tags: ci, release
+//	env: TARGET=production
+//	---
+//	git pull
+//	make deploy
+package document
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/kanekitakitos/cmd-vault/internal/diff"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+)
+
+const delimiter = "---"
+
+// Ext is the extension of document files.
+const Ext = ".txt"
+
+// Encode renders c as a front-matter document. c is written in its
+// normalized form (see models.Command.Normalize), which is what Decode reads
+// back, so two commands that save the same have the same document.
+func Encode(c *models.Command) string {
+	n := *c
+	n.Normalize()
+	c = &n
+	var b strings.Builder
+	b.WriteString(delimiter + "\n")
+	fmt.Fprintf(&b, "name: %s\n", c.Name)
+	fmt.Fprintf(&b, "note: %s\n", c.Note)
+	fmt.Fprintf(&b, "interpreter: %s\n", c.Interpreter)
+	fmt.Fprintf(&b, "tags: %s\n", strings.Join(c.Tags, ", "))
+	for _, kv := range c.Env {
+		fmt.Fprintf(&b, "env: %s\n", kv)
+	}
+	b.WriteString(delimiter + "\n")
+	b.WriteString(c.CommandStr)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ParseError reports a problem on a specific line of a document.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+	return e.Msg
+}
+
+// Decode parses a document produced by Encode and validates the result.
+// Only the fields present in the document are set on the returned command.
+func Decode(text string) (*models.Command, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start == len(lines) {
+		return nil, &ParseError{Msg: "document is empty"}
+	}
+	if strings.TrimSpace(lines[start]) != delimiter {
+		return nil, &ParseError{Line: start + 1, Msg: "document must start with " + delimiter}
+	}
+
+	c := &models.Command{}
+	seen := map[string]bool{}
+	end := -1
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == delimiter {
+			end = i
+			break
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, &ParseError{Line: i + 1, Msg: fmt.Sprintf("expected \"key: value\", got %q", line)}
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if seen[key] && key != "env" {
+			return nil, &ParseError{Line: i + 1, Msg: fmt.Sprintf("duplicate field %q", key)}
+		}
+		seen[key] = true
+		switch key {
+		case "name":
+			c.Name = value
+		case "note":
+			c.Note = value
+		case "interpreter":
+			c.Interpreter = strings.ToLower(value)
+		case "tags":
+			c.Tags = models.ParseTags(value)
+		case "env":
+			if value == "" {
+				continue
+			}
+			if err := models.ValidateEnvVar(value); err != nil {
+				return nil, &ParseError{Line: i + 1, Msg: err.Error()}
+			}
+			c.Env = models.SetEnv(c.Env, value)
+		default:
+			return nil, &ParseError{Line: i + 1, Msg: fmt.Sprintf("unknown field %q", key)}
+		}
+	}
+	if end < 0 {
+		return nil, &ParseError{Msg: "missing closing " + delimiter}
+	}
+	c.CommandStr = strings.TrimSpace(strings.Join(lines[end+1:], "\n"))
+
+	if err := Validate(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DecodeAll parses a file holding several documents one after the other.
+// Each document ends where the next one's opening --- line starts, so a
+// command body in such a file can't contain a line that is just ---.
+func DecodeAll(text string) ([]*models.Command, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var starts []int
+	inHeader := false
+	for i, line := range lines {
+		if strings.TrimSpace(line) != delimiter {
+			continue
+		}
+		if !inHeader {
+			starts = append(starts, i)
+		}
+		inHeader = !inHeader
+	}
+	if len(starts) == 0 {
+		return nil, &ParseError{Line: 1, Msg: "no command found; each one must start with " + delimiter}
+	}
+	for i, line := range lines[:starts[0]] {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return nil, &ParseError{Line: i + 1, Msg: "document must start with " + delimiter}
+		}
+	}
+	var out []*models.Command
+	seen := map[string]int{}
+	for n, start := range starts {
+		end := len(lines)
+		if n+1 < len(starts) {
+			end = starts[n+1]
+		}
+		c, err := Decode(strings.Join(lines[start:end], "\n"))
+		if err != nil {
+			var pe *ParseError
+			if errors.As(err, &pe) {
+				line := start + 1
+				if pe.Line > 0 {
+					line = start + pe.Line
+				}
+				return nil, &ParseError{Line: line, Msg: pe.Msg}
+			}
+			return nil, err
+		}
+		if first, ok := seen[c.Name]; ok {
+			return nil, &ParseError{Line: start + 1, Msg: fmt.Sprintf("command %q is already defined on line %d", c.Name, first)}
+		}
+		seen[c.Name] = start + 1
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Validate checks the fields every saved command needs.
+func Validate(c *models.Command) error {
+	if c.Name == "" {
+		return &ParseError{Msg: "name is required"}
+	}
+	if c.Note == "" {
+		return &ParseError{Msg: "note is required"}
+	}
+	if strings.ContainsAny(c.Note, "\r\n") {
+		return &ParseError{Msg: "note must fit on one line"}
+	}
+	if _, err := runner.Lookup(c.Interpreter); err != nil {
+		return &ParseError{Msg: err.Error()}
+	}
+	return nil
+}
+
+// Diff renders the line differences between the documents of two commands.
+// A nil from is treated as an empty document.
+func Diff(from, to *models.Command) string {
+	previous := ""
+	if from != nil {
+		previous = Encode(from)
+	}
+	return diff.Format(diff.Lines(previous, Encode(to)))
+}
+
+// FileName is the relative path of the document file of the named command.
+// Slashes in the name become directories; anything a file name can't hold
+// is escaped, so that no two names share a file.
+func FileName(name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		switch p {
+		case "":
+			p = "%"
+		case ".", "..":
+			p = strings.ReplaceAll(p, ".", "%2E")
+		default:
+			p = url.PathEscape(p)
+		}
+		parts[i] = p
+	}
+	return filepath.Join(parts...) + Ext
+}
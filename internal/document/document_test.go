@@ -0,0 +1,158 @@
+package document
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []*models.Command{
+		{Name: "build", CommandStr: "make", Note: "Build it"},
+		{Name: "k8s/logs", CommandStr: "kubectl logs -f {{pod}}\nkubectl get pods", Note: "Tail  the logs", Interpreter: "bash", Tags: []string{"k8s", "ops"}, Env: []string{"KUBECONFIG=~/.kube/dev", "A=b=c"}},
+		{Name: "ps", CommandStr: "Get-Process | Sort-Object CPU", Note: "Top processes: by CPU", Interpreter: "pwsh"},
+		{Name: "dashes", CommandStr: "echo ---\necho done", Note: "Body with a --- line"},
+	} {
+		got, err := Decode(Encode(c))
+		if err != nil {
+			t.Errorf("%s: %v\n%s", c.Name, err, Encode(c))
+			continue
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Errorf("%s read back as %+v, want %+v", c.Name, *got, *c)
+		}
+	}
+}
+
+func TestEncodeNormalizes(t *testing.T) {
+	c := &models.Command{Name: "greet", CommandStr: "\n  echo hi\r\n", Note: "two\nlines ", Interpreter: "SH", Tags: []string{"a", " a"}}
+	want := "---\nname: greet\nnote: two lines\ninterpreter: sh\ntags: a\n---\necho hi\n"
+	if got := Encode(c); got != want {
+		t.Errorf("Encode = %q, want %q", got, want)
+	}
+	if c.CommandStr != "\n  echo hi\r\n" {
+		t.Error("Encode changed the command it was given")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	text := "\n---\n# a comment\nName: deploy\nnote:  Deploy it \n\ninterpreter: BASH\ntags: ci, release, ci\nenv: A=1\nenv: B=2\nenv: A=3\nenv:\n---\n\ngit pull\r\nmake deploy\n\n"
+	got, err := Decode(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &models.Command{
+		Name:        "deploy",
+		CommandStr:  "git pull\nmake deploy",
+		Note:        "Deploy it",
+		Interpreter: "bash",
+		Tags:        []string{"ci", "release"},
+		Env:         []string{"B=2", "A=3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %+v, want %+v", *got, *want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+		msg  string
+	}{
+		{"", 0, "document is empty"},
+		{"\n \n", 0, "document is empty"},
+		{"name: x\n---\n", 1, "must start with ---"},
+		{"---\nname: x\nnote: y\n", 0, "missing closing ---"},
+		{"---\nname x\n---\n", 2, `expected "key: value"`},
+		{"---\nname: x\nname: y\n---\n", 3, `duplicate field "name"`},
+		{"---\nname: x\ncolor: red\n---\n", 3, `unknown field "color"`},
+		{"---\nname: x\nnote: y\nenv: 1A=b\n---\n", 4, "1A"},
+		{"---\nnote: y\n---\necho", 0, "name is required"},
+		{"---\nname: x\n---\necho", 0, "note is required"},
+		{"---\nname: x\nnote: y\ninterpreter: cobol\n---\necho", 0, "cobol"},
+	}
+	for _, tt := range tests {
+		_, err := Decode(tt.text)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("Decode(%q) = %v, want a ParseError", tt.text, err)
+			continue
+		}
+		if pe.Line != tt.line || !strings.Contains(pe.Msg, tt.msg) {
+			t.Errorf("Decode(%q): line %d %q, want line %d %q", tt.text, pe.Line, pe.Msg, tt.line, tt.msg)
+		}
+	}
+}
+
+func TestValidateMultiLineNote(t *testing.T) {
+	if err := Validate(&models.Command{Name: "x", Note: "one\ntwo"}); err == nil {
+		t.Error("Validate accepted a note on two lines")
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	text := "# project commands\n\n---\nname: test\nnote: Run the tests\n---\ngo test ./...\n\n---\nname: lint\nnote: Lint\n---\ngo vet ./...\n"
+	got, err := DecodeAll(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "test" || got[0].CommandStr != "go test ./..." || got[1].Name != "lint" || got[1].CommandStr != "go vet ./..." {
+		t.Errorf("DecodeAll = %+v", got)
+	}
+
+	tests := []struct {
+		text string
+		line int
+		msg  string
+	}{
+		{"", 1, "no command found"},
+		{"just text\n", 1, "no command found"},
+		{"stray\n---\nname: a\nnote: b\n---\necho\n", 1, "must start with ---"},
+		{"---\nname: a\nnote: b\n---\necho\n---\nname: a\nnote: c\n---\necho\n", 6, `"a" is already defined on line 1`},
+		{"---\nname: a\nnote: b\n---\necho\n\n---\nname: b\nbad\n---\n", 9, `expected "key: value"`},
+		{"---\nname: a\nnote: b\n---\necho\n---\nnote: c\n---\necho\n", 6, "name is required"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeAll(tt.text)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("DecodeAll(%q) = %v, want a ParseError", tt.text, err)
+			continue
+		}
+		if pe.Line != tt.line || !strings.Contains(pe.Msg, tt.msg) {
+			t.Errorf("DecodeAll(%q): line %d %q, want line %d %q", tt.text, pe.Line, pe.Msg, tt.line, tt.msg)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"deploy", "deploy.txt"},
+		{"k8s/logs/tail", filepath.Join("k8s", "logs", "tail.txt")},
+		{"a b", "a%20b.txt"},
+		{"50%", "50%25.txt"},
+		{"what?", "what%3F.txt"},
+		{"..", "%2E%2E.txt"},
+		{"a/./b", filepath.Join("a", "%2E", "b.txt")},
+		{"/lead", filepath.Join("%", "lead.txt")},
+		{"a//b", filepath.Join("a", "%", "b.txt")},
+	}
+	seen := map[string]string{}
+	for _, tt := range tests {
+		got := FileName(tt.name)
+		if got != tt.want {
+			t.Errorf("FileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("%q and %q share the file %s", tt.name, other, got)
+		}
+		seen[got] = tt.name
+	}
+}
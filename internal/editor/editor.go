@@ -0,0 +1,68 @@
+package editor
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Command builds the process that opens path in the user's editor,
+// taken from $VISUAL, then $EDITOR, then a platform fallback. Variables
+// that are empty or only blanks are skipped.
+func Command(path string) *exec.Cmd {
+	// Allow values such as "code --wait".
+	parts := strings.Fields(os.Getenv("VISUAL"))
+	if len(parts) == 0 {
+		parts = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(parts) == 0 {
+		parts = []string{fallback()}
+	}
+	args := append(parts[1:], path)
+	cmd := exec.Command(parts[0], args...) // #nosec G204
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// fallback is the editor of the platform, used when none is set.
+func fallback() string {
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// WriteTemp stores content in a new temporary file with the given extension
+// and returns its path. The caller removes the file when done.
+func WriteTemp(content, ext string) (string, error) {
+	f, err := os.CreateTemp("", "cmd-vault-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Edit opens path in the editor, attached to the current terminal, and
+// returns the file contents once the editor exits.
+func Edit(path string) (string, error) {
+	if err := Command(path).Run(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,42 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		visual, editor string
+		want           []string
+	}{
+		{"", "", []string{fallback(), "f.txt"}},
+		{"   ", "\t", []string{fallback(), "f.txt"}},
+		{"  ", "nano", []string{"nano", "f.txt"}},
+		{"code --wait", "nano", []string{"code", "--wait", "f.txt"}},
+		{"", " hx ", []string{"hx", "f.txt"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("VISUAL", tt.visual)
+		t.Setenv("EDITOR", tt.editor)
+		if got := Command("f.txt").Args; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("VISUAL=%q EDITOR=%q: runs %q, want %q", tt.visual, tt.editor, got, tt.want)
+		}
+	}
+}
+
+func TestWriteTemp(t *testing.T) {
+	path, err := WriteTemp("---\nname: x\n", ".txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	if filepath.Ext(path) != ".txt" {
+		t.Errorf("temporary file %s lacks the extension", path)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "---\nname: x\n" {
+		t.Errorf("temporary file holds %q, %v", data, err)
+	}
+}
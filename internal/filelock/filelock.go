@@ -0,0 +1,36 @@
+// Package filelock provides an exclusive lock on a file shared between
+// processes, so that several cmd-vault processes (the TUI, the CLI and the
+// daemon) can take turns changing a vault that lives in memory while it is
+// open.
+package filelock
+
+import "os"
+
+// Lock is a held lock. The lock file itself stays in place so that the
+// next process locks the same file.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire blocks until it holds the lock on path, creating the file if
+// needed.
+func Acquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release gives the lock up.
+func (l *Lock) Release() error {
+	err := unlock(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
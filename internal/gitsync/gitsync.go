@@ -0,0 +1,293 @@
+// Package gitsync shares the commands of a vault between machines through a
+// git repository. Each command is stored as a document under commands/,
+// as in a directory vault. A sync merges the local commands with those on
+// the remote, using the last synced commit of a private working clone as
+// the common base, then pushes the result.
+package gitsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+const commandsDir = "commands"
+
+// DefaultBranch is the branch synced when none is configured.
+const DefaultBranch = "main"
+
+// Repo is the working clone used to sync one vault.
+type Repo struct {
+	Dir    string
+	Remote string
+	Branch string
+}
+
+// Open prepares the working clone in dir, cloning remote the first time.
+func Open(dir, remote, branch string) (*Repo, error) {
+	if remote == "" {
+		return nil, errors.New("no sync remote configured")
+	}
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	r := &Repo{Dir: dir, Remote: remote, Branch: branch}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		// Follow the remote when it was changed in the config.
+		_, err := r.git("remote", "set-url", "origin", remote)
+		return r, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if _, err := r.git("clone", "-q", remote, "."); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// git runs a git command in the working clone and returns its output.
+func (r *Repo) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+// remoteRef names the synced branch as last fetched from the remote.
+func (r *Repo) remoteRef() string {
+	return "refs/remotes/origin/" + r.Branch
+}
+
+// revision returns the commit rev points at, or "" when it doesn't exist.
+func (r *Repo) revision(rev string) string {
+	out, err := r.git("rev-parse", "-q", "--verify", rev+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// Fetch updates the remote branch from the remote.
+func (r *Repo) Fetch() error {
+	_, err := r.git("fetch", "-q", "--prune", "origin")
+	return err
+}
+
+// Base returns the commands as of the last sync.
+func (r *Repo) Base() (map[string]*models.Command, error) {
+	return r.commands("HEAD")
+}
+
+// RemoteCommands returns the commands on the remote branch as last fetched.
+func (r *Repo) RemoteCommands() (map[string]*models.Command, error) {
+	return r.commands(r.remoteRef())
+}
+
+// commands reads the command documents of a revision, keyed by name. A
+// revision that doesn't exist has no commands.
+func (r *Repo) commands(rev string) (map[string]*models.Command, error) {
+	out := map[string]*models.Command{}
+	if r.revision(rev) == "" {
+		return out, nil
+	}
+	list, err := r.git("ls-tree", "-r", "-z", "--name-only", rev, "--", commandsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(list, "\x00") {
+		if !strings.HasSuffix(path, document.Ext) {
+			continue
+		}
+		text, err := r.git("show", rev+":"+path)
+		if err != nil {
+			return nil, err
+		}
+		c, err := document.Decode(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s in the sync repository: %w", path, err)
+		}
+		out[c.Name] = c
+	}
+	return out, nil
+}
+
+// Push commits commands on top of the remote branch and pushes them. When
+// the push fails, for instance because another machine pushed first, the
+// working clone is put back so that the next sync merges again from the
+// same base.
+func (r *Repo) Push(commands map[string]*models.Command, message string) error {
+	previous := r.revision("HEAD")
+	if remote := r.revision(r.remoteRef()); remote != "" {
+		if _, err := r.git("checkout", "-q", "-f", "-B", r.Branch, remote); err != nil {
+			return err
+		}
+	} else if previous == "" {
+		if _, err := r.git("symbolic-ref", "HEAD", "refs/heads/"+r.Branch); err != nil {
+			return err
+		}
+	}
+	if err := r.writeCommands(commands); err != nil {
+		return err
+	}
+	if _, err := r.git("add", "-A", "--", commandsDir); err != nil {
+		return err
+	}
+	status, err := r.git("status", "--porcelain", "--", commandsDir)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(status) == "" {
+		return nil
+	}
+	if _, err := r.git(append(r.identity(), "commit", "-q", "-m", message)...); err != nil {
+		return err
+	}
+	if _, err := r.git("push", "-q", "origin", "HEAD:refs/heads/"+r.Branch); err != nil {
+		r.reset(previous)
+		return err
+	}
+	return nil
+}
+
+// reset moves the working clone back to commit, or to no commit at all.
+func (r *Repo) reset(commit string) {
+	if commit != "" {
+		_, _ = r.git("checkout", "-q", "-f", "-B", r.Branch, commit)
+		return
+	}
+	_, _ = r.git("update-ref", "-d", "refs/heads/"+r.Branch)
+}
+
+// writeCommands replaces the command documents in the working tree. The
+// directory is kept even when there are none, since git refuses to add a
+// path that matches nothing.
+func (r *Repo) writeCommands(commands map[string]*models.Command) error {
+	root := filepath.Join(r.Dir, commandsDir)
+	if err := os.RemoveAll(root); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return err
+	}
+	for _, c := range commands {
+		path := filepath.Join(root, document.FileName(c.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(document.Encode(c)), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// identity supplies a committer when git has none configured, so that a
+// sync works on a fresh machine.
+func (r *Repo) identity() []string {
+	if out, err := r.git("config", "user.email"); err == nil && strings.TrimSpace(out) != "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	return []string{"-c", "user.name=cmd-vault", "-c", "user.email=cmd-vault@" + host}
+}
+
+// Changes counts what Apply did to the local vault.
+type Changes struct {
+	Added, Updated, Deleted int
+}
+
+// Apply makes the commands of store match result. Deleted commands go to
+// the trash, and the whole sync is a single operation that one undo
+// reverts.
+func Apply(store storage.CommandStore, result map[string]*models.Command) (Changes, error) {
+	local, err := store.GetAllCommands()
+	if err != nil {
+		return Changes{}, err
+	}
+	var b storage.Batch
+	existing := map[string]bool{}
+	for i := range local {
+		c := &local[i]
+		existing[c.Name] = true
+		want, ok := result[c.Name]
+		if !ok {
+			b.Delete = append(b.Delete, c.ID)
+			continue
+		}
+		if same(c, want) {
+			continue
+		}
+		c.CommandStr, c.Note, c.Interpreter, c.Tags, c.Env = want.CommandStr, want.Note, want.Interpreter, want.Tags, want.Env
+		b.Update = append(b.Update, c)
+	}
+	for _, name := range slices.Sorted(maps.Keys(result)) {
+		if existing[name] {
+			continue
+		}
+		c := *result[name]
+		c.CreatedAt = time.Now()
+		b.Insert = append(b.Insert, &c)
+	}
+	if _, err := store.ApplyBatch("sync", b); err != nil {
+		return Changes{}, err
+	}
+	return Changes{Added: len(b.Insert), Updated: len(b.Update), Deleted: len(b.Delete)}, nil
+}
+
+// Diff counts what Apply would change to make the local commands match
+// result.
+func Diff(local, result map[string]*models.Command) Changes {
+	var ch Changes
+	for name, c := range local {
+		want, ok := result[name]
+		switch {
+		case !ok:
+			ch.Deleted++
+		case !same(c, want):
+			ch.Updated++
+		}
+	}
+	for name := range result {
+		if _, ok := local[name]; !ok {
+			ch.Added++
+		}
+	}
+	return ch
+}
+
+// Local returns the live commands of store keyed by name, in the form they
+// are synced.
+func Local(store storage.CommandStore) (map[string]*models.Command, error) {
+	commands, err := store.GetAllCommands()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]*models.Command{}
+	for i := range commands {
+		out[commands[i].Name] = &commands[i]
+	}
+	return out, nil
+}
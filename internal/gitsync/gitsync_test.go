@@ -0,0 +1,294 @@
+package gitsync
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// newRemote creates an empty bare repository to sync with.
+func newRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	return remote
+}
+
+// machine is one vault syncing with the remote through its own clone.
+type machine struct {
+	t     *testing.T
+	store *storage.Memory
+	repo  *Repo
+}
+
+func newMachine(t *testing.T, remote string) *machine {
+	t.Helper()
+	repo, err := Open(filepath.Join(t.TempDir(), "clone"), remote, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &machine{t: t, store: storage.NewMemory(), repo: repo}
+}
+
+// merge fetches and merges like 'cmd-vault sync' does, without pushing.
+func (m *machine) merge() *Merge {
+	m.t.Helper()
+	if err := m.repo.Fetch(); err != nil {
+		m.t.Fatal(err)
+	}
+	base, err := m.repo.Base()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	theirs, err := m.repo.RemoteCommands()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	ours, err := Local(m.store)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return ThreeWay(base, ours, theirs)
+}
+
+// sync merges, applies the result and pushes it, taking choice for every
+// conflict.
+func (m *machine) sync(choice Choice) Changes {
+	m.t.Helper()
+	merge := m.merge()
+	for _, c := range merge.Conflicts {
+		c.Choice = choice
+	}
+	ch, err := Apply(m.store, merge.Result())
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	if err := m.repo.Push(merge.Result(), "test sync"); err != nil {
+		m.t.Fatal(err)
+	}
+	return ch
+}
+
+func (m *machine) add(name, body string) {
+	m.t.Helper()
+	if _, err := m.store.InsertCommand(&models.Command{Name: name, CommandStr: body, Note: name}); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *machine) edit(name, body string) {
+	m.t.Helper()
+	c, err := m.store.GetByName(name)
+	if err != nil || c == nil {
+		m.t.Fatalf("no command %s: %v", name, err)
+	}
+	c.CommandStr = body
+	if err := m.store.UpdateCommand(c); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *machine) remove(name string) {
+	m.t.Helper()
+	c, err := m.store.GetByName(name)
+	if err != nil || c == nil {
+		m.t.Fatalf("no command %s: %v", name, err)
+	}
+	if err := m.store.DeleteCommands([]int{c.ID}); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// bodies returns the command bodies of the vault by name.
+func (m *machine) bodies() map[string]string {
+	m.t.Helper()
+	list, err := m.store.GetAllCommands()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	out := map[string]string{}
+	for _, c := range list {
+		out[c.Name] = c.CommandStr
+	}
+	return out
+}
+
+func (m *machine) want(want map[string]string) {
+	m.t.Helper()
+	got := m.bodies()
+	if len(got) != len(want) {
+		m.t.Fatalf("commands %v, want %v", got, want)
+	}
+	for name, body := range want {
+		if got[name] != body {
+			m.t.Fatalf("commands %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSyncBetweenMachines(t *testing.T) {
+	remote := newRemote(t)
+	a, b := newMachine(t, remote), newMachine(t, remote)
+
+	a.add("build", "make")
+	a.add("k8s/logs", "kubectl logs -f")
+	if ch := a.sync(Unresolved); ch != (Changes{}) {
+		t.Errorf("first sync changed the vault it came from: %+v", ch)
+	}
+
+	if ch := b.sync(Unresolved); ch != (Changes{Added: 2}) {
+		t.Errorf("second machine got %+v, want 2 added", ch)
+	}
+	b.want(map[string]string{"build": "make", "k8s/logs": "kubectl logs -f"})
+
+	b.edit("build", "make all")
+	b.remove("k8s/logs")
+	b.add("test", "go test ./...")
+	b.sync(Unresolved)
+
+	if ch := a.sync(Unresolved); ch != (Changes{Added: 1, Updated: 1, Deleted: 1}) {
+		t.Errorf("first machine got %+v, want 1 added, 1 updated, 1 deleted", ch)
+	}
+	a.want(map[string]string{"build": "make all", "test": "go test ./..."})
+	if trashed, _ := a.store.TrashedCommands(); len(trashed) != 1 || trashed[0].Name != "k8s/logs" {
+		t.Errorf("the command deleted by the sync is not in the trash: %v", trashed)
+	}
+
+	// One undo takes back the whole sync.
+	op, err := a.store.Undo()
+	if err != nil || op.Kind != "sync" {
+		t.Fatalf("Undo = %+v, %v", op, err)
+	}
+	a.want(map[string]string{"build": "make", "k8s/logs": "kubectl logs -f"})
+}
+
+func TestApplyChangesNothingOnError(t *testing.T) {
+	store := storage.NewMemory()
+	for _, name := range []string{"build", "old"} {
+		if _, err := store.InsertCommand(&models.Command{Name: name, CommandStr: "make", Note: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build, _ := store.GetByName("build")
+	if err := store.SetAliases(build.ID, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	// "b" can't be added while it is an alias of build.
+	result := map[string]*models.Command{
+		"build": {Name: "build", CommandStr: "make all", Note: "build"},
+		"b":     {Name: "b", CommandStr: "echo b", Note: "b"},
+	}
+	if _, err := Apply(store, result); err == nil {
+		t.Fatal("Apply added a command named like an alias")
+	}
+	m := &machine{t: t, store: store}
+	m.want(map[string]string{"build": "make", "old": "make"})
+	if ops, _ := store.Operations(); len(ops) != 2 {
+		t.Errorf("%d operations, want the 2 adds", len(ops))
+	}
+}
+
+func TestSyncMergesEditsOfBothMachines(t *testing.T) {
+	remote := newRemote(t)
+	a, b := newMachine(t, remote), newMachine(t, remote)
+	a.add("build", "make")
+	a.add("test", "go test")
+	a.sync(Unresolved)
+	b.sync(Unresolved)
+
+	a.edit("build", "make all")
+	a.sync(Unresolved)
+	b.edit("test", "go test ./...")
+	b.sync(Unresolved)
+	a.sync(Unresolved)
+
+	want := map[string]string{"build": "make all", "test": "go test ./..."}
+	a.want(want)
+	b.want(want)
+}
+
+func TestSyncConflicts(t *testing.T) {
+	remote := newRemote(t)
+	a, b := newMachine(t, remote), newMachine(t, remote)
+	a.add("build", "make")
+	a.add("deploy", "make deploy")
+	a.sync(Unresolved)
+	b.sync(Unresolved)
+
+	a.edit("build", "make all")
+	a.edit("deploy", "make ship")
+	a.sync(Unresolved)
+	b.edit("build", "go build")
+	b.remove("deploy")
+
+	merge := b.merge()
+	if len(merge.Conflicts) != 2 {
+		t.Fatalf("got %d conflicts, want 2", len(merge.Conflicts))
+	}
+	build, deploy := merge.Conflicts[0], merge.Conflicts[1]
+	if build.Name != "build" || len(build.Fields) != 1 || build.Fields[0] != "command" {
+		t.Errorf("edit/edit conflict %+v", build)
+	}
+	if deploy.Name != "deploy" || deploy.Local != nil || deploy.Remote == nil {
+		t.Errorf("delete/edit conflict %+v", deploy)
+	}
+
+	b.sync(KeepRemote)
+	want := map[string]string{"build": "make all", "deploy": "make ship"}
+	b.want(want)
+	a.sync(Unresolved)
+	a.want(want)
+}
+
+func TestSyncKeepsLocalDeletion(t *testing.T) {
+	remote := newRemote(t)
+	a, b := newMachine(t, remote), newMachine(t, remote)
+	a.add("deploy", "make deploy")
+	a.sync(Unresolved)
+	b.sync(Unresolved)
+
+	a.edit("deploy", "make ship")
+	a.sync(Unresolved)
+	b.remove("deploy")
+	b.sync(KeepLocal)
+	b.want(map[string]string{})
+
+	a.sync(Unresolved)
+	a.want(map[string]string{})
+}
+
+func TestPushRejected(t *testing.T) {
+	remote := newRemote(t)
+	a, b := newMachine(t, remote), newMachine(t, remote)
+	a.add("build", "make")
+	a.sync(Unresolved)
+	b.sync(Unresolved)
+
+	// a merges before b pushes, so its push is based on a stale remote.
+	a.edit("build", "make all")
+	merge := a.merge()
+	b.add("test", "go test")
+	b.sync(Unresolved)
+	before := a.repo.revision("HEAD")
+	if err := a.repo.Push(merge.Result(), "stale"); err == nil {
+		t.Fatal("push on top of a stale remote succeeded")
+	}
+	if after := a.repo.revision("HEAD"); after != before {
+		t.Errorf("failed push left the clone at %s, want %s", after, before)
+	}
+
+	// The next sync merges again from the same base.
+	a.sync(Unresolved)
+	want := map[string]string{"build": "make all", "test": "go test"}
+	a.want(want)
+	b.sync(Unresolved)
+	b.want(want)
+}
@@ -0,0 +1,171 @@
+package gitsync
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// Choice says which side of a conflict wins.
+type Choice int
+
+const (
+	Unresolved Choice = iota
+	KeepLocal
+	KeepRemote
+)
+
+// Conflict is a command changed differently on both sides since the last
+// sync. Local or Remote is nil when that side deleted the command.
+type Conflict struct {
+	Name   string
+	Base   *models.Command
+	Local  *models.Command
+	Remote *models.Command
+	Fields []string // fields changed on both sides, empty for edit/delete conflicts
+	Choice Choice
+}
+
+// Winner returns the version of the command chosen for c.
+func (c *Conflict) Winner() *models.Command {
+	if c.Choice == KeepRemote {
+		return c.Remote
+	}
+	return c.Local
+}
+
+// Merge is the result of merging the local commands with the remote ones.
+type Merge struct {
+	// Commands holds the merged commands by name, except those in conflict.
+	Commands  map[string]*models.Command
+	Conflicts []*Conflict
+}
+
+// Resolved reports whether every conflict has a choice.
+func (m *Merge) Resolved() bool {
+	for _, c := range m.Conflicts {
+		if c.Choice == Unresolved {
+			return false
+		}
+	}
+	return true
+}
+
+// Result returns the merged commands with the chosen side of each conflict.
+func (m *Merge) Result() map[string]*models.Command {
+	out := map[string]*models.Command{}
+	for name, c := range m.Commands {
+		out[name] = c
+	}
+	for _, c := range m.Conflicts {
+		if w := c.Winner(); w != nil {
+			out[c.Name] = w
+		}
+	}
+	return out
+}
+
+// ThreeWay merges the local and remote commands, both changed from base.
+// A command changed on one side only takes that change. A command edited on
+// both sides is merged field by field; it is a conflict when the same field
+// changed differently, or when one side deleted a command the other edited.
+func ThreeWay(base, local, remote map[string]*models.Command) *Merge {
+	m := &Merge{Commands: map[string]*models.Command{}}
+	names := map[string]bool{}
+	for _, set := range []map[string]*models.Command{base, local, remote} {
+		for name := range set {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		b, l, r := base[name], local[name], remote[name]
+		var merged *models.Command
+		switch {
+		case same(l, r):
+			merged = l
+		case same(l, b):
+			merged = r
+		case same(r, b):
+			merged = l
+		case l != nil && r != nil:
+			var conflicts []string
+			merged, conflicts = mergeFields(b, l, r)
+			if len(conflicts) > 0 {
+				m.Conflicts = append(m.Conflicts, &Conflict{Name: name, Base: b, Local: l, Remote: r, Fields: conflicts})
+				continue
+			}
+		default:
+			m.Conflicts = append(m.Conflicts, &Conflict{Name: name, Base: b, Local: l, Remote: r})
+			continue
+		}
+		if merged != nil {
+			m.Commands[name] = merged
+		}
+	}
+	sort.Slice(m.Conflicts, func(i, j int) bool { return m.Conflicts[i].Name < m.Conflicts[j].Name })
+	return m
+}
+
+// same reports whether a and b have the same document, and so the same
+// normalized form, nil being a command that doesn't exist.
+func same(a, b *models.Command) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return document.Encode(a) == document.Encode(b)
+}
+
+// field reads and writes one editable field of a command as text.
+type field struct {
+	name string
+	get  func(c *models.Command) string
+	set  func(c *models.Command, v string)
+}
+
+var fields = []field{
+	{"note", func(c *models.Command) string { return c.Note }, func(c *models.Command, v string) { c.Note = v }},
+	{"interpreter", func(c *models.Command) string { return c.Interpreter }, func(c *models.Command, v string) { c.Interpreter = v }},
+	{"tags", func(c *models.Command) string { return strings.Join(c.Tags, ",") }, func(c *models.Command, v string) { c.Tags = models.ParseTags(v) }},
+	{"env", func(c *models.Command) string { return strings.Join(c.Env, "\n") }, func(c *models.Command, v string) { c.Env = splitLines(v) }},
+	{"command", func(c *models.Command) string { return c.CommandStr }, func(c *models.Command, v string) { c.CommandStr = v }},
+}
+
+// normalized returns a normalized copy of c, or an empty command for nil.
+func normalized(c *models.Command) *models.Command {
+	n := models.Command{}
+	if c != nil {
+		n = *c
+	}
+	n.Normalize()
+	return &n
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// mergeFields merges l and r field by field against b, which may be nil.
+// The fields are compared as their documents hold them, so that a command
+// saved before normalization doesn't look edited. It returns the merged
+// command and the fields that changed on both sides.
+func mergeFields(b, l, r *models.Command) (*models.Command, []string) {
+	b, l, r = normalized(b), normalized(l), normalized(r)
+	merged := *l
+	var conflicts []string
+	for _, f := range fields {
+		bv, lv, rv := f.get(b), f.get(l), f.get(r)
+		switch {
+		case lv == rv, rv == bv:
+		case lv == bv:
+			f.set(&merged, rv)
+		default:
+			conflicts = append(conflicts, f.name)
+		}
+	}
+	return &merged, conflicts
+}
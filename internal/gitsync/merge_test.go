@@ -0,0 +1,194 @@
+package gitsync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+func command(name, body, note string) *models.Command {
+	return &models.Command{Name: name, CommandStr: body, Note: note}
+}
+
+func commands(list ...*models.Command) map[string]*models.Command {
+	out := map[string]*models.Command{}
+	for _, c := range list {
+		out[c.Name] = c
+	}
+	return out
+}
+
+func TestThreeWay(t *testing.T) {
+	base := command("deploy", "make deploy", "Deploy")
+	tests := []struct {
+		name          string
+		base          map[string]*models.Command
+		local, remote map[string]*models.Command
+		want          map[string]*models.Command
+		conflicts     []string // names in conflict
+		fields        []string // fields in conflict of the first conflict
+	}{
+		{
+			name:   "unchanged",
+			base:   commands(base),
+			local:  commands(base),
+			remote: commands(base),
+			want:   commands(base),
+		},
+		{
+			name:   "edited locally",
+			base:   commands(base),
+			local:  commands(command("deploy", "make deploy-all", "Deploy")),
+			remote: commands(base),
+			want:   commands(command("deploy", "make deploy-all", "Deploy")),
+		},
+		{
+			name:   "edited remotely",
+			base:   commands(base),
+			local:  commands(base),
+			remote: commands(command("deploy", "make deploy", "Ship it")),
+			want:   commands(command("deploy", "make deploy", "Ship it")),
+		},
+		{
+			name:   "different fields edited on both sides",
+			base:   commands(base),
+			local:  commands(command("deploy", "make deploy-all", "Deploy")),
+			remote: commands(command("deploy", "make deploy", "Ship it")),
+			want:   commands(command("deploy", "make deploy-all", "Ship it")),
+		},
+		{
+			name:      "same field edited on both sides",
+			base:      commands(base),
+			local:     commands(command("deploy", "make deploy-all", "Deploy")),
+			remote:    commands(command("deploy", "make ship", "Deploy")),
+			want:      commands(),
+			conflicts: []string{"deploy"},
+			fields:    []string{"command"},
+		},
+		{
+			name:   "unchanged locally, saved before normalization",
+			base:   commands(base),
+			local:  commands(command("deploy", "  make deploy\n", "Deploy ")),
+			remote: commands(command("deploy", "make ship", "Deploy")),
+			want:   commands(command("deploy", "make ship", "Deploy")),
+		},
+		{
+			name:   "different fields edited, saved before normalization",
+			base:   commands(base),
+			local:  commands(command("deploy", "\tmake deploy\r\n", "Ship it")),
+			remote: commands(command("deploy", "make ship", "Deploy")),
+			want:   commands(command("deploy", "make ship", "Ship it")),
+		},
+		{
+			name:   "same edit on both sides",
+			base:   commands(base),
+			local:  commands(command("deploy", "make ship", "Deploy")),
+			remote: commands(command("deploy", "make ship", "Deploy")),
+			want:   commands(command("deploy", "make ship", "Deploy")),
+		},
+		{
+			name:   "deleted locally",
+			base:   commands(base),
+			local:  commands(),
+			remote: commands(base),
+			want:   commands(),
+		},
+		{
+			name:   "deleted remotely",
+			base:   commands(base),
+			local:  commands(base),
+			remote: commands(),
+			want:   commands(),
+		},
+		{
+			name:      "deleted locally, edited remotely",
+			base:      commands(base),
+			local:     commands(),
+			remote:    commands(command("deploy", "make ship", "Deploy")),
+			want:      commands(),
+			conflicts: []string{"deploy"},
+		},
+		{
+			name:      "edited locally, deleted remotely",
+			base:      commands(base),
+			local:     commands(command("deploy", "make ship", "Deploy")),
+			remote:    commands(),
+			want:      commands(),
+			conflicts: []string{"deploy"},
+		},
+		{
+			name:   "added on each side",
+			base:   commands(),
+			local:  commands(command("build", "make", "Build")),
+			remote: commands(command("test", "make test", "Test")),
+			want:   commands(command("build", "make", "Build"), command("test", "make test", "Test")),
+		},
+		{
+			name:      "added on both sides differently",
+			base:      commands(),
+			local:     commands(command("build", "make", "Build")),
+			remote:    commands(command("build", "go build", "Build")),
+			want:      commands(),
+			conflicts: []string{"build"},
+			fields:    []string{"command"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := ThreeWay(tt.base, tt.local, tt.remote)
+			if !equal(m.Commands, tt.want) {
+				t.Errorf("merged %v, want %v", names(m.Commands), names(tt.want))
+			}
+			var conflicts []string
+			for _, c := range m.Conflicts {
+				conflicts = append(conflicts, c.Name)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Fatalf("conflicts %v, want %v", conflicts, tt.conflicts)
+			}
+			if len(tt.conflicts) > 0 && !reflect.DeepEqual(m.Conflicts[0].Fields, tt.fields) {
+				t.Errorf("conflicting fields %v, want %v", m.Conflicts[0].Fields, tt.fields)
+			}
+			if m.Resolved() != (len(tt.conflicts) == 0) {
+				t.Errorf("Resolved() = %v with %d conflicts", m.Resolved(), len(tt.conflicts))
+			}
+		})
+	}
+}
+
+func TestConflictChoice(t *testing.T) {
+	base := commands(command("deploy", "make deploy", "Deploy"))
+	local := commands()
+	remote := commands(command("deploy", "make ship", "Deploy"))
+
+	m := ThreeWay(base, local, remote)
+	m.Conflicts[0].Choice = KeepLocal
+	if got := m.Result(); len(got) != 0 {
+		t.Errorf("keeping the local deletion gave %v", names(got))
+	}
+	m.Conflicts[0].Choice = KeepRemote
+	if got := m.Result(); !equal(got, remote) {
+		t.Errorf("keeping the remote edit gave %v", names(got))
+	}
+}
+
+func equal(a, b map[string]*models.Command) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, c := range a {
+		if !same(c, b[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func names(set map[string]*models.Command) map[string]string {
+	out := map[string]string{}
+	for name, c := range set {
+		out[name] = c.CommandStr + " # " + c.Note
+	}
+	return out
+}
@@ -1,12 +1,138 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 type Command struct {
-	ID         int
-	Name       string
-	CommandStr string
-	Note       string
-	UsageCount int
-	CreatedAt  time.Time
+	ID          int
+	Name        string
+	CommandStr  string
+	Note        string
+	Interpreter string // empty means the platform default shell
+	Tags        []string
+	Env         []string // KEY=value pairs set when the command runs
+	UsageCount  int
+	CreatedAt   time.Time
+	DeletedAt   time.Time // zero unless the command is in the trash
+	PinnedAt    time.Time // zero unless the command is pinned to the top of the list
+	Project     string    // root of the project whose .cmdvault file defines the command, empty for vault commands
+	// Aliases are other names the command can be run by, sorted. Stores
+	// keep them apart from the command and fill them in on reads.
+	Aliases []string `json:"-"`
+}
+
+// CheckAlias reports why alias can't be used as an alias, if it can't.
+func CheckAlias(alias string) error {
+	switch {
+	case alias == "":
+		return errors.New("alias is empty")
+	case strings.ContainsAny(alias, ", \t\n"):
+		return fmt.Errorf("alias %q can't contain spaces or commas", alias)
+	}
+	return nil
+}
+
+// Normalize puts c in the form stores save it in, which is also the form
+// its document reads back as: the name, note and interpreter are trimmed,
+// the note is kept on one line, the body loses its surrounding blank lines
+// and \r\n line ends, and the tags and env pairs lose blanks and repeats.
+func (c *Command) Normalize() {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Note = strings.TrimSpace(c.Note)
+	if strings.ContainsAny(c.Note, "\r\n") {
+		c.Note = strings.Join(strings.Fields(c.Note), " ")
+	}
+	c.Interpreter = strings.ToLower(strings.TrimSpace(c.Interpreter))
+	c.CommandStr = strings.TrimSpace(strings.ReplaceAll(c.CommandStr, "\r\n", "\n"))
+	c.Tags = ParseTags(strings.Join(c.Tags, ","))
+	var env []string
+	for _, kv := range c.Env {
+		if kv = strings.TrimSpace(kv); kv != "" {
+			env = SetEnv(env, kv)
+		}
+	}
+	c.Env = env
+}
+
+// Pinned reports whether the command is pinned.
+func (c *Command) Pinned() bool {
+	return !c.PinnedAt.IsZero()
+}
+
+// SortPinned moves the pinned commands to the front, in the order they were
+// pinned, keeping the order of the others. It returns how many are pinned.
+func SortPinned(commands []Command) int {
+	sort.SliceStable(commands, func(i, j int) bool {
+		a, b := &commands[i], &commands[j]
+		if a.Pinned() != b.Pinned() {
+			return a.Pinned()
+		}
+		return a.Pinned() && a.PinnedAt.Before(b.PinnedAt)
+	})
+	n := 0
+	for n < len(commands) && commands[n].Pinned() {
+		n++
+	}
+	return n
+}
+
+// Folder returns the folder of a hierarchical name such as k8s/logs/tail,
+// k8s/logs here, or "" for a name without one.
+func Folder(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// BaseName returns the last element of a hierarchical name.
+func BaseName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// CleanFolder trims the slashes around a folder and drops empty elements,
+// so that "/k8s//logs/" becomes "k8s/logs".
+func CleanFolder(folder string) string {
+	var parts []string
+	for _, p := range strings.Split(folder, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// InFolder reports whether name is in folder or one of its subfolders.
+// Every name is in the root folder "".
+func InFolder(name, folder string) bool {
+	folder = CleanFolder(folder)
+	return folder == "" || strings.HasPrefix(name, folder+"/")
+}
+
+// MoveToFolder returns name with its folder replaced by folder.
+func MoveToFolder(name, folder string) string {
+	if folder = CleanFolder(folder); folder == "" {
+		return BaseName(name)
+	}
+	return folder + "/" + BaseName(name)
+}
+
+// ParseTags splits a comma separated tag list, dropping blanks and duplicates.
+func ParseTags(s string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	return tags
 }
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EnvProfile is a named set of environment variables, such as the
+// credentials of one cloud account, that can be applied to any run.
+type EnvProfile struct {
+	ID        int
+	Name      string
+	Vars      []string // KEY=value pairs
+	CreatedAt time.Time
+}
+
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FormatEnvLine writes vars on one line for editing, separated by "; ".
+// Backslashes, semicolons and trailing blanks in the values are escaped
+// with a backslash so that ParseEnvLine reads the same vars back.
+func FormatEnvLine(vars []string) string {
+	out := make([]string, len(vars))
+	for i, kv := range vars {
+		trimmed := strings.TrimRight(kv, " \t")
+		var b strings.Builder
+		b.WriteString(strings.NewReplacer(`\`, `\\`, ";", `\;`).Replace(trimmed))
+		for _, r := range kv[len(trimmed):] {
+			b.WriteString(`\` + string(r))
+		}
+		out[i] = b.String()
+	}
+	return strings.Join(out, "; ")
+}
+
+// ParseEnvLine reads KEY=value pairs written by FormatEnvLine: they are
+// separated by semicolons, a backslash keeps the next character as it is,
+// and unescaped blanks around a pair and empty pairs are dropped. Every key
+// has to be a valid variable name.
+func ParseEnvLine(s string) ([]string, error) {
+	var vars []string
+	var kv strings.Builder
+	var spaces strings.Builder // unescaped spaces not written yet, dropped at the end of a pair
+	end := func() error {
+		spaces.Reset()
+		if kv.Len() == 0 {
+			return nil
+		}
+		defer kv.Reset()
+		if err := ValidateEnvVar(kv.String()); err != nil {
+			return err
+		}
+		vars = append(vars, kv.String())
+		return nil
+	}
+	write := func(r rune) {
+		kv.WriteString(spaces.String())
+		spaces.Reset()
+		kv.WriteRune(r)
+	}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			write(runes[i])
+		case r == ';':
+			if err := end(); err != nil {
+				return nil, err
+			}
+		case r == ' ' || r == '\t':
+			if kv.Len() > 0 {
+				spaces.WriteRune(r)
+			}
+		default:
+			write(r)
+		}
+	}
+	if err := end(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// ValidateEnvVar checks that kv has the form KEY=value.
+func ValidateEnvVar(kv string) error {
+	key, _, ok := strings.Cut(kv, "=")
+	if !ok {
+		return fmt.Errorf("environment variable %q must be KEY=value", kv)
+	}
+	if !envKey.MatchString(key) {
+		return fmt.Errorf("invalid environment variable name %q", key)
+	}
+	return nil
+}
+
+// SetEnv returns vars with key set to value, replacing an earlier value.
+func SetEnv(vars []string, kv string) []string {
+	key, _, _ := strings.Cut(kv, "=")
+	out := UnsetEnv(vars, key)
+	return append(out, kv)
+}
+
+// UnsetEnv returns vars without key.
+func UnsetEnv(vars []string, key string) []string {
+	var out []string
+	for _, v := range vars {
+		if k, _, _ := strings.Cut(v, "="); k != key {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnvLineRoundTrip(t *testing.T) {
+	for _, vars := range [][]string{
+		nil,
+		{"A=1"},
+		{"A=1", "B=two words"},
+		{"PATH=/bin;/usr/bin", "PS1=a\\b"},
+		{"SEP=;", "BS=\\", `BOTH=\;`},
+		{"TRAIL=x  ", "TAB=a\tb\t", "EMPTY="},
+		{"URL=https://x.test/?a=1;b=2"},
+	} {
+		line := FormatEnvLine(vars)
+		got, err := ParseEnvLine(line)
+		if err != nil {
+			t.Errorf("ParseEnvLine(%q): %v", line, err)
+			continue
+		}
+		if !slices.Equal(got, vars) {
+			t.Errorf("%q was read back from %q as %q", vars, line, got)
+		}
+	}
+}
+
+func TestParseEnvLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"A=1;B=2", []string{"A=1", "B=2"}},
+		{"  A=1 ;  ; B=2  ", []string{"A=1", "B=2"}},
+		{"A=x y", []string{"A=x y"}},
+		{`A=1\;2`, []string{"A=1;2"}},
+		{`A=x\ `, []string{"A=x "}},
+		{`A=ends\`, []string{`A=ends\`}},
+	}
+	for _, tt := range tests {
+		got, err := ParseEnvLine(tt.line)
+		if err != nil {
+			t.Errorf("ParseEnvLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseEnvLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	for _, line := range []string{"A", "1A=x", "A=1; B"} {
+		if _, err := ParseEnvLine(line); err == nil {
+			t.Errorf("ParseEnvLine(%q) accepted an invalid pair", line)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Playbook is an ordered list of saved commands run one after another.
+type Playbook struct {
+	ID        int
+	Name      string
+	Note      string
+	Steps     []PlaybookStep
+	CreatedAt time.Time
+}
+
+// PlaybookStep runs one saved command as part of a playbook.
+type PlaybookStep struct {
+	CommandID       int
+	CommandName     string // resolved when the playbook is loaded
+	WorkDir         string // relative paths are resolved against the starting directory
+	ContinueOnError bool
+}
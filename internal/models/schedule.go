@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Catch-up policies decide what the daemon does about runs that were missed
+// while it was not running or the machine was asleep.
+const (
+	CatchUpSkip = "skip" // forget missed runs and wait for the next one
+	CatchUpOnce = "once" // run once for all missed runs, then continue normally
+)
+
+// Schedule runs a saved command on a cron expression.
+type Schedule struct {
+	ID          int
+	CommandID   int
+	CommandName string // resolved when the schedule is loaded
+	Spec        string
+	Dir         string
+	CatchUp     string
+	LastRun     time.Time // scheduled time of the last run, zero if it never ran
+	CreatedAt   time.Time
+}
+
+// Run is one recorded execution of a saved command.
+type Run struct {
+	ID          int
+	CommandID   int
+	CommandName string
+	Source      string // what started the run, e.g. "schedule"
+	StartedAt   time.Time
+	Duration    time.Duration
+	ExitCode    int
+	Output      string
+	Error       string
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Secret is a named secret value. The value itself only ever leaves the
+// database encrypted, so it is not part of the model.
+type Secret struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Version is a snapshot of a command's editable fields at one point in time.
+type Version struct {
+	ID        int
+	Number    int // 1 for the oldest version of a command
+	Command   Command
+	CreatedAt time.Time
+}
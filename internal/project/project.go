@@ -0,0 +1,104 @@
+// Package project finds the commands a repository checks in next to its
+// code. A project is any directory holding a .cmdvault file; the file lists
+// commands in the document format, one after the other:
+//
+//	---
+//	name: test
+//	note: Run the unit tests
+//	---
+//	go test ./...
+//
+//	---
+//	name: lint
+//	note: Lint the code
+//	---
+//	go vet ./...
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// FileName is the name of the file that marks a project.
+const FileName = ".cmdvault"
+
+// Project is a directory with a .cmdvault file and the commands it defines.
+type Project struct {
+	Root     string
+	File     string
+	Commands []models.Command
+}
+
+// Name is how the project is shown next to its commands.
+func (p *Project) Name() string {
+	return filepath.Base(p.Root)
+}
+
+// Find walks up from dir to the nearest directory holding a .cmdvault file
+// and returns the path of that file, or "" when there is none.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, FileName)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load returns the project dir belongs to, or nil when it isn't in one.
+// The commands get negative ids, which never clash with vault commands.
+func Load(dir string) (*Project, error) {
+	path, err := Find(dir)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := document.DecodeAll(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	p := &Project{Root: filepath.Dir(path), File: path}
+	for i, c := range commands {
+		c.ID = -(i + 1)
+		c.Project = p.Root
+		p.Commands = append(p.Commands, *c)
+	}
+	return p, nil
+}
+
+// Lookup returns the project command with the given name, or nil.
+func (p *Project) Lookup(name string) *models.Command {
+	if p == nil {
+		return nil
+	}
+	for i := range p.Commands {
+		if p.Commands[i].Name == name {
+			c := p.Commands[i]
+			return &c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const commands = `# checked in with the code
+---
+name: test
+note: Run the unit tests
+---
+go test ./...
+
+---
+name: lint
+note: Lint the code
+interpreter: bash
+---
+go vet ./...
+`
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, FileName), []byte(commands), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "internal", "pkg")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{root, sub} {
+		p, err := Load(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil {
+			t.Fatalf("no project found from %s", dir)
+		}
+		if p.Root != root || p.File != filepath.Join(root, FileName) || p.Name() != filepath.Base(root) {
+			t.Errorf("from %s: root %s, file %s, name %s", dir, p.Root, p.File, p.Name())
+		}
+		if len(p.Commands) != 2 {
+			t.Fatalf("%d commands, want 2", len(p.Commands))
+		}
+		for i, c := range p.Commands {
+			if c.ID != -(i+1) || c.Project != root {
+				t.Errorf("%s: id %d, project %q", c.Name, c.ID, c.Project)
+			}
+		}
+		if c := p.Lookup("lint"); c == nil || c.CommandStr != "go vet ./..." || c.Interpreter != "bash" {
+			t.Errorf("Lookup(lint) = %+v", c)
+		}
+		if c := p.Lookup("build"); c != nil {
+			t.Errorf("Lookup(build) = %+v, want nil", c)
+		}
+	}
+}
+
+func TestLoadOutsideProject(t *testing.T) {
+	dir := t.TempDir()
+	// A directory named like the file doesn't make a project.
+	if err := os.Mkdir(filepath.Join(dir, FileName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary directory may itself be inside a project.
+	if path == filepath.Join(dir, FileName) {
+		t.Errorf("Find took the directory %s for a project file", path)
+	}
+	var p *Project
+	if p.Lookup("test") != nil {
+		t.Error("a nil project has commands")
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, FileName), []byte("---\nname: test\n---\ngo test\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(root)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(root, FileName)) || !strings.Contains(err.Error(), "note is required") {
+		t.Errorf("Load = %v, want an error naming the file", err)
+	}
+}
@@ -0,0 +1,76 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces every redacted value.
+const Mask = "[REDACTED]"
+
+// minValueLength keeps very short secret values from masking ordinary text.
+const minValueLength = 4
+
+// builtin matches common credentials. When a pattern has a capture group
+// only the group is masked, so the surrounding text stays readable.
+var builtin = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`),
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+}
+
+// Redactor masks known secret values and credential patterns in text.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	values   []string
+}
+
+// New returns a redactor using the built-in patterns plus patterns.
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{patterns: append([]*regexp.Regexp(nil), builtin...)}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// AddValues makes r mask each of values wherever it appears.
+func (r *Redactor) AddValues(values ...string) {
+	for _, v := range values {
+		if len(v) >= minValueLength {
+			r.values = append(r.values, v)
+		}
+	}
+	// Longer values first, so a value containing another is masked whole.
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+}
+
+// Redact returns s with secret values and pattern matches masked.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			loc := re.FindStringSubmatchIndex(match)
+			if len(loc) < 4 || loc[2] < 0 {
+				return Mask
+			}
+			return match[:loc[2]] + Mask + match[loc[3]:]
+		})
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// placeholder matches {{name}} and {{name:default}}.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][\w.-]*)\s*(?::([^}]*))?\}\}`)
+
+// secretRef matches {{secret:name}}, a reference to an encrypted secret that
+// is only filled in right before the command runs.
+var secretRef = regexp.MustCompile(`\{\{\s*secret:\s*([A-Za-z_][\w.-]*)\s*\}\}`)
+
+// Placeholders returns the names of the placeholders in body, in order of
+// first appearance. Secret references are not placeholders.
+func Placeholders(body string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range placeholder.FindAllStringSubmatch(body, -1) {
+		if secretRef.MatchString(m[0]) {
+			continue
+		}
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Expand fills the {{name}} placeholders of body from values, falling back
+// to the {{name:default}} default. Placeholders with neither are an error.
+// Secret references are left for ResolveSecrets.
+func Expand(body string, values map[string]string) (string, error) {
+	var missing []string
+	out := placeholder.ReplaceAllStringFunc(body, func(s string) string {
+		if secretRef.MatchString(s) {
+			return s
+		}
+		m := placeholder.FindStringSubmatch(s)
+		if v, ok := values[m[1]]; ok {
+			return v
+		}
+		if strings.Contains(s, ":") {
+			return m[2]
+		}
+		missing = append(missing, m[1])
+		return s
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value for placeholder(s) %s", strings.Join(dedupe(missing), ", "))
+	}
+	return out, nil
+}
+
+// SecretRefs returns the names of the secrets body refers to, in order of
+// first appearance.
+func SecretRefs(body string) []string {
+	var names []string
+	for _, m := range secretRef.FindAllStringSubmatch(body, -1) {
+		names = append(names, m[1])
+	}
+	return dedupe(names)
+}
+
+// secretEnvPrefix starts the names of the environment variables that pass
+// secret values to a command.
+const secretEnvPrefix = "CMDVAULT_SECRET_"
+
+// ResolveSecrets replaces the {{secret:name}} references of body with
+// references to environment variables in the language of interpreter, and
+// returns the KEY=value pairs that give them the values returned by lookup.
+// Secret values thus reach the process through its environment and are
+// never written to the script file.
+func ResolveSecrets(body, interpreter string, lookup func(name string) (string, error)) (string, []string, error) {
+	names := SecretRefs(body)
+	if len(names) == 0 {
+		return body, nil, nil
+	}
+	in, err := Lookup(interpreter)
+	if err != nil {
+		return "", nil, err
+	}
+	vars := map[string]string{}
+	var env []string
+	for i, name := range names {
+		v, err := lookup(name)
+		if err != nil {
+			return "", nil, err
+		}
+		key := fmt.Sprintf("%s%d", secretEnvPrefix, i+1)
+		vars[name] = key
+		env = append(env, key+"="+v)
+	}
+	out := secretRef.ReplaceAllStringFunc(body, func(s string) string {
+		return fmt.Sprintf(in.EnvRef, vars[secretRef.FindStringSubmatch(s)[1]])
+	})
+	return out, env, nil
+}
+
+func dedupe(names []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// AppendArgs adds args to the last line of body, quoted for the interpreter.
+func AppendArgs(body, interpreter string, args []string) (string, error) {
+	if len(args) == 0 {
+		return body, nil
+	}
+	in, err := Lookup(interpreter)
+	if err != nil {
+		return "", err
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		switch in.Name {
+		case "cmd":
+			quoted[i] = quoteCmd(a)
+		case "powershell", "pwsh":
+			quoted[i] = "'" + strings.ReplaceAll(a, "'", "''") + "'"
+		case "python":
+			return "", fmt.Errorf("arguments can't be appended to %s commands", in.Name)
+		default:
+			quoted[i] = quoteShell(a)
+		}
+	}
+	return strings.TrimRight(body, "\r\n") + " " + strings.Join(quoted, " "), nil
+}
+
+var shellSafe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+func quoteShell(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func quoteCmd(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"&|<>^%") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	secrets := map[string]string{"token": "s3cr3t; rm -rf /", "user": "me"}
+	lookup := func(name string) (string, error) {
+		if v, ok := secrets[name]; ok {
+			return v, nil
+		}
+		return "", errors.New("no secret " + name)
+	}
+	tests := []struct {
+		body, interpreter string
+		want              string
+	}{
+		{"echo hi", "sh", "echo hi"},
+		{`curl -u {{secret:user}}:"{{ secret:token }}" {{secret:user}}`, "bash", `curl -u ${CMDVAULT_SECRET_1}:"${CMDVAULT_SECRET_2}" ${CMDVAULT_SECRET_1}`},
+		{"echo {{secret:token}}", "cmd", "echo %CMDVAULT_SECRET_1%"},
+		{`Write-Output "{{secret:token}}"`, "pwsh", `Write-Output "${env:CMDVAULT_SECRET_1}"`},
+		{"print({{secret:token}})", "python", "print(__import__('os').environ['CMDVAULT_SECRET_1'])"},
+	}
+	for _, tt := range tests {
+		body, env, err := ResolveSecrets(tt.body, tt.interpreter, lookup)
+		if err != nil {
+			t.Fatalf("ResolveSecrets(%q): %v", tt.body, err)
+		}
+		if body != tt.want {
+			t.Errorf("ResolveSecrets(%q, %s) = %q, want %q", tt.body, tt.interpreter, body, tt.want)
+		}
+		for _, name := range SecretRefs(tt.body) {
+			if !slices.ContainsFunc(env, func(kv string) bool { return strings.HasSuffix(kv, "="+secrets[name]) }) {
+				t.Errorf("ResolveSecrets(%q) env %q lacks the value of %s", tt.body, env, name)
+			}
+		}
+	}
+	if _, _, err := ResolveSecrets("echo {{secret:missing}}", "sh", lookup); err == nil {
+		t.Error("resolved a missing secret")
+	}
+}
+
+func TestSecretsStayOutOfTheScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	const secret = "it's a \"secret\"; $HOME `id`"
+	body, env, err := ResolveSecrets(`printf '%s' "{{secret:token}}"`, "sh", func(string) (string, error) { return secret, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := Prepare(body, "sh", t.TempDir(), WithEnv(nil, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Cleanup()
+	written, err := os.ReadFile(script.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(written), "secret") {
+		t.Errorf("the script file holds the secret: %q", written)
+	}
+	out, err := script.Cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != secret {
+		t.Errorf("the command printed %q, want %q", out, secret)
+	}
+}
@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// JobStatus is the state of a background job.
+type JobStatus int
+
+const (
+	JobRunning JobStatus = iota
+	JobDone
+	JobFailed
+	JobCanceled
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	default:
+		return "canceled"
+	}
+}
+
+// ErrCanceled is returned by Job.Err for jobs stopped with Cancel.
+var ErrCanceled = errors.New("canceled")
+
+// maxJobOutput is how much of a job's output is kept. Older output is
+// dropped, so that a job that keeps printing doesn't fill the memory.
+const maxJobOutput = 64 << 10
+
+// Job is a command running in the background. The last maxJobOutput bytes
+// of its output are collected in a buffer that can be read while the job is
+// still running.
+type Job struct {
+	ID      int
+	Name    string
+	Dir     string
+	Started time.Time
+
+	script *Script
+	done   chan struct{}
+
+	mu       sync.Mutex
+	out      bytes.Buffer
+	dropped  bool // whether output was dropped from the start of out
+	finished time.Time
+	err      error
+	canceled bool
+}
+
+// StartJob starts body with the given interpreter in dir and environment env
+// and returns at once.
+func StartJob(id int, name, body, interpreter, dir string, env []string) (*Job, error) {
+	return StartJobTo(id, name, body, interpreter, dir, env, nil)
+}
+
+// StartJobTo is StartJob that also copies the output to w as it arrives.
+func StartJobTo(id int, name, body, interpreter, dir string, env []string, w io.Writer) (*Job, error) {
+	script, err := Prepare(body, interpreter, dir, env)
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{ID: id, Name: name, Dir: dir, script: script, done: make(chan struct{})}
+	var out io.Writer = (*jobWriter)(j)
+	if w != nil {
+		out = io.MultiWriter(out, w)
+	}
+	script.Cmd.Stdout = out
+	script.Cmd.Stderr = out
+	setProcessGroup(script.Cmd)
+	j.Started = time.Now()
+	if err := script.Cmd.Start(); err != nil {
+		script.Cleanup()
+		return nil, err
+	}
+	go j.wait()
+	return j, nil
+}
+
+func (j *Job) wait() {
+	err := j.script.Cmd.Wait()
+	j.script.Cleanup()
+	j.mu.Lock()
+	j.finished = time.Now()
+	if j.canceled {
+		err = ErrCanceled
+	}
+	j.err = err
+	j.mu.Unlock()
+	close(j.done)
+}
+
+// jobWriter appends process output to the job buffer under its lock,
+// dropping the oldest output beyond maxJobOutput.
+type jobWriter Job
+
+func (w *jobWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.out.Write(p)
+	if extra := w.out.Len() - maxJobOutput; extra > 0 {
+		w.out.Next(extra)
+		w.dropped = true
+	}
+	return n, err
+}
+
+// Done is closed when the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Output returns a copy of what the job printed so far, starting with
+// "...\n" when the beginning was dropped.
+func (j *Job) Output() []byte {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []byte
+	if j.dropped {
+		out = []byte("...\n")
+	}
+	return append(out, j.out.Bytes()...)
+}
+
+// Status reports whether the job is running or how it ended.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case j.finished.IsZero():
+		return JobRunning
+	case j.canceled:
+		return JobCanceled
+	case j.err != nil:
+		return JobFailed
+	default:
+		return JobDone
+	}
+}
+
+// Err returns the error the job ended with, nil while it is running.
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Elapsed is how long the job has been running, or ran for once finished.
+func (j *Job) Elapsed() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finished.IsZero() {
+		return time.Since(j.Started)
+	}
+	return j.finished.Sub(j.Started)
+}
+
+// Cancel kills a running job. It does nothing once the job has finished.
+func (j *Job) Cancel() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.finished.IsZero() {
+		return nil
+	}
+	j.canceled = true
+	return killProcess(j.script.Cmd)
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobOutputKeepsTheEnd(t *testing.T) {
+	j := &Job{}
+	w := (*jobWriter)(j)
+	if _, err := w.Write([]byte("start\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(j.Output()); got != "start\n" {
+		t.Errorf("Output = %q", got)
+	}
+
+	line := bytes.Repeat([]byte("x"), 1023)
+	line = append(line, '\n')
+	for range 2 * maxJobOutput / len(line) {
+		if n, err := w.Write(line); n != len(line) || err != nil {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	w.Write([]byte("end\n"))
+	out := j.Output()
+	if len(out) != len("...\n")+maxJobOutput || !bytes.HasPrefix(out, []byte("...\n")) || !bytes.HasSuffix(out, []byte("x\nend\n")) {
+		t.Errorf("Output has %d bytes, starting %q and ending %q", len(out), out[:8], out[len(out)-8:])
+	}
+	if j.out.Cap() > 4*maxJobOutput {
+		t.Errorf("the buffer grew to %d bytes", j.out.Cap())
+	}
+}
+
+func TestJob(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	j, err := StartJob(1, "count", "for i in 1 2 3; do echo $i; done; exit 3", "sh", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-j.Done():
+	case <-time.After(10 * time.Second):
+		j.Cancel()
+		t.Fatal("the job didn't finish")
+	}
+	if got := string(j.Output()); got != "1\n2\n3\n" {
+		t.Errorf("Output = %q", got)
+	}
+	if j.Status() != JobFailed || j.Err() == nil || !strings.Contains(j.Err().Error(), "3") {
+		t.Errorf("status %v, error %v, want failed with exit status 3", j.Status(), j.Err())
+	}
+}
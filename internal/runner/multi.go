@@ -0,0 +1,75 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DirResult is the outcome of running a command in one directory.
+type DirResult struct {
+	Dir      string
+	ExitCode int // -1 when the process could not be started
+	Duration time.Duration
+	Output   []byte
+	Err      error
+}
+
+// RunInDirs runs body in every directory with at most jobs running at once.
+// Results are returned in the order of dirs.
+func RunInDirs(body, interpreter string, env []string, dirs []string, jobs int) []DirResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]DirResult, len(dirs))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dir string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = runInDir(body, interpreter, dir, env)
+		}(i, dir)
+	}
+	wg.Wait()
+	return results
+}
+
+func runInDir(body, interpreter, dir string, env []string) DirResult {
+	res := DirResult{Dir: dir}
+	script, err := Prepare(body, interpreter, dir, env)
+	if err != nil {
+		res.ExitCode = -1
+		res.Err = err
+		return res
+	}
+	defer script.Cleanup()
+
+	var out bytes.Buffer
+	script.Cmd.Stdout = &out
+	script.Cmd.Stderr = &out
+	start := time.Now()
+	err = script.Cmd.Run()
+	res.Duration = time.Since(start)
+	res.Output = out.Bytes()
+	res.Err = err
+	res.ExitCode = ExitCode(err)
+	return res
+}
+
+// ExitCode extracts the process exit code from the error returned by
+// exec.Cmd.Run: 0 for success and -1 when the process never ran.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
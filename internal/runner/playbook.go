@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// Step is a playbook step resolved to the command body it runs.
+type Step struct {
+	Name            string
+	Body            string
+	Interpreter     string
+	Dir             string
+	Env             []string // nil inherits the current environment
+	ContinueOnError bool
+	// Err is set when the step can't run at all, e.g. its command was deleted.
+	Err error
+}
+
+// PlaybookSteps resolves the steps of p. Relative working directories are
+// taken relative to baseDir and each step gets the variables of profile plus
+// those of its command; lookup returns nil for commands that no longer exist.
+func PlaybookSteps(p *models.Playbook, baseDir string, profile []string, lookup func(id int) (*models.Command, error)) []Step {
+	steps := make([]Step, 0, len(p.Steps))
+	for _, ps := range p.Steps {
+		st := Step{
+			Name:            ps.CommandName,
+			Dir:             ResolveDir(baseDir, ps.WorkDir),
+			ContinueOnError: ps.ContinueOnError,
+		}
+		c, err := lookup(ps.CommandID)
+		switch {
+		case err != nil:
+			st.Err = err
+		case c == nil && ps.CommandName != "":
+			st.Err = fmt.Errorf("command %s is in the trash", ps.CommandName)
+		case c == nil:
+			st.Name = fmt.Sprintf("#%d", ps.CommandID)
+			st.Err = fmt.Errorf("command %d no longer exists", ps.CommandID)
+		default:
+			st.Body = c.CommandStr
+			st.Interpreter = c.Interpreter
+			st.Env = Environ(profile, c.Env)
+		}
+		steps = append(steps, st)
+	}
+	return steps
+}
+
+// ResolveDir returns dir made absolute against base; an empty dir means base.
+func ResolveDir(base, dir string) string {
+	if dir == "" {
+		return base
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(base, dir)
+}
+
+// Run executes the step, wiring its output to out and its input to in.
+func (st Step) Run(out io.Writer, in io.Reader) error {
+	if st.Err != nil {
+		return st.Err
+	}
+	script, err := Prepare(st.Body, st.Interpreter, st.Dir, st.Env)
+	if err != nil {
+		return err
+	}
+	defer script.Cleanup()
+	script.Cmd.Stdout = out
+	script.Cmd.Stderr = out
+	script.Cmd.Stdin = in
+	return script.Cmd.Run()
+}
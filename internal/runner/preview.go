@@ -0,0 +1,147 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Preview describes exactly what running a command body would do, without
+// writing or starting anything.
+type Preview struct {
+	Interpreter Interpreter
+	Dir         string
+	Script      string   // content of the script file, header included
+	Argv        []string // program and arguments, <script> stands for the temporary file
+	Vars        []string // variables set on top of the inherited environment
+	// Expanded is Script with the variables of Vars filled in where the
+	// interpreter will expand them. Variables inherited from the caller
+	// are left as they are, so that the preview shows none of their values.
+	// Empty when nothing changes.
+	Expanded string
+}
+
+// NewPreview builds the preview of running body with interpreter in dir
+// with vars set on top of the current environment.
+func NewPreview(body, interpreter, dir string, vars []string) (*Preview, error) {
+	in, err := Lookup(interpreter)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{
+		Interpreter: in,
+		Dir:         dir,
+		Script:      scriptContent(in, body),
+		Argv:        append(append([]string{in.Program}, in.Args...), "<script"+in.Ext+">"),
+		Vars:        vars,
+	}
+	if expanded := expandEnv(in, p.Script, vars); expanded != p.Script {
+		p.Expanded = expanded
+	}
+	return p, nil
+}
+
+var (
+	shellVar = regexp.MustCompile(`\$\{([A-Za-z_]\w*)\}|\$([A-Za-z_]\w*)`)
+	cmdVar   = regexp.MustCompile(`%([A-Za-z_]\w*)%`)
+	psVar    = regexp.MustCompile(`(?i)\$env:([A-Za-z_]\w*)`)
+)
+
+// expandEnv substitutes the variables set in env using the syntax of the
+// interpreter. Unknown variables are left alone since the script may set
+// them itself, and so is the text of single-quoted strings in sh and
+// PowerShell, which expand nothing there.
+func expandEnv(in Interpreter, script string, env []string) string {
+	vars := map[string]string{}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	var re *regexp.Regexp
+	var literal [][2]int
+	switch in.Name {
+	case "cmd":
+		re = cmdVar
+	case "powershell", "pwsh":
+		re, literal = psVar, singleQuoted(script, '`')
+	case "python":
+		return script
+	default:
+		re, literal = shellVar, singleQuoted(script, '\\')
+	}
+	expand := func(s string) string {
+		return re.ReplaceAllStringFunc(s, func(s string) string {
+			m := re.FindStringSubmatch(s)
+			name := m[1]
+			if name == "" && len(m) > 2 {
+				name = m[2]
+			}
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			return s
+		})
+	}
+	var b strings.Builder
+	at := 0
+	for _, span := range literal {
+		b.WriteString(expand(script[at:span[0]]))
+		b.WriteString(script[span[0]:span[1]])
+		at = span[1]
+	}
+	b.WriteString(expand(script[at:]))
+	return b.String()
+}
+
+// singleQuoted returns the start and end of the single-quoted strings of
+// script, quotes included. escape makes the character after it literal
+// outside of them; comments, which start with # at the beginning of a word,
+// run to the end of the line and quote nothing.
+func singleQuoted(script string, escape byte) [][2]int {
+	var spans [][2]int
+	double := false
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == escape:
+			i++
+		case c == '"':
+			double = !double
+		case double:
+		case c == '#' && (i == 0 || strings.IndexByte(" \t\n;&|(", script[i-1]) >= 0):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case c == '\'':
+			end := len(script)
+			if n := strings.IndexByte(script[i+1:], '\''); n >= 0 {
+				end = i + 1 + n + 1
+			}
+			spans = append(spans, [2]int{i, end})
+			i = end - 1
+		}
+	}
+	return spans
+}
+
+func (p *Preview) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Interpreter: %s\n", p.Interpreter.Name)
+	fmt.Fprintf(&b, "Invocation:  %s\n", strings.Join(p.Argv, " "))
+	fmt.Fprintf(&b, "Directory:   %s\n", p.Dir)
+	if len(p.Vars) > 0 {
+		b.WriteString("Environment:\n")
+		for _, kv := range p.Vars {
+			fmt.Fprintf(&b, "  %s\n", kv)
+		}
+	}
+	b.WriteString("\nScript:\n")
+	b.WriteString(strings.ReplaceAll(p.Script, "\r\n", "\n"))
+	if p.Expanded != "" {
+		b.WriteString("\nWith the variables above expanded:\n")
+		b.WriteString(strings.ReplaceAll(p.Expanded, "\r\n", "\n"))
+	}
+	return b.String()
+}
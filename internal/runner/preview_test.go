@@ -0,0 +1,48 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := []string{"TARGET=prod", "DIR=/srv/app"}
+	tests := []struct {
+		interpreter, script, want string
+	}{
+		{"bash", "deploy $TARGET ${DIR}", "deploy prod /srv/app"},
+		{"bash", `echo "$TARGET" '$TARGET'`, `echo "prod" '$TARGET'`},
+		{"bash", `echo '$DIR is "$TARGET"' $TARGET`, `echo '$DIR is "$TARGET"' prod`},
+		{"bash", `echo "it's $TARGET"`, `echo "it's prod"`},
+		{"bash", `echo it\'s $TARGET`, `echo it\'s prod`},
+		{"bash", "# don't\necho $TARGET", "# don't\necho prod"},
+		{"bash", "echo $HOME $GITHUB_TOKEN", "echo $HOME $GITHUB_TOKEN"},
+		{"bash", "echo 'unterminated $TARGET", "echo 'unterminated $TARGET"},
+		{"pwsh", `echo $env:TARGET '$env:TARGET' "$env:DIR"`, `echo prod '$env:TARGET' "/srv/app"`},
+		{"cmd", `echo %TARGET% '%DIR%'`, `echo prod '/srv/app'`},
+		{"python", "print('$TARGET')", "print('$TARGET')"},
+	}
+	for _, tt := range tests {
+		in, err := Lookup(tt.interpreter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := expandEnv(in, tt.script, env); got != tt.want {
+			t.Errorf("%s: expandEnv(%q) = %q, want %q", tt.interpreter, tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewKeepsInheritedVariables(t *testing.T) {
+	t.Setenv("CMDVAULT_TEST_TOKEN", "s3cr3t-value")
+	p, err := NewPreview("echo $CMDVAULT_TEST_TOKEN $TARGET", "sh", "/tmp", []string{"TARGET=prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := p.String(); strings.Contains(out, "s3cr3t-value") {
+		t.Errorf("the preview shows an inherited value:\n%s", out)
+	}
+	if !strings.Contains(p.Expanded, "echo $CMDVAULT_TEST_TOKEN prod") {
+		t.Errorf("Expanded = %q", p.Expanded)
+	}
+}
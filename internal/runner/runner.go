@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Interpreter describes how a saved command body is handed to a shell.
+type Interpreter struct {
+	Name    string
+	Program string
+	Args    []string // arguments placed before the script path
+	Ext     string   // extension of the temporary script file
+	Header  string   // prepended to the script body, e.g. "@echo off"
+	EnvRef  string   // format of a reference to an environment variable in a script
+}
+
+var interpreters = map[string]Interpreter{
+	"cmd":        {Name: "cmd", Program: "cmd", Args: []string{"/C"}, Ext: ".bat", Header: "@echo off", EnvRef: "%%%s%%"},
+	"powershell": {Name: "powershell", Program: "powershell", Args: []string{"-NoProfile", "-ExecutionPolicy", "Bypass", "-File"}, Ext: ".ps1", EnvRef: "${env:%s}"},
+	"pwsh":       {Name: "pwsh", Program: "pwsh", Args: []string{"-NoProfile", "-File"}, Ext: ".ps1", EnvRef: "${env:%s}"},
+	"sh":         {Name: "sh", Program: "sh", Ext: ".sh", EnvRef: "${%s}"},
+	"bash":       {Name: "bash", Program: "bash", Ext: ".sh", EnvRef: "${%s}"},
+	"zsh":        {Name: "zsh", Program: "zsh", Ext: ".sh", EnvRef: "${%s}"},
+	"python":     {Name: "python", Program: "python3", Ext: ".py", EnvRef: "__import__('os').environ['%s']"},
+}
+
+// DefaultInterpreter returns the interpreter used when a command doesn't choose one.
+func DefaultInterpreter() string {
+	if runtime.GOOS == "windows" {
+		return "cmd"
+	}
+	return "sh"
+}
+
+// Interpreters returns the names of all known interpreters, sorted.
+func Interpreters() []string {
+	names := make([]string, 0, len(interpreters))
+	for name := range interpreters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup resolves an interpreter by name. An empty name means the platform default.
+func Lookup(name string) (Interpreter, error) {
+	if name == "" {
+		name = DefaultInterpreter()
+	}
+	in, ok := interpreters[strings.ToLower(name)]
+	if !ok {
+		return Interpreter{}, fmt.Errorf("unknown interpreter %q (known: %s)", name, strings.Join(Interpreters(), ", "))
+	}
+	return in, nil
+}
+
+// Script is a prepared command: the process to start and the temporary
+// script file backing it. Cleanup must be called once the process is done.
+type Script struct {
+	Cmd  *exec.Cmd
+	Path string
+}
+
+// Cleanup removes the temporary script file.
+func (s *Script) Cleanup() {
+	if s.Path != "" {
+		_ = os.Remove(s.Path)
+	}
+}
+
+// Environ returns the environment of the current process with each layer of
+// KEY=value pairs applied on top, later layers winning. It returns nil, which
+// makes a process inherit the environment unchanged, when no layer sets anything.
+func Environ(layers ...[]string) []string {
+	var env []string
+	for _, l := range layers {
+		env = append(env, l...)
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	// exec.Cmd keeps only the last value of a duplicated key.
+	return append(os.Environ(), env...)
+}
+
+// WithEnv adds vars on top of env, an environment built by Environ in which
+// nil stands for the current one.
+func WithEnv(env, vars []string) []string {
+	if len(vars) == 0 {
+		return env
+	}
+	if env == nil {
+		return Environ(vars)
+	}
+	return append(slices.Clip(env), vars...)
+}
+
+// Prepare writes body to a temporary script file and builds the command that
+// runs it through the named interpreter in dir with env (nil inherits the
+// current environment).
+func Prepare(body, interpreter, dir string, env []string) (*Script, error) {
+	in, err := Lookup(interpreter)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "cmd-vault-*"+in.Ext)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(scriptContent(in, body)); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	args := append(append([]string{}, in.Args...), f.Name())
+	cmd := exec.Command(in.Program, args...) // #nosec G204
+	cmd.Dir = dir
+	cmd.Env = env
+	return &Script{Cmd: cmd, Path: f.Name()}, nil
+}
+
+// scriptContent normalises line endings for the interpreter and adds its header.
+func scriptContent(in Interpreter, body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if in.Header != "" {
+		body = in.Header + "\n" + body
+	}
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	if in.Ext == ".bat" {
+		body = strings.ReplaceAll(body, "\n", "\r\n")
+	}
+	return body
+}
@@ -0,0 +1,91 @@
+package safety
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule flags command bodies matching Pattern as risky.
+type Rule struct {
+	Pattern *regexp.Regexp
+	Reason  string
+}
+
+// rmRecursiveForce matches rm with both a recursive flag (-r, -R or
+// --recursive) and a force flag (-f or --force), in either order, bundled
+// or separate, before or after the operands of the same line.
+var rmRecursiveForce = func() *regexp.Regexp {
+	const (
+		arg   = `[^\s;&|]+`
+		r     = `(-[a-zA-Z]*[rR][a-zA-Z]*|--recursive)\b`
+		f     = `(-[a-zA-Z]*f[a-zA-Z]*|--force)\b`
+		both  = `-[a-zA-Z]*([rR][a-zA-Z]*f|f[a-zA-Z]*[rR])[a-zA-Z]*\b`
+		other = `([ \t]+` + arg + `)*?[ \t]+`
+	)
+	return regexp.MustCompile(`\brm` + other + `(` + both + `|` + r + other + f + `|` + f + other + r + `)`)
+}()
+
+// builtin covers the usual ways of losing data or rewriting shared history.
+var builtin = []Rule{
+	{rmRecursiveForce, "recursive forced delete (rm -rf)"},
+	{regexp.MustCompile(`\brm\s+(.*\s)?--no-preserve-root\b`), "rm --no-preserve-root"},
+	{regexp.MustCompile(`\bgit\s+push\b.*\s(--force\b|-f\b|\+\S)`), "force push rewrites remote history"},
+	{regexp.MustCompile(`\bgit\s+reset\s+(.*\s)?--hard\b`), "git reset --hard discards local changes"},
+	{regexp.MustCompile(`\bgit\s+clean\s+(.*\s)?-\w*f`), "git clean deletes untracked files"},
+	{regexp.MustCompile(`\bdd\s+.*\bof=/dev/`), "dd writing to a device"},
+	{regexp.MustCompile(`\bmkfs(\.\w+)?\b`), "formats a file system"},
+	{regexp.MustCompile(`>\s*/dev/(sd|nvme|hd|disk)`), "writes to a disk device"},
+	{regexp.MustCompile(`\bchmod\s+(.*\s)?-R\s+0?777\b`), "recursive chmod 777"},
+	{regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`), "fork bomb"},
+	{regexp.MustCompile(`(?m)(^\s*|[;&|(]\s*|\bsudo\s+)(shutdown|reboot|poweroff|halt)\b`), "shuts down or restarts the machine"},
+	{regexp.MustCompile(`(?i)\bdrop\s+(table|database|schema)\b`), "drops database objects"},
+	{regexp.MustCompile(`(?i)\btruncate\s+table\b`), "empties a database table"},
+	{regexp.MustCompile(`\bkubectl\s+delete\b`), "deletes Kubernetes resources"},
+	{regexp.MustCompile(`\bterraform\s+destroy\b`), "destroys infrastructure"},
+	{regexp.MustCompile(`\bdocker\s+(system|volume)\s+prune\b`), "removes Docker data"},
+	{regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z)?sh\b`), "pipes a download into a shell"},
+	{regexp.MustCompile(`(?i)\b(del|erase)\s+(.*\s)?/s\b`), "recursive delete (del /s)"},
+	{regexp.MustCompile(`(?i)\b(rd|rmdir)\s+(.*\s)?/s\b`), "recursive directory removal (rd /s)"},
+	{regexp.MustCompile(`(?i)\bformat\s+[a-z]:`), "formats a drive"},
+	{regexp.MustCompile(`(?i)\bRemove-Item\b.*-Recurse\b.*-Force\b|\bRemove-Item\b.*-Force\b.*-Recurse\b`), "recursive forced delete (Remove-Item)"},
+}
+
+// Checker flags risky command bodies using the built-in rules plus user
+// supplied regular expressions.
+type Checker struct {
+	rules []Rule
+}
+
+// New returns a checker that also flags bodies matching any of patterns.
+func New(patterns []string) (*Checker, error) {
+	rules := append([]Rule(nil), builtin...)
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("dangerous pattern %q: %w", p, err)
+		}
+		rules = append(rules, Rule{Pattern: re, Reason: "matches " + p})
+	}
+	return &Checker{rules: rules}, nil
+}
+
+// Check returns the reasons body is considered dangerous; none means safe.
+func (c *Checker) Check(body string) []string {
+	var reasons []string
+	for _, r := range c.rules {
+		if r.Pattern.MatchString(body) {
+			reasons = append(reasons, r.Reason)
+		}
+	}
+	return reasons
+}
+
+// Dangerous reports whether any rule matches body.
+func (c *Checker) Dangerous(body string) bool {
+	for _, r := range c.rules {
+		if r.Pattern.MatchString(body) {
+			return true
+		}
+	}
+	return false
+}
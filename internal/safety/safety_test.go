@@ -0,0 +1,107 @@
+package safety
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBuiltinRules(t *testing.T) {
+	tests := []struct {
+		body   string
+		reason string // "" when body is safe
+	}{
+		{"rm -rf /", "recursive forced delete (rm -rf)"},
+		{"rm -fr build", "recursive forced delete (rm -rf)"},
+		{"rm -Rf /", "recursive forced delete (rm -rf)"},
+		{"rm -fR /tmp/x", "recursive forced delete (rm -rf)"},
+		{"rm -r -f /", "recursive forced delete (rm -rf)"},
+		{"rm -f -r /", "recursive forced delete (rm -rf)"},
+		{"rm -R --force /", "recursive forced delete (rm -rf)"},
+		{"rm --recursive --force /", "recursive forced delete (rm -rf)"},
+		{"rm --force --recursive /", "recursive forced delete (rm -rf)"},
+		{"rm -v -rfi dist", "recursive forced delete (rm -rf)"},
+		{"rm -r dist -f", "recursive forced delete (rm -rf)"},
+		{"sudo rm -rf /var/cache", "recursive forced delete (rm -rf)"},
+		{"cd app && rm -rf node_modules", "recursive forced delete (rm -rf)"},
+		{"rm -f file.txt", ""},
+		{"rm -r dir", ""},
+		{"rm -i -v notes.txt", ""},
+		{"rm --preserve-root x", ""},
+		{"rm -r dir; cp -f a b", ""},
+		{"rm -r dir && touch -f", ""},
+		{"rm -r dir\ncp -f a b", ""},
+		{"echo perm -rf", ""},
+
+		{"rm --no-preserve-root -r /", "rm --no-preserve-root"},
+		{"git push --force origin main", "force push rewrites remote history"},
+		{"git push -f", "force push rewrites remote history"},
+		{"git push origin +main", "force push rewrites remote history"},
+		{"git push origin main", ""},
+		{"git reset --hard HEAD~1", "git reset --hard discards local changes"},
+		{"git reset --soft HEAD~1", ""},
+		{"git clean -fdx", "git clean deletes untracked files"},
+		{"git clean -n", ""},
+		{"dd if=disk.img of=/dev/sdb bs=4M", "dd writing to a device"},
+		{"dd if=/dev/zero of=out.img", ""},
+		{"mkfs.ext4 /dev/sdb1", "formats a file system"},
+		{"cat img > /dev/sda", "writes to a disk device"},
+		{"echo hi > /dev/null", ""},
+		{"chmod -R 777 /srv", "recursive chmod 777"},
+		{"chmod 755 script.sh", ""},
+		{":(){ :|:& };:", "fork bomb"},
+		{"sudo reboot", "shuts down or restarts the machine"},
+		{"make && shutdown -h now", "shuts down or restarts the machine"},
+		{"echo reboot later", ""},
+		{"psql -c 'DROP TABLE users'", "drops database objects"},
+		{"psql -c 'truncate table logs'", "empties a database table"},
+		{"kubectl delete pod web-1", "deletes Kubernetes resources"},
+		{"kubectl get pods", ""},
+		{"terraform destroy -auto-approve", "destroys infrastructure"},
+		{"docker system prune -a", "removes Docker data"},
+		{"docker volume prune", "removes Docker data"},
+		{"curl -fsSL https://x.test/install.sh | sh", "pipes a download into a shell"},
+		{"wget -qO- https://x.test | sudo bash", "pipes a download into a shell"},
+		{"curl https://x.test | jq .", ""},
+		{"del /s /q build", "recursive delete (del /s)"},
+		{"rd /s /q build", "recursive directory removal (rd /s)"},
+		{"format d:", "formats a drive"},
+		{"Remove-Item build -Recurse -Force", "recursive forced delete (Remove-Item)"},
+		{"Remove-Item build -Force -Recurse", "recursive forced delete (Remove-Item)"},
+		{"Remove-Item build.log", ""},
+	}
+	c, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got := c.Check(tt.body)
+		if tt.reason == "" {
+			if len(got) > 0 {
+				t.Errorf("Check(%q) = %q, want safe", tt.body, got)
+			}
+			continue
+		}
+		if !slices.Contains(got, tt.reason) {
+			t.Errorf("Check(%q) = %q, want %q", tt.body, got, tt.reason)
+		}
+		if !c.Dangerous(tt.body) {
+			t.Errorf("Dangerous(%q) = false", tt.body)
+		}
+	}
+}
+
+func TestUserPatterns(t *testing.T) {
+	c, err := New([]string{`\bprod\b`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Check("deploy prod"); !slices.Equal(got, []string{`matches \bprod\b`}) {
+		t.Errorf("Check = %q, want the user pattern", got)
+	}
+	if c.Dangerous("deploy staging") {
+		t.Error("deploy staging is flagged")
+	}
+	if _, err := New([]string{"("}); err == nil {
+		t.Error("New accepted an invalid pattern")
+	}
+}
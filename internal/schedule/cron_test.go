@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // DST tests need zones the test machine may lack
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@every",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid expression", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		spec, from, want string
+	}{
+		{"* * * * *", "2026-01-01 10:00", "2026-01-01 10:01"},
+		{"*/15 * * * *", "2026-01-01 10:07", "2026-01-01 10:15"},
+		{"*/15 * * * *", "2026-01-01 10:45", "2026-01-01 11:00"},
+		{"0 9-17 * * *", "2026-01-01 17:30", "2026-01-02 09:00"},
+		{"30 2 * * *", "2026-01-01 02:30", "2026-01-02 02:30"},
+		{"0,30 * * * *", "2026-01-01 10:10", "2026-01-01 10:30"},
+		{"10-20/5 * * * *", "2026-01-01 10:16", "2026-01-01 10:20"},
+		{"5/20 * * * *", "2026-01-01 10:06", "2026-01-01 10:25"},
+		{"0 0 1 * *", "2026-01-15 12:00", "2026-02-01 00:00"},
+		{"0 0 31 * *", "2026-04-01 00:00", "2026-05-31 00:00"},
+		{"0 0 29 2 *", "2026-01-01 00:00", "2028-02-29 00:00"},
+		{"0 0 * 12 *", "2026-12-31 23:59", "2027-12-01 00:00"},
+		// 2026-01-01 is a Thursday.
+		{"0 9 * * 1-5", "2026-01-02 10:00", "2026-01-05 09:00"},
+		{"0 0 * * 0", "2026-01-01 00:00", "2026-01-04 00:00"},
+		{"0 0 * * 7", "2026-01-01 00:00", "2026-01-04 00:00"},
+		{"0 0 * * 5-7", "2026-01-03 12:00", "2026-01-04 00:00"},
+		// With both day fields restricted either one matching is enough.
+		{"0 0 13 * 5", "2026-01-01 00:00", "2026-01-02 00:00"},
+		{"0 0 13 * 5", "2026-01-10 00:00", "2026-01-13 00:00"},
+		// With one of them "*" only the other one counts.
+		{"0 0 13 * *", "2026-01-01 00:00", "2026-01-13 00:00"},
+		{"0 0 * * 5", "2026-01-03 00:00", "2026-01-09 00:00"},
+		{"@hourly", "2026-01-01 10:30", "2026-01-01 11:00"},
+		{"@daily", "2026-01-01 10:30", "2026-01-02 00:00"},
+		{"@weekly", "2026-01-01 10:30", "2026-01-04 00:00"},
+		{"@monthly", "2026-01-01 10:30", "2026-02-01 00:00"},
+		{"@yearly", "2026-01-01 10:30", "2027-01-01 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := c.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s: %s, want %s", tt.spec, tt.from, got.Format("2006-01-02 15:04 Mon"), tt.want)
+		}
+	}
+}
+
+func TestNextGivesUpAfterFiveYears(t *testing.T) {
+	// February 30th never comes.
+	c, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next = %s, want the zero time", got)
+	}
+	// 2100 is not a leap year, so after 2096 February 29th is eight years
+	// away.
+	c, err = Parse("0 0 29 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(time.Date(2096, 3, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %s, want the zero time", got)
+	}
+	want := time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)
+	if got := c.Next(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestNextAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		// 2026-03-08 02:00 to 03:00 doesn't exist: the 02:30 run is skipped.
+		{"30 2 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, ny), time.Date(2026, 3, 9, 2, 30, 0, 0, ny)},
+		{"0 3 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		{"0 * * * *", time.Date(2026, 3, 8, 1, 30, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		// 2026-11-01 01:00 to 02:00 happens twice.
+		{"0 2 * * *", time.Date(2026, 11, 1, 0, 0, 0, 0, ny), time.Date(2026, 11, 1, 2, 0, 0, 0, ny)},
+		{"0 12 * * *", time.Date(2026, 10, 31, 13, 0, 0, 0, ny), time.Date(2026, 11, 1, 12, 0, 0, 0, ny)},
+		// In Santiago 2026-09-06 starts at 01:00: midnight doesn't exist.
+		{"0 0 * * *", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago), time.Date(2026, 9, 7, 0, 0, 0, 0, santiago)},
+		{"30 1 * * *", time.Date(2026, 9, 5, 12, 0, 0, 0, santiago), time.Date(2026, 9, 6, 1, 30, 0, 0, santiago)},
+	}
+	for _, tt := range tests {
+		c, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %s: %s, want %s", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
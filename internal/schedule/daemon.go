@@ -0,0 +1,212 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/redact"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// Grace is how late a run may start and still count as on time. Runs older
+// than that were missed and are handled by the schedule's catch-up policy.
+const Grace = 2 * time.Minute
+
+// checkInterval is how often the daemon looks for due schedules. It is
+// shorter than a minute so runs start close to their time, and it reads the
+// wall clock every time so a machine waking from sleep notices missed runs.
+const checkInterval = 15 * time.Second
+
+// maxOutput is how much of a run's output is kept in the history.
+const maxOutput = 64 << 10
+
+// Due reports whether sc should fire at now. at is the scheduled time the run
+// stands for, and missed is set when that time is older than Grace.
+func Due(sc models.Schedule, c *Cron, now time.Time) (due bool, at time.Time, missed bool) {
+	from := sc.LastRun
+	if from.IsZero() {
+		from = sc.CreatedAt
+	}
+	next := c.Next(from)
+	if next.IsZero() || next.After(now) {
+		return false, time.Time{}, false
+	}
+	// Several runs may be due after a long sleep; they collapse into the latest.
+	at = next
+	for n := c.Next(at); !n.IsZero() && !n.After(now); n = c.Next(n) {
+		at = n
+	}
+	return true, at, now.Sub(at) > Grace
+}
+
+// Daemon runs scheduled commands and records the results as run history.
+type Daemon struct {
+	Store storage.Store
+	// Reload, when set, reads the store again before every check. Stores
+	// that keep the vault in memory need it to see changes made by others.
+	Reload func() error
+	Log    *log.Logger
+	// Profile holds environment variables applied to every scheduled run.
+	Profile []string
+	// Secrets looks up the {{secret:name}} references of commands; nil
+	// when the secrets are locked.
+	Secrets func(name string) (string, error)
+	// Redactor masks secrets in the output recorded in the run history.
+	Redactor *redact.Redactor
+
+	mu      sync.Mutex
+	running map[int]bool // command IDs with a run in progress
+	wg      sync.WaitGroup
+}
+
+// Run checks the schedules until ctx is done, then waits for running commands.
+func (d *Daemon) Run(ctx context.Context) {
+	d.running = map[int]bool{}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		d.check(time.Now())
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check starts every schedule that is due. Schedules are re-read each time
+// (after Reload, when the store needs one) so changes made with the CLI are
+// picked up without a restart.
+func (d *Daemon) check(now time.Time) {
+	if d.Reload != nil {
+		if err := d.Reload(); err != nil {
+			d.Log.Printf("reloading the vault: %v", err)
+			return
+		}
+	}
+	schedules, err := d.Store.GetAllSchedules()
+	if err != nil {
+		d.Log.Printf("reading schedules: %v", err)
+		return
+	}
+	for _, sc := range schedules {
+		c, err := Parse(sc.Spec)
+		if err != nil {
+			d.Log.Printf("schedule %d: %v", sc.ID, err)
+			continue
+		}
+		due, at, missed := Due(sc, c, now)
+		if !due {
+			continue
+		}
+		if err := d.Store.SetScheduleLastRun(sc.ID, at); err != nil {
+			d.Log.Printf("schedule %d: %v", sc.ID, err)
+			continue
+		}
+		if missed && sc.CatchUp != models.CatchUpOnce {
+			d.Log.Printf("schedule %d (%s): skipped run missed at %s", sc.ID, sc.CommandName, at.Format("2006-01-02 15:04"))
+			continue
+		}
+		d.start(sc, missed)
+	}
+}
+
+// start runs the command of sc in the background unless it is already running.
+func (d *Daemon) start(sc models.Schedule, catchUp bool) {
+	cmd, err := d.Store.GetByID(sc.CommandID)
+	if err != nil {
+		d.Log.Printf("schedule %d: %v", sc.ID, err)
+		return
+	}
+	if cmd == nil {
+		d.Log.Printf("schedule %d: command %s is in the trash or gone, not running", sc.ID, sc.CommandName)
+		return
+	}
+
+	d.mu.Lock()
+	if d.running[cmd.ID] {
+		d.mu.Unlock()
+		d.Log.Printf("schedule %d (%s): previous run still in progress, skipping", sc.ID, cmd.Name)
+		return
+	}
+	d.running[cmd.ID] = true
+	d.mu.Unlock()
+
+	if catchUp {
+		d.Log.Printf("schedule %d (%s): catching up on a missed run", sc.ID, cmd.Name)
+	} else {
+		d.Log.Printf("schedule %d (%s): starting", sc.ID, cmd.Name)
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() {
+			d.mu.Lock()
+			delete(d.running, cmd.ID)
+			d.mu.Unlock()
+		}()
+		r := d.execute(cmd, sc.Dir, runner.Environ(d.Profile, cmd.Env))
+		r.Output = d.Redactor.Redact(r.Output)
+		r.Error = d.Redactor.Redact(r.Error)
+		if err := d.Store.InsertRun(r); err != nil {
+			d.Log.Printf("schedule %d (%s): recording run: %v", sc.ID, cmd.Name, err)
+		}
+		if r.Error != "" {
+			d.Log.Printf("schedule %d (%s): failed after %s: %s", sc.ID, cmd.Name, r.Duration.Round(time.Millisecond), r.Error)
+		} else {
+			d.Log.Printf("schedule %d (%s): ok after %s", sc.ID, cmd.Name, r.Duration.Round(time.Millisecond))
+		}
+		_ = d.Store.IncrementUsage(cmd.ID)
+	}()
+}
+
+// resolve turns the secret references of body into environment variables
+// of interpreter and returns the variables to add.
+func (d *Daemon) resolve(body, interpreter string) (string, []string, error) {
+	if len(runner.SecretRefs(body)) == 0 {
+		return body, nil, nil
+	}
+	if d.Secrets == nil {
+		return "", nil, errors.New("the command uses secrets but none are stored")
+	}
+	return runner.ResolveSecrets(body, interpreter, d.Secrets)
+}
+
+// execute runs c in dir with env and returns the run to record.
+func (d *Daemon) execute(c *models.Command, dir string, env []string) *models.Run {
+	r := &models.Run{CommandID: c.ID, CommandName: c.Name, Source: "schedule", StartedAt: time.Now()}
+	body, secretVars, err := d.resolve(c.CommandStr, c.Interpreter)
+	if err != nil {
+		r.ExitCode = -1
+		r.Error = err.Error()
+		return r
+	}
+	script, err := runner.Prepare(body, c.Interpreter, dir, runner.WithEnv(env, secretVars))
+	if err != nil {
+		r.ExitCode = -1
+		r.Error = err.Error()
+		return r
+	}
+	defer script.Cleanup()
+	var out bytes.Buffer
+	script.Cmd.Stdout = &out
+	script.Cmd.Stderr = &out
+	err = script.Cmd.Run()
+	r.Duration = time.Since(r.StartedAt)
+	r.ExitCode = runner.ExitCode(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.Output = out.String()
+	if len(r.Output) > maxOutput {
+		r.Output = "...\n" + r.Output[len(r.Output)-maxOutput:]
+	}
+	return r
+}
@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+func TestDue(t *testing.T) {
+	hourly, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m, s int) time.Time {
+		return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second)
+	}
+	tests := []struct {
+		name             string
+		created, lastRun time.Time
+		now              time.Time
+		due              bool
+		at               time.Time
+		missed           bool
+	}{
+		{name: "not yet", created: at(10, 0, 0), now: at(10, 30, 0)},
+		{name: "first run from creation", created: at(10, 5, 0), now: at(11, 0, 30), due: true, at: at(11, 0, 0)},
+		{name: "late within grace", created: at(10, 5, 0), now: at(11, 2, 0), due: true, at: at(11, 0, 0)},
+		{name: "late beyond grace", created: at(10, 5, 0), now: at(11, 2, 1), due: true, at: at(11, 0, 0), missed: true},
+		{name: "already ran", created: at(1, 0, 0), lastRun: at(11, 0, 0), now: at(11, 30, 0)},
+		{name: "next after last run", created: at(1, 0, 0), lastRun: at(11, 0, 0), now: at(12, 0, 10), due: true, at: at(12, 0, 0)},
+		{name: "missed runs collapse into the latest", created: at(1, 0, 0), lastRun: at(8, 0, 0), now: at(11, 30, 0), due: true, at: at(11, 0, 0), missed: true},
+		{name: "latest of several is on time", created: at(1, 0, 0), lastRun: at(8, 0, 0), now: at(11, 1, 0), due: true, at: at(11, 0, 0)},
+	}
+	for _, tt := range tests {
+		sc := models.Schedule{CreatedAt: tt.created, LastRun: tt.lastRun}
+		due, at, missed := Due(sc, hourly, tt.now)
+		if due != tt.due || !at.Equal(tt.at) || missed != tt.missed {
+			t.Errorf("%s: Due = %v, %s, %v; want %v, %s, %v", tt.name, due, at.Format(time.TimeOnly), missed, tt.due, tt.at.Format(time.TimeOnly), tt.missed)
+		}
+	}
+}
+
+func TestCheckCatchUp(t *testing.T) {
+	store := storage.NewMemory()
+	// Half past the hour, so that the latest missed run is beyond Grace.
+	wall := time.Now()
+	now := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), 30, 0, 0, time.Local)
+	lastRun := now.Add(-3 * time.Hour) // an hourly schedule missed two runs
+	schedules := map[string]int{}
+	for _, policy := range []string{models.CatchUpSkip, models.CatchUpOnce} {
+		id, err := store.InsertCommand(&models.Command{Name: policy, CommandStr: "echo " + policy, Note: "runs hourly", CreatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sid, err := store.InsertSchedule(&models.Schedule{CommandID: int(id), Spec: "@hourly", Dir: t.TempDir(), CatchUp: policy, CreatedAt: lastRun})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetScheduleLastRun(int(sid), lastRun); err != nil {
+			t.Fatal(err)
+		}
+		schedules[policy] = int(id)
+	}
+
+	reloaded := false
+	d := &Daemon{Store: store, Reload: func() error { reloaded = true; return nil }, Log: log.New(io.Discard, "", 0), running: map[int]bool{}}
+	d.check(now)
+	d.wg.Wait()
+	if !reloaded {
+		t.Error("check didn't reload the store")
+	}
+
+	all, err := store.GetAllSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sc := range all {
+		if !sc.LastRun.After(lastRun) || sc.LastRun.After(now) {
+			t.Errorf("%s: last run %s, want the latest missed time", sc.CatchUp, sc.LastRun)
+		}
+	}
+	if runs, _ := store.Runs(schedules[models.CatchUpSkip], 10); len(runs) != 0 {
+		t.Errorf("catch-up skip ran %d times", len(runs))
+	}
+	runs, err := store.Runs(schedules[models.CatchUpOnce], 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || strings.TrimSpace(runs[0].Output) != "once" || runs[0].Source != "schedule" {
+		t.Fatalf("catch-up once recorded %+v, want one run", runs)
+	}
+
+	// The missed runs are now accounted for.
+	d.check(now)
+	d.wg.Wait()
+	if runs, _ := store.Runs(schedules[models.CatchUpOnce], 10); len(runs) != 1 {
+		t.Errorf("checking again ran the command again: %d runs", len(runs))
+	}
+}
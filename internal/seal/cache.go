@@ -0,0 +1,114 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SessionTTL is how long an unlocked key stays cached for the session.
+const SessionTTL = 15 * time.Minute
+
+// cacheDir returns where keys are cached, or "" when there is no place that
+// is private to the login session. $XDG_RUNTIME_DIR is owned by the user,
+// kept in memory and removed at logout.
+func cacheDir() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "cmd-vault")
+}
+
+func cachePath(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(cacheDir(), hex.EncodeToString(sum[:8])+".key")
+}
+
+// CachedKey returns the key cached for id, provided it was cached less than
+// SessionTTL ago for the same salt.
+func CachedKey(id string, salt []byte) *Key {
+	if cacheDir() == "" {
+		return nil
+	}
+	path := cachePath(id)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if expired(info) {
+		os.Remove(path)
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) != len(salt)+KeySize || !bytes.Equal(data[:len(salt)], salt) {
+		return nil
+	}
+	k, err := KeyFromBytes(data[len(salt):])
+	if err != nil {
+		return nil
+	}
+	return k
+}
+
+func expired(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) > SessionTTL
+}
+
+// CacheKey remembers k for id and salt for SessionTTL from now. It does
+// nothing on systems without a session directory.
+func CacheKey(id string, salt []byte, k *Key) error {
+	dir := cacheDir()
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(cachePath(id), append(append([]byte(nil), salt...), k.Bytes()...), 0o600)
+}
+
+// ForgetKey removes the cached key of id.
+func ForgetKey(id string) error {
+	if cacheDir() == "" {
+		return nil
+	}
+	err := os.Remove(cachePath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ForgetExpiredKeys removes the keys cached longer than SessionTTL ago,
+// which CachedKey would otherwise only remove when it is next asked for
+// them.
+func ForgetExpiredKeys() error {
+	dir := cacheDir()
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".key" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !expired(info) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
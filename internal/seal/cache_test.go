@@ -0,0 +1,117 @@
+package seal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	k := testKey(t, "pw", []byte("salt"))
+	if CachedKey("vault", []byte("salt")) != nil {
+		t.Fatal("a key is cached before CacheKey")
+	}
+	if err := CacheKey("vault", []byte("salt"), k); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(cachePath("vault"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		t.Errorf("cached key mode %v is readable by others", perm)
+	}
+	if got := CachedKey("vault", []byte("salt")); got == nil || !bytes.Equal(got.Bytes(), k.Bytes()) {
+		t.Error("CachedKey didn't return the cached key")
+	}
+	// The vault was rekeyed, or it is another vault.
+	if CachedKey("vault", []byte("pepper")) != nil {
+		t.Error("CachedKey returned a key cached for another salt")
+	}
+	if CachedKey("other", []byte("salt")) != nil {
+		t.Error("CachedKey returned the key of another vault")
+	}
+
+	// Reading the key doesn't keep it any longer.
+	old := time.Now().Add(-SessionTTL - time.Minute)
+	if err := os.Chtimes(cachePath("vault"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if CachedKey("vault", []byte("salt")) != nil {
+		t.Error("CachedKey returned an expired key")
+	}
+	if _, err := os.Stat(cachePath("vault")); !os.IsNotExist(err) {
+		t.Errorf("the expired key is still on disk: %v", err)
+	}
+
+	if err := CacheKey("vault", []byte("salt"), k); err != nil {
+		t.Fatal(err)
+	}
+	if err := ForgetKey("vault"); err != nil {
+		t.Fatal(err)
+	}
+	if CachedKey("vault", []byte("salt")) != nil {
+		t.Error("the key is still cached after ForgetKey")
+	}
+	if err := ForgetKey("vault"); err != nil {
+		t.Errorf("ForgetKey of a key that isn't cached: %v", err)
+	}
+}
+
+func TestForgetExpiredKeys(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if err := ForgetExpiredKeys(); err != nil {
+		t.Fatalf("ForgetExpiredKeys without a cache: %v", err)
+	}
+	k := testKey(t, "pw", []byte("salt"))
+	for _, id := range []string{"fresh", "stale"} {
+		if err := CacheKey(id, []byte("salt"), k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-SessionTTL - time.Minute)
+	if err := os.Chtimes(cachePath("stale"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(cacheDir(), "notes.txt")
+	if err := os.WriteFile(other, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(other, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ForgetExpiredKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath("stale")); !os.IsNotExist(err) {
+		t.Errorf("the expired key is still on disk: %v", err)
+	}
+	if CachedKey("fresh", []byte("salt")) == nil {
+		t.Error("ForgetExpiredKeys removed a key that hadn't expired")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("ForgetExpiredKeys removed a file that isn't a key: %v", err)
+	}
+}
+
+func TestCacheWithoutSession(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	k := testKey(t, "pw", []byte("salt"))
+	if err := CacheKey("vault", []byte("salt"), k); err != nil {
+		t.Fatal(err)
+	}
+	if CachedKey("vault", []byte("salt")) != nil {
+		t.Error("a key was cached without a session directory")
+	}
+	if err := ForgetKey("vault"); err != nil {
+		t.Error(err)
+	}
+	if err := ForgetExpiredKeys(); err != nil {
+		t.Error(err)
+	}
+}
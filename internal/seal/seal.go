@@ -0,0 +1,106 @@
+// Package seal encrypts data with AES-256-GCM under keys derived from a
+// passphrase. It backs both the secrets store and encrypted vault files.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// kdfIterations is the PBKDF2-SHA256 work factor for turning a passphrase
+// into a key.
+const kdfIterations = 600_000
+
+// SaltSize is the length of the salts made by NewSalt.
+const SaltSize = 16
+
+// ErrWrongPassphrase is returned when data doesn't decrypt with a key,
+// which almost always means the passphrase was mistyped.
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// KeySize is the length of a raw key in bytes.
+const KeySize = 32
+
+// Key encrypts and decrypts with AES-256-GCM.
+type Key struct {
+	raw  []byte
+	aead cipher.AEAD
+}
+
+// NewSalt returns random salt for DeriveKey.
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// DeriveKey derives the key for passphrase and salt.
+func DeriveKey(passphrase string, salt []byte) (*Key, error) {
+	raw, err := pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return KeyFromBytes(raw)
+}
+
+// KeyFromBytes rebuilds a key from the bytes returned by Bytes.
+func KeyFromBytes(raw []byte) (*Key, error) {
+	if len(raw) != KeySize {
+		return nil, errors.New("invalid key length")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{raw: raw, aead: aead}, nil
+}
+
+// Bytes returns the raw key, e.g. to cache it for the session.
+func (k *Key) Bytes() []byte {
+	return k.raw
+}
+
+// Seal encrypts plaintext under a fresh random nonce, which is prepended to
+// the result.
+func (k *Key) Seal(plaintext []byte) ([]byte, error) {
+	return k.SealWith(plaintext, nil)
+}
+
+// SealWith is Seal with additional data, which isn't stored in the result
+// but has to be given again to OpenWith. It ties the result to where it is
+// kept, so that it can't be moved elsewhere unnoticed.
+func (k *Key) SealWith(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts data produced by Seal.
+func (k *Key) Open(data []byte) ([]byte, error) {
+	return k.OpenWith(data, nil)
+}
+
+// OpenWith decrypts data produced by SealWith with the same additional data.
+func (k *Key) OpenWith(data, additionalData []byte) ([]byte, error) {
+	n := k.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("encrypted value is truncated")
+	}
+	plaintext, err := k.aead.Open(nil, data[:n], data[n:], additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
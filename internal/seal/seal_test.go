@@ -0,0 +1,90 @@
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testKey(t *testing.T, passphrase string, salt []byte) *Key {
+	t.Helper()
+	k, err := DeriveKey(passphrase, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := testKey(t, "pw", salt)
+	a, err := k.Seal([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := k.Seal([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, b) {
+		t.Error("Seal reused a nonce")
+	}
+	if got, err := k.Open(a); err != nil || string(got) != "hello" {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+
+	// The same passphrase and salt give the same key.
+	if got, err := testKey(t, "pw", salt).Open(a); err != nil || string(got) != "hello" {
+		t.Errorf("Open with the key derived again = %q, %v", got, err)
+	}
+	if _, err := testKey(t, "other", salt).Open(a); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Open with another passphrase = %v", err)
+	}
+	a[len(a)-1] ^= 1
+	if _, err := k.Open(a); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Open of altered data = %v", err)
+	}
+	if _, err := k.Open(a[:4]); err == nil {
+		t.Error("Open accepted truncated data")
+	}
+}
+
+func TestKeyFromBytes(t *testing.T) {
+	k := testKey(t, "pw", []byte("salt"))
+	again, err := KeyFromBytes(k.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := k.Seal([]byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := again.Open(data); err != nil || string(got) != "x" {
+		t.Errorf("Open with the rebuilt key = %q, %v", got, err)
+	}
+	if _, err := KeyFromBytes(k.Bytes()[:16]); err == nil {
+		t.Error("KeyFromBytes accepted a short key")
+	}
+}
+
+func TestAdditionalData(t *testing.T) {
+	k := testKey(t, "pw", []byte("salt"))
+	data, err := k.SealWith([]byte("v"), []byte("name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.OpenWith(data, []byte("name")); err != nil || string(got) != "v" {
+		t.Errorf("OpenWith = %q, %v", got, err)
+	}
+	for _, ad := range [][]byte{nil, []byte("other")} {
+		if _, err := k.OpenWith(data, ad); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("OpenWith(%q) = %v", ad, err)
+		}
+	}
+	if _, err := k.Open(data); err == nil {
+		t.Error("Open ignored the additional data")
+	}
+}
@@ -0,0 +1,152 @@
+package secrets
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// PassphraseEnv names the environment variable that can hold the passphrase
+// instead of typing it, e.g. for the scheduler daemon.
+const PassphraseEnv = "CMD_VAULT_PASSPHRASE"
+
+// verifierText is encrypted with the key when it is created, so that a
+// wrong passphrase is reported right away instead of as garbled secrets.
+const verifierText = "cmd-vault secrets"
+
+var validName = regexp.MustCompile(`^[A-Za-z_][\w.-]*$`)
+
+// Vault reads and writes the secrets of a store with an unlocked key.
+type Vault struct {
+	store storage.SecretStore
+	key   *seal.Key
+}
+
+// Initialized reports whether store already has a secrets key, that is
+// whether the passphrase was chosen before.
+func Initialized(store storage.SecretStore) (bool, error) {
+	salt, _, err := store.SecretKey()
+	return salt != nil, err
+}
+
+// Unlock derives the key from passphrase and checks it against store. The
+// first unlock of a store sets its passphrase.
+func Unlock(store storage.SecretStore, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("the passphrase can't be empty")
+	}
+	salt, verifier, err := store.SecretKey()
+	if err != nil {
+		return nil, err
+	}
+	if salt == nil {
+		if salt, err = seal.NewSalt(); err != nil {
+			return nil, err
+		}
+		key, err := seal.DeriveKey(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		if verifier, err = key.Seal([]byte(verifierText)); err != nil {
+			return nil, err
+		}
+		if err := store.SetSecretKey(salt, verifier); err != nil {
+			return nil, err
+		}
+		return &Vault{store: store, key: key}, nil
+	}
+	key, err := seal.DeriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := key.Open(verifier); err != nil {
+		return nil, err
+	}
+	v := &Vault{store: store, key: key}
+	if err := v.bindNames(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// bindNames encrypts again the secrets stored by versions of cmd-vault that
+// didn't tie values to their names.
+func (v *Vault) bindNames() error {
+	list, err := v.store.Secrets()
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		data, err := v.store.SecretValue(s.Name)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		if _, err := v.key.OpenWith(data, []byte(s.Name)); err == nil {
+			continue
+		}
+		plaintext, err := v.key.Open(data)
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", s.Name, err)
+		}
+		if err := v.put(s.Name, string(plaintext)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the named secret.
+func (v *Vault) Get(name string) (string, error) {
+	data, err := v.store.SecretValue(name)
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		return "", fmt.Errorf("no secret named %s", name)
+	}
+	// The name is the additional data, so that a value copied under
+	// another name doesn't decrypt.
+	plaintext, err := v.key.OpenWith(data, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	return string(plaintext), nil
+}
+
+// Values decrypts every stored secret, e.g. to mask them in output.
+func (v *Vault) Values() ([]string, error) {
+	list, err := v.store.Secrets()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(list))
+	for _, s := range list {
+		value, err := v.Get(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Set encrypts value and stores it under name.
+func (v *Vault) Set(name, value string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	return v.put(name, value)
+}
+
+func (v *Vault) put(name, value string) error {
+	data, err := v.key.SealWith([]byte(value), []byte(name))
+	if err != nil {
+		return err
+	}
+	return v.store.PutSecret(name, data)
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/kanekitakitos/cmd-vault/internal/seal"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+func TestUnlock(t *testing.T) {
+	store := storage.NewMemory()
+	if ok, err := Initialized(store); err != nil || ok {
+		t.Fatalf("Initialized = %v, %v before the first unlock", ok, err)
+	}
+	if _, err := Unlock(store, ""); err == nil {
+		t.Error("Unlock accepted an empty passphrase")
+	}
+	v, err := Unlock(store, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Initialized(store); err != nil || !ok {
+		t.Errorf("Initialized = %v, %v after the first unlock", ok, err)
+	}
+	if err := v.Set("token", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Unlock(store, "wrong"); !errors.Is(err, seal.ErrWrongPassphrase) {
+		t.Errorf("Unlock with a wrong passphrase = %v", err)
+	}
+	again, err := Unlock(store, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := again.Get("token"); err != nil || got != "s3cr3t" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	v, err := Unlock(storage.NewMemory(), "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "1token", "a b", "a/b"} {
+		if err := v.Set(name, "x"); err == nil {
+			t.Errorf("Set accepted the name %q", name)
+		}
+	}
+	for name, value := range map[string]string{"github-token": "ghp_1", "db.password": "p@ss w0rd", "_empty": ""} {
+		if err := v.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := v.Get("db.password"); err != nil || got != "p@ss w0rd" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if _, err := v.Get("missing"); err == nil {
+		t.Error("Get of a missing secret succeeded")
+	}
+	values, err := v.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(values)
+	if want := []string{"", "ghp_1", "p@ss w0rd"}; !slices.Equal(values, want) {
+		t.Errorf("Values = %q, want %q", values, want)
+	}
+}
+
+func TestValueBoundToName(t *testing.T) {
+	store := storage.NewMemory()
+	v, err := Unlock(store, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("prod", "prod-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("dev", "dev-token"); err != nil {
+		t.Fatal(err)
+	}
+	// Someone with write access to the vault file copies the value of one
+	// secret over another.
+	data, err := store.SecretValue("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutSecret("dev", data); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := v.Get("dev"); !errors.Is(err, seal.ErrWrongPassphrase) {
+		t.Errorf("Get of a moved value = %q, %v", got, err)
+	}
+}
+
+func TestUnlockBindsOldValues(t *testing.T) {
+	store := storage.NewMemory()
+	v, err := Unlock(store, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stored without additional data, as older versions did.
+	data, err := v.key.Seal([]byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutSecret("legacy", data); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err = Unlock(store, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := v.Get("legacy"); err != nil || got != "old" {
+		t.Errorf("Get = %q, %v after unlocking", got, err)
+	}
+	if data, _ := store.SecretValue("legacy"); data == nil {
+		t.Error("the secret is gone")
+	} else if _, err := v.key.Open(data); err == nil {
+		t.Error("the secret still decrypts without its name")
+	}
+}
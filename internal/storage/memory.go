@@ -0,0 +1,1101 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// Memory is a Store that keeps the vault in memory, for tests and for
+// backends that load and save the whole vault at once. It behaves like the
+// SQLite store, journal and version history included.
+type Memory struct {
+	mu sync.Mutex
+
+	commands   map[int]*models.Command // live and trashed
+	aliases    map[string]int          // alias -> command id
+	versions   []VersionRecord
+	operations []OperationRecord
+	runs       []models.Run
+	playbooks  []models.Playbook
+	schedules  []models.Schedule
+	profiles   []models.EnvProfile
+	secrets    map[string]*SecretRecord
+	salt       []byte
+	verifier   []byte
+}
+
+// VersionRecord is one recorded version of a command.
+type VersionRecord struct {
+	ID        int
+	Command   models.Command
+	CreatedAt time.Time
+}
+
+// OperationRecord is a journal entry with the changes needed to undo or
+// redo it.
+type OperationRecord struct {
+	Operation
+	Changes []Change
+}
+
+// Change is the state of one command before and after an operation.
+// A nil state means the command did not exist.
+type Change struct {
+	ID     int
+	Before *models.Command `json:",omitempty"`
+	After  *models.Command `json:",omitempty"`
+}
+
+// SecretRecord is a secret with its encrypted value.
+type SecretRecord struct {
+	models.Secret
+	Value []byte
+}
+
+// Snapshot is the whole content of a Memory store.
+type Snapshot struct {
+	Commands       []models.Command // live and trashed, by id
+	Aliases        map[string]int   // alias -> command id
+	Versions       []VersionRecord
+	Operations     []OperationRecord
+	Runs           []models.Run
+	Playbooks      []models.Playbook
+	Schedules      []models.Schedule
+	Profiles       []models.EnvProfile
+	Secrets        []SecretRecord
+	SecretSalt     []byte
+	SecretVerifier []byte
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		commands: map[int]*models.Command{},
+		aliases:  map[string]int{},
+		secrets:  map[string]*SecretRecord{},
+	}
+}
+
+// LoadMemory returns an in-memory store holding the content of snap.
+func LoadMemory(snap Snapshot) *Memory {
+	m := NewMemory()
+	m.Load(snap)
+	return m
+}
+
+// Load replaces everything in the store with the content of snap.
+func (m *Memory) Load(snap Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = map[int]*models.Command{}
+	m.aliases = map[string]int{}
+	m.secrets = map[string]*SecretRecord{}
+	for i := range snap.Commands {
+		m.commands[snap.Commands[i].ID] = clone(&snap.Commands[i])
+	}
+	for alias, id := range snap.Aliases {
+		m.aliases[alias] = id
+	}
+	m.versions = slices.Clone(snap.Versions)
+	m.operations = slices.Clone(snap.Operations)
+	m.runs = slices.Clone(snap.Runs)
+	m.playbooks = slices.Clone(snap.Playbooks)
+	m.schedules = slices.Clone(snap.Schedules)
+	m.profiles = slices.Clone(snap.Profiles)
+	for _, sec := range snap.Secrets {
+		sec.Value = slices.Clone(sec.Value)
+		m.secrets[sec.Name] = &sec
+	}
+	m.salt, m.verifier = slices.Clone(snap.SecretSalt), slices.Clone(snap.SecretVerifier)
+}
+
+// Snapshot returns a copy of everything in the store.
+func (m *Memory) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := Snapshot{
+		Aliases:        maps.Clone(m.aliases),
+		Versions:       slices.Clone(m.versions),
+		Operations:     slices.Clone(m.operations),
+		Runs:           slices.Clone(m.runs),
+		Playbooks:      slices.Clone(m.playbooks),
+		Schedules:      slices.Clone(m.schedules),
+		Profiles:       slices.Clone(m.profiles),
+		SecretSalt:     slices.Clone(m.salt),
+		SecretVerifier: slices.Clone(m.verifier),
+	}
+	for _, c := range m.commands {
+		snap.Commands = append(snap.Commands, *clone(c))
+	}
+	sort.Slice(snap.Commands, func(i, j int) bool { return snap.Commands[i].ID < snap.Commands[j].ID })
+	for _, sec := range m.secrets {
+		snap.Secrets = append(snap.Secrets, *sec)
+	}
+	sort.Slice(snap.Secrets, func(i, j int) bool { return snap.Secrets[i].Name < snap.Secrets[j].Name })
+	return snap
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// nextID returns the id for a new item of a list, one past the highest id
+// in it, as SQLite numbers the rows of a table.
+func nextID[T any](items []T, id func(T) int) int {
+	last := 0
+	for _, item := range items {
+		last = max(last, id(item))
+	}
+	return last + 1
+}
+
+// NextCommandID returns the id for a new command of snap.
+func (snap *Snapshot) NextCommandID() int {
+	return nextID(snap.Commands, func(c models.Command) int { return c.ID })
+}
+
+// NextVersionID returns the id for a new version record of snap.
+func (snap *Snapshot) NextVersionID() int {
+	return nextID(snap.Versions, func(v VersionRecord) int { return v.ID })
+}
+
+// clone copies c so that callers never share slices with the store.
+func clone(c *models.Command) *models.Command {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	cp.Tags = slices.Clone(c.Tags)
+	cp.Env = slices.Clone(c.Env)
+	cp.Aliases = slices.Clone(c.Aliases)
+	return &cp
+}
+
+// out copies c for a caller, with its aliases filled in.
+func (m *Memory) out(c *models.Command) *models.Command {
+	if c == nil {
+		return nil
+	}
+	cp := clone(c)
+	cp.Aliases = nil
+	for alias, id := range m.aliases {
+		if id == c.ID {
+			cp.Aliases = append(cp.Aliases, alias)
+		}
+	}
+	sort.Strings(cp.Aliases)
+	return cp
+}
+
+// aliasOwner returns the command other than id that has alias, or nil.
+func (m *Memory) aliasOwner(alias string, id int) *models.Command {
+	if owner, ok := m.aliases[alias]; ok && owner != id {
+		return m.commands[owner]
+	}
+	return nil
+}
+
+// live returns the live command with the given name, or nil.
+func (m *Memory) live(name string) *models.Command {
+	for _, c := range m.commands {
+		if c.Name == name && c.DeletedAt.IsZero() {
+			return c
+		}
+	}
+	return nil
+}
+
+// list returns copies of the commands keep accepts, newest first.
+func (m *Memory) list(keep func(c *models.Command) bool, newer func(a, b *models.Command) bool) []models.Command {
+	var cs []*models.Command
+	for _, c := range m.commands {
+		if keep(c) {
+			cs = append(cs, c)
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return newer(cs[i], cs[j]) })
+	var out []models.Command
+	for _, c := range cs {
+		out = append(out, *m.out(c))
+	}
+	return out
+}
+
+func newerCreated(a, b *models.Command) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+func newerDeleted(a, b *models.Command) bool {
+	if !a.DeletedAt.Equal(b.DeletedAt) {
+		return a.DeletedAt.After(b.DeletedAt)
+	}
+	return a.ID > b.ID
+}
+
+func isLive(c *models.Command) bool { return c.DeletedAt.IsZero() }
+
+func isTrashed(c *models.Command) bool { return !c.DeletedAt.IsZero() }
+
+// Matches reports whether the name, note, body, tags or aliases of c contain
+// query, ignoring case. It is the search rule every backend follows.
+func Matches(c *models.Command, query string) bool {
+	q := strings.ToLower(query)
+	for _, field := range []string{c.Name, c.Note, c.CommandStr, strings.Join(c.Tags, ","), strings.Join(c.Aliases, ",")} {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) InsertCommand(c *models.Command) (int64, error) {
+	ids, err := m.InsertCommands([]*models.Command{c})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// InsertCommands adds several commands as a single undoable operation.
+func (m *Memory) InsertCommands(cs []*models.Command) ([]int64, error) {
+	return m.ApplyBatch("add", Batch{Insert: cs})
+}
+
+// ApplyBatch makes the changes of b as a single undoable operation. They are
+// all checked before any is made, as there is no transaction to roll back.
+func (m *Memory) ApplyBatch(kind string, b Batch) ([]int64, error) {
+	for _, c := range b.Update {
+		if c == nil {
+			return nil, errors.New("nil command")
+		}
+		c.Normalize()
+	}
+	for _, c := range b.Insert {
+		c.Normalize()
+		if c.Name == "" {
+			return nil, errors.New("name is required")
+		}
+		if c.Note == "" {
+			return nil, errors.New("note is required")
+		}
+	}
+	var ids []int
+	for _, c := range b.Update {
+		ids = append(ids, c.ID)
+	}
+	ids = append(ids, b.Delete...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var inserted []int64
+	err := m.journaled(kind, ids, func() ([]int, error) {
+		if err := m.checkBatch(b); err != nil {
+			return nil, err
+		}
+		touched := slices.Clone(ids)
+		for _, c := range b.Update {
+			if current := m.commands[c.ID]; current != nil {
+				setFields(current, c)
+			}
+		}
+		now := time.Now()
+		for _, id := range b.Delete {
+			if c := m.commands[id]; c != nil && isLive(c) {
+				c.DeletedAt = now
+			}
+		}
+		for _, c := range b.Insert {
+			id := nextID(slices.Collect(maps.Keys(m.commands)), func(id int) int { return id })
+			stored := clone(c)
+			stored.ID = id
+			stored.Aliases = nil
+			stored.DeletedAt = time.Time{}
+			m.commands[id] = stored
+			inserted = append(inserted, int64(id))
+			touched = append(touched, id)
+		}
+		return touched, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// checkBatch returns the error of the first change of b that can't be made
+// after the ones before it.
+func (m *Memory) checkBatch(b Batch) error {
+	// live maps the names of the live commands to their ids as the changes
+	// are made.
+	live := map[string]int{}
+	for id, c := range m.commands {
+		if isLive(c) {
+			live[c.Name] = id
+		}
+	}
+	for _, c := range b.Update {
+		current := m.commands[c.ID]
+		if current == nil {
+			continue
+		}
+		if isLive(current) {
+			if other, ok := live[c.Name]; ok && other != c.ID {
+				return fmt.Errorf("a command named %s already exists", c.Name)
+			}
+			delete(live, current.Name)
+			live[c.Name] = c.ID
+		}
+		if owner := m.aliasOwner(c.Name, c.ID); owner != nil {
+			return fmt.Errorf("%s is an alias of %s", c.Name, owner.Name)
+		}
+	}
+	for _, id := range b.Delete {
+		maps.DeleteFunc(live, func(_ string, owner int) bool { return owner == id })
+	}
+	for _, c := range b.Insert {
+		if _, ok := live[c.Name]; ok {
+			return fmt.Errorf("a command named %s already exists", c.Name)
+		}
+		if owner := m.aliasOwner(c.Name, 0); owner != nil {
+			return fmt.Errorf("%s is an alias of %s", c.Name, owner.Name)
+		}
+		live[c.Name] = 0
+	}
+	return nil
+}
+
+// setFields copies the editable fields of c to current.
+func setFields(current, c *models.Command) {
+	current.Name, current.CommandStr, current.Note = c.Name, c.CommandStr, c.Note
+	current.Interpreter = c.Interpreter
+	current.Tags = slices.Clone(c.Tags)
+	current.Env = slices.Clone(c.Env)
+	current.UsageCount = c.UsageCount
+}
+
+func (m *Memory) GetAllCommands() ([]models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(isLive, newerCreated), nil
+}
+
+func (m *Memory) SearchCommands(query string) ([]models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	commands := m.list(isLive, newerCreated)
+	return slices.DeleteFunc(commands, func(c models.Command) bool { return !Matches(&c, query) }), nil
+}
+
+func (m *Memory) GetByName(name string) (*models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.out(m.live(name)), nil
+}
+
+func (m *Memory) GetByAlias(alias string) (*models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.aliases[alias]; ok {
+		if c := m.commands[id]; c != nil && isLive(c) {
+			return m.out(c), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetByID(id int) (*models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.commands[id]; c != nil && isLive(c) {
+		return m.out(c), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) UpdateCommand(c *models.Command) error {
+	if c == nil {
+		return errors.New("nil command")
+	}
+	c.Normalize()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.journaled("edit", []int{c.ID}, func() ([]int, error) {
+		current := m.commands[c.ID]
+		if current == nil {
+			return []int{c.ID}, nil
+		}
+		if other := m.live(c.Name); other != nil && other.ID != c.ID && isLive(current) {
+			return nil, fmt.Errorf("a command named %s already exists", c.Name)
+		}
+		if owner := m.aliasOwner(c.Name, c.ID); owner != nil {
+			return nil, fmt.Errorf("%s is an alias of %s", c.Name, owner.Name)
+		}
+		setFields(current, c)
+		return []int{c.ID}, nil
+	})
+}
+
+func (m *Memory) DeleteCommand(id int) error {
+	return m.DeleteCommands([]int{id})
+}
+
+// DeleteCommands moves several commands to the trash as a single undoable operation.
+func (m *Memory) DeleteCommands(ids []int) error {
+	_, err := m.ApplyBatch("delete", Batch{Delete: ids})
+	return err
+}
+
+func (m *Memory) IncrementUsage(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.commands[id]; c != nil {
+		c.UsageCount++
+	}
+	return nil
+}
+
+func (m *Memory) SetAliases(id int, aliases []string) error {
+	for _, a := range aliases {
+		if err := models.CheckAlias(a); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.commands[id]; c == nil || !isLive(c) {
+		return fmt.Errorf("command %d does not exist", id)
+	}
+	for _, a := range aliases {
+		if m.live(a) != nil {
+			return fmt.Errorf("a command named %s already exists", a)
+		}
+		if owner := m.aliasOwner(a, id); owner != nil {
+			return fmt.Errorf("alias %s is already used by %s", a, owner.Name)
+		}
+	}
+	maps.DeleteFunc(m.aliases, func(_ string, owner int) bool { return owner == id })
+	for _, a := range aliases {
+		m.aliases[a] = id
+	}
+	return nil
+}
+
+func (m *Memory) SetPinned(id int, pinned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.commands[id]; c != nil {
+		c.PinnedAt = time.Time{}
+		if pinned {
+			c.PinnedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+// journaled runs fn and records the state of every command it touched as a
+// single operation, like the SQLite store does. fn must check for errors
+// before it changes anything, as there is no transaction to roll back.
+func (m *Memory) journaled(kind string, ids []int, fn func() ([]int, error)) error {
+	before := map[int]*models.Command{}
+	for _, id := range ids {
+		before[id] = clone(m.commands[id])
+	}
+	touched, err := fn()
+	if err != nil {
+		return err
+	}
+	var changes []Change
+	var names []string
+	for _, id := range touched {
+		ch := Change{ID: id, Before: before[id], After: clone(m.commands[id])}
+		if ch.Before == nil && ch.After == nil {
+			continue
+		}
+		changes = append(changes, ch)
+		if ch.After != nil {
+			m.recordVersion(ch.After)
+			names = append(names, ch.After.Name)
+		} else {
+			names = append(names, ch.Before.Name)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	// A new operation drops the redo history it invalidates.
+	kept := m.operations[:0]
+	for _, o := range m.operations {
+		if !o.Undone {
+			kept = append(kept, o)
+		}
+	}
+	m.operations = append(kept, OperationRecord{
+		Operation: Operation{ID: nextID(kept, func(o OperationRecord) int { return o.ID }), Kind: kind, Label: kind + " " + strings.Join(names, ", "), CreatedAt: time.Now()},
+		Changes:   changes,
+	})
+	if n := len(m.operations); n > JournalSize {
+		m.operations = slices.Clone(m.operations[n-JournalSize:])
+	}
+	return nil
+}
+
+// recordVersion stores the editable fields of c as a new version unless they
+// are the same as the latest recorded version.
+func (m *Memory) recordVersion(c *models.Command) {
+	for i := len(m.versions) - 1; i >= 0; i-- {
+		v := m.versions[i].Command
+		if v.ID != c.ID {
+			continue
+		}
+		if v.Name == c.Name && v.CommandStr == c.CommandStr && v.Note == c.Note && v.Interpreter == c.Interpreter &&
+			slices.Equal(v.Tags, c.Tags) && slices.Equal(v.Env, c.Env) {
+			return
+		}
+		break
+	}
+	v := models.Command{ID: c.ID, Name: c.Name, CommandStr: c.CommandStr, Note: c.Note, Interpreter: c.Interpreter,
+		Tags: slices.Clone(c.Tags), Env: slices.Clone(c.Env)}
+	m.versions = append(m.versions, VersionRecord{ID: nextID(m.versions, func(v VersionRecord) int { return v.ID }), Command: v, CreatedAt: time.Now()})
+}
+
+// Undo reverts the most recent operation that hasn't been undone yet.
+func (m *Memory) Undo() (*Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.operations) - 1; i >= 0; i-- {
+		if !m.operations[i].Undone {
+			return m.replay(&m.operations[i], true)
+		}
+	}
+	return nil, ErrNothingToUndo
+}
+
+// Redo re-applies the most recently undone operation.
+func (m *Memory) Redo() (*Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.operations {
+		if m.operations[i].Undone {
+			return m.replay(&m.operations[i], false)
+		}
+	}
+	return nil, ErrNothingToRedo
+}
+
+func (m *Memory) replay(o *OperationRecord, undo bool) (*Operation, error) {
+	// Check for name clashes first so a failed replay changes nothing.
+	for _, ch := range o.Changes {
+		target := ch.After
+		if undo {
+			target = ch.Before
+		}
+		if target == nil || !isLive(target) {
+			continue
+		}
+		if other := m.live(target.Name); other != nil && other.ID != ch.ID && !o.touches(other.ID) {
+			return nil, fmt.Errorf("cannot restore %q: another command now uses that name", target.Name)
+		}
+	}
+	if undo {
+		for i := len(o.Changes) - 1; i >= 0; i-- {
+			m.restoreState(o.Changes[i].ID, o.Changes[i].Before)
+		}
+	} else {
+		for _, ch := range o.Changes {
+			m.restoreState(ch.ID, ch.After)
+		}
+	}
+	for _, ch := range o.Changes {
+		if c := m.commands[ch.ID]; c != nil {
+			m.recordVersion(c)
+		}
+	}
+	o.Undone = undo
+	op := o.Operation
+	return &op, nil
+}
+
+func (o *OperationRecord) touches(id int) bool {
+	for _, ch := range o.Changes {
+		if ch.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreState puts the command with the given id into state c, removing it
+// when c is nil. The live usage count is kept so undo doesn't lose runs.
+func (m *Memory) restoreState(id int, c *models.Command) {
+	current := m.commands[id]
+	switch {
+	case c == nil:
+		delete(m.commands, id)
+		maps.DeleteFunc(m.aliases, func(_ string, owner int) bool { return owner == id })
+	case current != nil:
+		restored := clone(c)
+		restored.UsageCount = current.UsageCount
+		restored.CreatedAt = current.CreatedAt
+		restored.PinnedAt = current.PinnedAt
+		m.commands[id] = restored
+	default:
+		m.commands[id] = clone(c)
+	}
+}
+
+// Operations lists the journal, newest first.
+func (m *Memory) Operations() ([]Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Operation
+	for i := len(m.operations) - 1; i >= 0; i-- {
+		out = append(out, m.operations[i].Operation)
+	}
+	return out, nil
+}
+
+// Versions lists the recorded versions of a command, newest first.
+func (m *Memory) Versions(commandID int) ([]models.Version, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.Version
+	for i := len(m.versions) - 1; i >= 0; i-- {
+		v := m.versions[i]
+		if v.Command.ID == commandID {
+			out = append(out, models.Version{ID: v.ID, Command: *clone(&v.Command), CreatedAt: v.CreatedAt})
+		}
+	}
+	for i := range out {
+		out[i].Number = len(out) - i
+	}
+	return out, nil
+}
+
+// RollbackCommand restores a command's editable fields from one of its
+// versions. The rollback is itself journaled and recorded as a new version.
+func (m *Memory) RollbackCommand(commandID, versionID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.journaled("rollback", []int{commandID}, func() ([]int, error) {
+		var v *models.Command
+		for i := range m.versions {
+			if m.versions[i].ID == versionID && m.versions[i].Command.ID == commandID {
+				v = &m.versions[i].Command
+			}
+		}
+		if v == nil {
+			return nil, fmt.Errorf("version %d does not belong to command %d", versionID, commandID)
+		}
+		c := m.commands[commandID]
+		if c == nil {
+			return []int{commandID}, nil
+		}
+		if other := m.live(v.Name); other != nil && other.ID != commandID && isLive(c) {
+			return nil, fmt.Errorf("cannot roll back: another command now uses the name %s", v.Name)
+		}
+		c.Name, c.CommandStr, c.Note, c.Interpreter = v.Name, v.CommandStr, v.Note, v.Interpreter
+		c.Tags = slices.Clone(v.Tags)
+		c.Env = slices.Clone(v.Env)
+		c.Normalize()
+		return []int{commandID}, nil
+	})
+}
+
+// TrashedCommands lists commands in the trash, most recently deleted first.
+func (m *Memory) TrashedCommands() ([]models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(isTrashed, newerDeleted), nil
+}
+
+// GetTrashedByName returns the most recently trashed command with the given
+// name, or nil if there is none.
+func (m *Memory) GetTrashedByName(name string) (*models.Command, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trash := m.list(func(c *models.Command) bool { return isTrashed(c) && c.Name == name }, newerDeleted)
+	if len(trash) == 0 {
+		return nil, nil
+	}
+	return &trash[0], nil
+}
+
+// RestoreCommand takes a command out of the trash. If name is empty the
+// command keeps its own name, or gets a free variant of it when a live
+// command took the name in the meantime. The final name is returned.
+func (m *Memory) RestoreCommand(id int, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.journaled("restore", []int{id}, func() ([]int, error) {
+		c := m.commands[id]
+		if c == nil || isLive(c) {
+			return nil, fmt.Errorf("command %d is not in the trash", id)
+		}
+		if name == "" {
+			name = m.freeName(c.Name)
+		} else if m.live(name) != nil {
+			return nil, fmt.Errorf("a command named %s already exists", name)
+		}
+		c.Name = name
+		c.DeletedAt = time.Time{}
+		return []int{id}, nil
+	})
+	return name, err
+}
+
+// freeName returns name, or name-restored, name-restored-2, ... whichever
+// is not used by a live command.
+func (m *Memory) freeName(name string) string {
+	candidate := name
+	for i := 1; m.live(candidate) != nil; i++ {
+		if i == 1 {
+			candidate = name + "-restored"
+		} else {
+			candidate = fmt.Sprintf("%s-restored-%d", name, i)
+		}
+	}
+	return candidate
+}
+
+// PurgeCommand permanently removes a command from the trash.
+func (m *Memory) PurgeCommand(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purge(func(c *models.Command) bool { return c.ID == id && isTrashed(c) })
+	return nil
+}
+
+// EmptyTrash permanently removes every trashed command and reports how many.
+func (m *Memory) EmptyTrash() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.purge(isTrashed), nil
+}
+
+// PurgeTrash permanently removes commands trashed longer than retention ago.
+// A zero retention keeps the trash forever.
+func (m *Memory) PurgeTrash(retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.purge(func(c *models.Command) bool { return isTrashed(c) && c.DeletedAt.Before(cutoff) }), nil
+}
+
+// purge hard deletes the commands drop accepts together with their
+// versions and schedules.
+func (m *Memory) purge(drop func(c *models.Command) bool) int64 {
+	var n int64
+	for id, c := range m.commands {
+		if drop(c) {
+			delete(m.commands, id)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	m.versions = slices.DeleteFunc(m.versions, func(v VersionRecord) bool { return m.commands[v.Command.ID] == nil })
+	m.schedules = slices.DeleteFunc(m.schedules, func(sc models.Schedule) bool { return m.commands[sc.CommandID] == nil })
+	maps.DeleteFunc(m.aliases, func(_ string, id int) bool { return m.commands[id] == nil })
+	return n
+}
+
+// InsertRun records a run and drops the oldest runs of the same command
+// beyond RunHistorySize.
+func (m *Memory) InsertRun(r *models.Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run := *r
+	run.ID = nextID(m.runs, func(r models.Run) int { return r.ID })
+	m.runs = append(m.runs, run)
+	kept := 0
+	for i := len(m.runs) - 1; i >= 0; i-- {
+		if m.runs[i].CommandID != r.CommandID {
+			continue
+		}
+		if kept++; kept > RunHistorySize {
+			m.runs = slices.Delete(m.runs, i, i+1)
+		}
+	}
+	return nil
+}
+
+// Runs lists recorded runs, newest first. A commandID of 0 lists the runs
+// of every command.
+func (m *Memory) Runs(commandID, limit int) ([]models.Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.Run
+	for i := len(m.runs) - 1; i >= 0 && len(out) < limit; i-- {
+		if commandID == 0 || m.runs[i].CommandID == commandID {
+			out = append(out, m.runs[i])
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) InsertPlaybook(p *models.Playbook) (int64, error) {
+	if p.Name == "" {
+		return 0, errors.New("name is required")
+	}
+	if len(p.Steps) == 0 {
+		return 0, errors.New("a playbook needs at least one step")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.playbooks {
+		if other.Name == p.Name {
+			return 0, fmt.Errorf("a playbook named %s already exists", p.Name)
+		}
+	}
+	stored := *p
+	stored.ID = nextID(m.playbooks, func(p models.Playbook) int { return p.ID })
+	stored.Steps = slices.Clone(p.Steps)
+	m.playbooks = append(m.playbooks, stored)
+	return int64(stored.ID), nil
+}
+
+// UpdatePlaybook saves the name, note and steps of an existing playbook.
+func (m *Memory) UpdatePlaybook(p *models.Playbook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.playbooks {
+		if m.playbooks[i].ID == p.ID {
+			m.playbooks[i].Name = p.Name
+			m.playbooks[i].Note = p.Note
+			m.playbooks[i].Steps = slices.Clone(p.Steps)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeletePlaybook(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.playbooks = slices.DeleteFunc(m.playbooks, func(p models.Playbook) bool { return p.ID == id })
+	return nil
+}
+
+func (m *Memory) GetAllPlaybooks() ([]models.Playbook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.Playbook
+	for _, p := range m.playbooks {
+		out = append(out, m.loadPlaybook(p))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *Memory) GetPlaybookByName(name string) (*models.Playbook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.playbooks {
+		if p.Name == name {
+			loaded := m.loadPlaybook(p)
+			return &loaded, nil
+		}
+	}
+	return nil, nil
+}
+
+// loadPlaybook copies p with the current names of its commands. CommandName
+// is empty for steps whose command has been purged.
+func (m *Memory) loadPlaybook(p models.Playbook) models.Playbook {
+	p.Steps = slices.Clone(p.Steps)
+	for i, st := range p.Steps {
+		p.Steps[i].CommandName = ""
+		if c := m.commands[st.CommandID]; c != nil {
+			p.Steps[i].CommandName = c.Name
+		}
+	}
+	return p
+}
+
+func (m *Memory) InsertSchedule(sc *models.Schedule) (int64, error) {
+	if sc.Spec == "" {
+		return 0, errors.New("a schedule needs a cron expression")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *sc
+	stored.ID = nextID(m.schedules, func(sc models.Schedule) int { return sc.ID })
+	stored.LastRun = time.Time{}
+	m.schedules = append(m.schedules, stored)
+	return int64(stored.ID), nil
+}
+
+func (m *Memory) DeleteSchedule(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.schedules)
+	m.schedules = slices.DeleteFunc(m.schedules, func(sc models.Schedule) bool { return sc.ID == id })
+	if len(m.schedules) == n {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetAllSchedules lists every schedule in the order they were added.
+// CommandName is empty when the command has been purged.
+func (m *Memory) GetAllSchedules() ([]models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.Schedule
+	for _, sc := range m.schedules {
+		sc.CommandName = ""
+		if c := m.commands[sc.CommandID]; c != nil {
+			sc.CommandName = c.Name
+		}
+		out = append(out, sc)
+	}
+	return out, nil
+}
+
+// SetScheduleLastRun records the scheduled time of the latest run so that
+// the next one is computed from it.
+func (m *Memory) SetScheduleLastRun(id int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.schedules {
+		if m.schedules[i].ID == id {
+			m.schedules[i].LastRun = at
+		}
+	}
+	return nil
+}
+
+// SaveEnvProfile creates the profile, or replaces the variables of the
+// profile with the same name.
+func (m *Memory) SaveEnvProfile(p *models.EnvProfile) error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.profiles {
+		if m.profiles[i].Name == p.Name {
+			m.profiles[i].Vars = slices.Clone(p.Vars)
+			return nil
+		}
+	}
+	stored := *p
+	stored.ID = nextID(m.profiles, func(p models.EnvProfile) int { return p.ID })
+	stored.Vars = slices.Clone(p.Vars)
+	m.profiles = append(m.profiles, stored)
+	return nil
+}
+
+func (m *Memory) DeleteEnvProfile(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles = slices.DeleteFunc(m.profiles, func(p models.EnvProfile) bool { return p.ID == id })
+	return nil
+}
+
+func (m *Memory) GetEnvProfiles() ([]models.EnvProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.EnvProfile
+	for _, p := range m.profiles {
+		p.Vars = slices.Clone(p.Vars)
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// GetEnvProfileByName returns the named profile, or nil if there is none.
+func (m *Memory) GetEnvProfileByName(name string) (*models.EnvProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.profiles {
+		if p.Name == name {
+			p.Vars = slices.Clone(p.Vars)
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// SecretKey returns the salt of the secrets key and the value used to check
+// a passphrase against it, or nils when no secret was ever stored.
+func (m *Memory) SecretKey() (salt, verifier []byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.salt), slices.Clone(m.verifier), nil
+}
+
+// SetSecretKey records the salt and verifier of a new secrets key.
+func (m *Memory) SetSecretKey(salt, verifier []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.salt, m.verifier = slices.Clone(salt), slices.Clone(verifier)
+	return nil
+}
+
+// PutSecret stores the encrypted value of the named secret, replacing an
+// earlier value.
+func (m *Memory) PutSecret(name string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if sec := m.secrets[name]; sec != nil {
+		sec.Value = slices.Clone(value)
+		sec.UpdatedAt = now
+		return nil
+	}
+	m.secrets[name] = &SecretRecord{
+		Secret: models.Secret{ID: nextID(slices.Collect(maps.Values(m.secrets)), func(sec *SecretRecord) int { return sec.ID }), Name: name, CreatedAt: now, UpdatedAt: now},
+		Value:  slices.Clone(value),
+	}
+	return nil
+}
+
+// SecretValue returns the encrypted value of the named secret, or nil if
+// there is none.
+func (m *Memory) SecretValue(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sec := m.secrets[name]; sec != nil {
+		return slices.Clone(sec.Value), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) DeleteSecret(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.secrets[name] == nil {
+		return ErrNotFound
+	}
+	delete(m.secrets, name)
+	return nil
+}
+
+// Secrets lists the stored secrets by name, without their values.
+func (m *Memory) Secrets() ([]models.Secret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.Secret
+	for _, sec := range m.secrets {
+		out = append(out, sec.Secret)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
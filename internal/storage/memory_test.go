@@ -0,0 +1,12 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+	"github.com/kanekitakitos/cmd-vault/internal/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store { return storage.NewMemory() })
+}
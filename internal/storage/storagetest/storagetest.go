@@ -0,0 +1,727 @@
+// Package storagetest checks that a storage.Store backend behaves like the
+// others. Each backend runs Run from its own tests.
+package storagetest
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// Run runs the conformance tests, each against a new empty store from open.
+func Run(t *testing.T, open func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Store)
+	}{
+		{"IDs", testIDs},
+		{"Commands", testCommands},
+		{"InsertCommands", testInsertCommands},
+		{"ApplyBatch", testApplyBatch},
+		{"RoundTrip", testRoundTrip},
+		{"Search", testSearch},
+		{"Aliases", testAliases},
+		{"Pins", testPins},
+		{"Trash", testTrash},
+		{"UndoRedo", testUndoRedo},
+		{"Versions", testVersions},
+		{"Runs", testRuns},
+		{"Playbooks", testPlaybooks},
+		{"Schedules", testSchedules},
+		{"Profiles", testProfiles},
+		{"Secrets", testSecrets},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() { s.Close() })
+			tt.fn(t, s)
+		})
+	}
+}
+
+// add inserts a command and returns its id.
+func add(t *testing.T, s storage.Store, name, body string, tags ...string) int {
+	t.Helper()
+	id, err := s.InsertCommand(&models.Command{Name: name, CommandStr: body, Note: "note of " + name, Tags: tags, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("InsertCommand(%s): %v", name, err)
+	}
+	return int(id)
+}
+
+func get(t *testing.T, s storage.Store, name string) *models.Command {
+	t.Helper()
+	c, err := s.GetByName(name)
+	if err != nil {
+		t.Fatalf("GetByName(%s): %v", name, err)
+	}
+	return c
+}
+
+// names returns the names of commands, sorted.
+func names(commands []models.Command) []string {
+	var out []string
+	for _, c := range commands {
+		out = append(out, c.Name)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func wantNames(t *testing.T, what string, commands []models.Command, want ...string) {
+	t.Helper()
+	slices.Sort(want)
+	if got := names(commands); !slices.Equal(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func testIDs(t *testing.T, s storage.Store) {
+	first := add(t, s, "first", "echo 1")
+	second := add(t, s, "second", "echo 2")
+	if first != 1 || second != 2 {
+		t.Errorf("command ids %d, %d, want 1, 2", first, second)
+	}
+	// Every kind of record is numbered on its own.
+	sc, err := s.InsertSchedule(&models.Schedule{CommandID: first, Spec: "@daily", CatchUp: models.CatchUpSkip, CreatedAt: time.Now()})
+	if err != nil || sc != 1 {
+		t.Errorf("first schedule id %d (%v), want 1", sc, err)
+	}
+	pb, err := s.InsertPlaybook(&models.Playbook{Name: "pb", Steps: []models.PlaybookStep{{CommandID: first}}, CreatedAt: time.Now()})
+	if err != nil || pb != 1 {
+		t.Errorf("first playbook id %d (%v), want 1", pb, err)
+	}
+	if err := s.InsertRun(&models.Run{CommandID: first, CommandName: "first", Source: "test", StartedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := s.Runs(first, 10); len(runs) != 1 || runs[0].ID != 1 {
+		t.Errorf("first run %+v, want id 1", runs)
+	}
+	if err := s.SaveEnvProfile(&models.EnvProfile{Name: "dev", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.GetEnvProfileByName("dev"); p == nil || p.ID != 1 {
+		t.Errorf("first profile %+v, want id 1", p)
+	}
+	if err := s.PutSecret("token", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if secrets, _ := s.Secrets(); len(secrets) != 1 || secrets[0].ID != 1 {
+		t.Errorf("first secret %+v, want id 1", secrets)
+	}
+	if ops, _ := s.Operations(); len(ops) != 2 || ops[0].ID != 2 || ops[1].ID != 1 {
+		t.Errorf("operations %+v, want ids 2, 1", ops)
+	}
+	if third := add(t, s, "third", "echo 3"); third != 3 {
+		t.Errorf("third command id %d, want 3", third)
+	}
+}
+
+func testCommands(t *testing.T, s storage.Store) {
+	id := add(t, s, "build", "make", "ci")
+	if _, err := s.InsertCommand(&models.Command{Name: "build", CommandStr: "make", Note: "again"}); err == nil {
+		t.Error("inserted a second command named build")
+	}
+	if _, err := s.InsertCommand(&models.Command{Name: "nonote", CommandStr: "true"}); err == nil {
+		t.Error("inserted a command without a note")
+	}
+
+	c := get(t, s, "build")
+	if c == nil || c.ID != id || c.CommandStr != "make" || !slices.Equal(c.Tags, []string{"ci"}) {
+		t.Fatalf("GetByName = %+v", c)
+	}
+	if byID, err := s.GetByID(id); err != nil || byID == nil || byID.Name != "build" {
+		t.Errorf("GetByID = %+v, %v", byID, err)
+	}
+	if missing := get(t, s, "missing"); missing != nil {
+		t.Errorf("GetByName(missing) = %+v", missing)
+	}
+
+	c.Name, c.CommandStr, c.Env = "ci/build", "make all", []string{"CI=1"}
+	if err := s.UpdateCommand(c); err != nil {
+		t.Fatal(err)
+	}
+	if old := get(t, s, "build"); old != nil {
+		t.Error("the old name still finds the renamed command")
+	}
+	c = get(t, s, "ci/build")
+	if c == nil || c.CommandStr != "make all" || !slices.Equal(c.Env, []string{"CI=1"}) {
+		t.Fatalf("after update: %+v", c)
+	}
+
+	add(t, s, "test", "go test")
+	c.Name = "test"
+	if err := s.UpdateCommand(c); err == nil {
+		t.Error("renamed a command to the name of another")
+	}
+
+	if err := s.IncrementUsage(id); err != nil {
+		t.Fatal(err)
+	}
+	if c = get(t, s, "ci/build"); c.UsageCount != 1 {
+		t.Errorf("usage count %d, want 1", c.UsageCount)
+	}
+
+	all, err := s.GetAllCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "GetAllCommands", all, "ci/build", "test")
+}
+
+func testInsertCommands(t *testing.T, s storage.Store) {
+	add(t, s, "build", "make")
+	batch := func(names ...string) []*models.Command {
+		var cs []*models.Command
+		for _, name := range names {
+			cs = append(cs, &models.Command{Name: name, CommandStr: "echo " + name, Note: "note of " + name, CreatedAt: time.Now()})
+		}
+		return cs
+	}
+	for _, names := range [][]string{{"a", "build"}, {"a", "a"}, {"a", ""}} {
+		if _, err := s.InsertCommands(batch(names...)); err == nil {
+			t.Errorf("InsertCommands(%v) succeeded", names)
+		}
+		all, _ := s.GetAllCommands()
+		wantNames(t, "after a failed batch", all, "build")
+	}
+
+	ids, err := s.InsertCommands(batch("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := get(t, s, "a"), get(t, s, "b"); len(ids) != 2 || a == nil || b == nil || int(ids[0]) != a.ID || int(ids[1]) != b.ID {
+		t.Fatalf("InsertCommands = %v, commands %+v, %+v", ids, a, b)
+	}
+	ops, _ := s.Operations()
+	if len(ops) != 2 || ops[0].Kind != "add" || ops[0].Label != "add a, b" {
+		t.Errorf("operations %+v, want one for the batch", ops)
+	}
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := s.GetAllCommands()
+	wantNames(t, "after undoing the batch", all, "build")
+}
+
+func testApplyBatch(t *testing.T, s storage.Store) {
+	add(t, s, "build", "make")
+	old := add(t, s, "old", "true")
+	bodies := func() map[string]string {
+		all, err := s.GetAllCommands()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]string{}
+		for _, c := range all {
+			out[c.Name] = c.CommandStr
+		}
+		return out
+	}
+	before := bodies()
+
+	build := get(t, s, "build")
+	build.CommandStr = "make all"
+	bad := storage.Batch{
+		Update: []*models.Command{build},
+		Delete: []int{old},
+		Insert: []*models.Command{{Name: "build", CommandStr: "echo", Note: "again"}},
+	}
+	if _, err := s.ApplyBatch("sync", bad); err == nil {
+		t.Error("ApplyBatch inserted a second command named build")
+	}
+	if got := bodies(); !reflect.DeepEqual(got, before) {
+		t.Errorf("a failed batch left %v, want %v", got, before)
+	}
+
+	build = get(t, s, "build")
+	build.CommandStr = "make all"
+	ids, err := s.ApplyBatch("sync", storage.Batch{
+		Update: []*models.Command{build},
+		Delete: []int{old},
+		Insert: []*models.Command{{Name: "test", CommandStr: "go test", Note: "tests", CreatedAt: time.Now()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := map[string]string{"build": "make all", "test": "go test"}
+	if got := bodies(); !reflect.DeepEqual(got, after) {
+		t.Errorf("after the batch %v, want %v", got, after)
+	}
+	if c := get(t, s, "test"); len(ids) != 1 || c == nil || int(ids[0]) != c.ID {
+		t.Errorf("ApplyBatch = %v, inserted %+v", ids, c)
+	}
+
+	op, err := s.Undo()
+	if err != nil || op.Kind != "sync" {
+		t.Fatalf("Undo = %+v, %v", op, err)
+	}
+	if got := bodies(); !reflect.DeepEqual(got, before) {
+		t.Errorf("after undoing the batch %v, want %v", got, before)
+	}
+	if _, err := s.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := bodies(); !reflect.DeepEqual(got, after) {
+		t.Errorf("after redoing the batch %v, want %v", got, after)
+	}
+}
+
+func testSearch(t *testing.T, s storage.Store) {
+	add(t, s, "deploy", "kubectl apply -f deploy.yaml", "k8s")
+	add(t, s, "logs", "kubectl logs -f app")
+	add(t, s, "build", "make", "ci")
+	gone := add(t, s, "old-deploy", "scp deploy.tar host:")
+	if err := s.DeleteCommand(gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAliases(get(t, s, "build").ID, []string{"mk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"deploy", []string{"deploy"}},
+		{"KUBECTL", []string{"deploy", "logs"}},
+		{"note of logs", []string{"logs"}},
+		{"k8s", []string{"deploy"}},
+		{"mk", []string{"build"}},
+		{"nothing", nil},
+		{"", []string{"build", "deploy", "logs"}},
+	} {
+		got, err := s.SearchCommands(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantNames(t, "SearchCommands("+tt.query+")", got, tt.want...)
+	}
+}
+
+func testAliases(t *testing.T, s storage.Store) {
+	build := add(t, s, "build", "make")
+	test := add(t, s, "test", "go test")
+	if err := s.SetAliases(build, []string{"b", "mk"}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.GetByAlias("mk"); err != nil || c == nil || c.ID != build {
+		t.Errorf("GetByAlias(mk) = %+v, %v", c, err)
+	}
+	if c := get(t, s, "build"); !slices.Equal(c.Aliases, []string{"b", "mk"}) {
+		t.Errorf("aliases %v, want [b mk]", c.Aliases)
+	}
+	if err := s.SetAliases(test, []string{"mk"}); err == nil {
+		t.Error("gave test an alias of build")
+	}
+	if err := s.SetAliases(test, []string{"build"}); err == nil {
+		t.Error("gave test an alias equal to the name of build")
+	}
+	if _, err := s.InsertCommand(&models.Command{Name: "mk", CommandStr: "make", Note: "shadows an alias"}); err == nil {
+		t.Error("inserted a command named like an alias of build")
+	}
+	c := get(t, s, "test")
+	c.Name = "b"
+	if err := s.UpdateCommand(c); err == nil {
+		t.Error("renamed test to an alias of build")
+	}
+	c = get(t, s, "build")
+	c.Name = "b"
+	if err := s.UpdateCommand(c); err != nil {
+		t.Errorf("renaming build to its own alias: %v", err)
+	}
+	c.Name = "build"
+	if err := s.UpdateCommand(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAliases(build, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := s.GetByAlias("mk"); c != nil {
+		t.Errorf("removed alias still finds %s", c.Name)
+	}
+	if c, _ := s.GetByAlias("missing"); c != nil {
+		t.Errorf("GetByAlias(missing) = %+v", c)
+	}
+}
+
+func testPins(t *testing.T, s storage.Store) {
+	id := add(t, s, "build", "make")
+	if get(t, s, "build").Pinned() {
+		t.Fatal("a new command is pinned")
+	}
+	if err := s.SetPinned(id, true); err != nil {
+		t.Fatal(err)
+	}
+	if !get(t, s, "build").Pinned() {
+		t.Error("SetPinned(true) didn't pin")
+	}
+	if err := s.SetPinned(id, false); err != nil {
+		t.Fatal(err)
+	}
+	if get(t, s, "build").Pinned() {
+		t.Error("SetPinned(false) didn't unpin")
+	}
+	if ops, _ := s.Operations(); len(ops) != 1 {
+		t.Errorf("pins were journaled: %+v", ops)
+	}
+}
+
+func testTrash(t *testing.T, s storage.Store) {
+	build := add(t, s, "build", "make")
+	test := add(t, s, "test", "go test")
+	if err := s.DeleteCommands([]int{build, test}); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := s.GetAllCommands(); len(all) != 0 {
+		t.Errorf("deleted commands are still live: %v", names(all))
+	}
+	trashed, err := s.TrashedCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "TrashedCommands", trashed, "build", "test")
+	if c, err := s.GetTrashedByName("build"); err != nil || c == nil || c.ID != build {
+		t.Errorf("GetTrashedByName = %+v, %v", c, err)
+	}
+
+	// A new command takes the name; the restored one gets another.
+	add(t, s, "build", "make all")
+	name, err := s.RestoreCommand(build, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == "build" || get(t, s, name) == nil {
+		t.Errorf("restored as %q", name)
+	}
+	if _, err := s.RestoreCommand(build, ""); err == nil {
+		t.Error("restored a live command")
+	}
+
+	if err := s.PurgeCommand(test); err != nil {
+		t.Fatal(err)
+	}
+	if trashed, _ := s.TrashedCommands(); len(trashed) != 0 {
+		t.Errorf("trash after purge: %v", names(trashed))
+	}
+	if c, _ := s.GetByID(test); c != nil {
+		t.Errorf("purged command still found: %+v", c)
+	}
+
+	if err := s.DeleteCommand(get(t, s, "build").ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.PurgeTrash(time.Hour); err != nil || n != 0 {
+		t.Errorf("PurgeTrash purged %d recent commands (%v)", n, err)
+	}
+	if n, err := s.EmptyTrash(); err != nil || n != 1 {
+		t.Errorf("EmptyTrash = %d, %v, want 1", n, err)
+	}
+}
+
+func testUndoRedo(t *testing.T, s storage.Store) {
+	if _, err := s.Undo(); err != storage.ErrNothingToUndo {
+		t.Errorf("Undo on an empty journal: %v", err)
+	}
+	id := add(t, s, "build", "make")
+	c := get(t, s, "build")
+	c.CommandStr = "make all"
+	if err := s.UpdateCommand(c); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := s.Undo()
+	if err != nil || op.Kind != "edit" {
+		t.Fatalf("Undo = %+v, %v", op, err)
+	}
+	if c = get(t, s, "build"); c.CommandStr != "make" {
+		t.Errorf("after undoing the edit: %q", c.CommandStr)
+	}
+	if op, err = s.Undo(); err != nil || op.Kind != "add" {
+		t.Fatalf("Undo = %+v, %v", op, err)
+	}
+	if c = get(t, s, "build"); c != nil {
+		t.Errorf("undone add left %+v", c)
+	}
+
+	if op, err = s.Redo(); err != nil || op.Kind != "add" {
+		t.Fatalf("Redo = %+v, %v", op, err)
+	}
+	if c = get(t, s, "build"); c == nil || c.ID != id || c.CommandStr != "make" {
+		t.Errorf("after redoing the add: %+v", c)
+	}
+
+	// A new change drops what could be redone.
+	if err := s.DeleteCommand(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Redo(); err != storage.ErrNothingToRedo {
+		t.Errorf("Redo after a new change: %v", err)
+	}
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if get(t, s, "build") == nil {
+		t.Error("undoing the delete didn't bring the command back")
+	}
+}
+
+// testRoundTrip saves commands in a form their document can't hold as it
+// is, and checks that they are stored as they read back, so that backends
+// keeping documents don't see them change when they are read again.
+func testRoundTrip(t *testing.T, s storage.Store) {
+	c := &models.Command{
+		Name:        "greet",
+		CommandStr:  "\n  echo hi\r\n  echo  there  \n\n",
+		Note:        " line1\nline2  with  spaces ",
+		Interpreter: " Bash",
+		Tags:        []string{" a", "a", "b "},
+		Env:         []string{"A=1 ", "", "B=x;y", "A=2"},
+		CreatedAt:   time.Now(),
+	}
+	id, err := s.InsertCommand(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Command{
+		Name:        "greet",
+		CommandStr:  "echo hi\n  echo  there",
+		Note:        "line1 line2 with spaces",
+		Interpreter: "bash",
+		Tags:        []string{"a", "b"},
+		Env:         []string{"B=x;y", "A=2"},
+	}
+	check := func(when string) {
+		t.Helper()
+		got := get(t, s, "greet")
+		if got.CommandStr != want.CommandStr || got.Note != want.Note || got.Interpreter != want.Interpreter ||
+			!slices.Equal(got.Tags, want.Tags) || !slices.Equal(got.Env, want.Env) {
+			t.Fatalf("%s: stored %+v, want %+v", when, *got, want)
+		}
+		decoded, err := document.Decode(document.Encode(got))
+		if err != nil {
+			t.Fatalf("%s: %v", when, err)
+		}
+		decoded.ID, decoded.UsageCount, decoded.CreatedAt = got.ID, got.UsageCount, got.CreatedAt
+		decoded.PinnedAt, decoded.Aliases = got.PinnedAt, got.Aliases
+		if !reflect.DeepEqual(*decoded, *got) {
+			t.Fatalf("%s: %+v reads back from its document as %+v", when, *got, *decoded)
+		}
+	}
+	check("after insert")
+	// Another change makes backends that keep files read them again.
+	add(t, s, "other", "true")
+	check("after another change")
+
+	c = get(t, s, "greet")
+	c.CommandStr, c.Note = "  echo bye  ", "a\n b"
+	if err := s.UpdateCommand(c); err != nil {
+		t.Fatal(err)
+	}
+	want.CommandStr, want.Note = "echo bye", "a b"
+	add(t, s, "third", "true")
+	check("after update")
+	if versions, err := s.Versions(int(id)); err != nil {
+		t.Fatal(err)
+	} else if len(versions) != 2 {
+		t.Errorf("%d versions, want 2: reading the vault again recorded changes", len(versions))
+	}
+}
+
+func testVersions(t *testing.T, s storage.Store) {
+	id := add(t, s, "build", "make")
+	for _, body := range []string{"make all", "make ci"} {
+		c := get(t, s, "build")
+		c.CommandStr = body
+		if err := s.UpdateCommand(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := s.Versions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for _, v := range versions {
+		bodies = append(bodies, v.Command.CommandStr)
+	}
+	if !slices.Equal(bodies, []string{"make ci", "make all", "make"}) {
+		t.Fatalf("versions %v, newest first", bodies)
+	}
+	if versions[0].Number != 3 || versions[2].Number != 1 {
+		t.Errorf("version numbers %d..%d, want 3..1", versions[0].Number, versions[2].Number)
+	}
+
+	if err := s.RollbackCommand(id, versions[2].ID); err != nil {
+		t.Fatal(err)
+	}
+	if c := get(t, s, "build"); c.CommandStr != "make" {
+		t.Errorf("after rollback: %q", c.CommandStr)
+	}
+	if versions, _ = s.Versions(id); len(versions) != 4 {
+		t.Errorf("rollback recorded %d versions, want 4", len(versions))
+	}
+	other := add(t, s, "test", "go test")
+	if err := s.RollbackCommand(other, versions[0].ID); err == nil {
+		t.Error("rolled back to a version of another command")
+	}
+}
+
+func testRuns(t *testing.T, s storage.Store) {
+	build := add(t, s, "build", "make")
+	test := add(t, s, "test", "go test")
+	start := time.Now().Add(-time.Hour)
+	for i, id := range []int{build, test, build} {
+		r := &models.Run{CommandID: id, CommandName: "x", Source: "test", StartedAt: start.Add(time.Duration(i) * time.Minute), ExitCode: i}
+		if err := s.InsertRun(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := s.Runs(build, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ExitCode != 2 || runs[1].ExitCode != 0 {
+		t.Errorf("runs of build %+v, want the newest first", runs)
+	}
+	if runs, _ = s.Runs(0, 10); len(runs) != 3 {
+		t.Errorf("all runs: %d, want 3", len(runs))
+	}
+	if runs, _ = s.Runs(0, 1); len(runs) != 1 || runs[0].ExitCode != 2 {
+		t.Errorf("latest run %+v", runs)
+	}
+}
+
+func testPlaybooks(t *testing.T, s storage.Store) {
+	build := add(t, s, "build", "make")
+	test := add(t, s, "test", "go test")
+	p := &models.Playbook{Name: "ci", Note: "checks", CreatedAt: time.Now(), Steps: []models.PlaybookStep{
+		{CommandID: build},
+		{CommandID: test, WorkDir: "sub", ContinueOnError: true},
+	}}
+	id, err := s.InsertPlaybook(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.InsertPlaybook(&models.Playbook{Name: "ci", Steps: p.Steps}); err == nil {
+		t.Error("inserted a second playbook named ci")
+	}
+	if _, err := s.InsertPlaybook(&models.Playbook{Name: "empty"}); err == nil {
+		t.Error("inserted a playbook without steps")
+	}
+
+	got, err := s.GetPlaybookByName("ci")
+	if err != nil || got == nil {
+		t.Fatalf("GetPlaybookByName = %+v, %v", got, err)
+	}
+	if got.ID != int(id) || len(got.Steps) != 2 || got.Steps[0].CommandName != "build" || got.Steps[1].WorkDir != "sub" || !got.Steps[1].ContinueOnError {
+		t.Errorf("playbook %+v", got)
+	}
+
+	got.Steps = got.Steps[1:]
+	got.Note = "tests only"
+	if err := s.UpdatePlaybook(got); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = s.GetPlaybookByName("ci"); len(got.Steps) != 1 || got.Note != "tests only" {
+		t.Errorf("after update: %+v", got)
+	}
+	if all, _ := s.GetAllPlaybooks(); len(all) != 1 {
+		t.Errorf("GetAllPlaybooks: %d playbooks", len(all))
+	}
+	if err := s.DeletePlaybook(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = s.GetPlaybookByName("ci"); got != nil {
+		t.Errorf("deleted playbook still found: %+v", got)
+	}
+}
+
+func testSchedules(t *testing.T, s storage.Store) {
+	build := add(t, s, "build", "make")
+	id, err := s.InsertSchedule(&models.Schedule{CommandID: build, Spec: "*/5 * * * *", Dir: "/tmp", CatchUp: models.CatchUpOnce, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := s.SetScheduleLastRun(int(id), at); err != nil {
+		t.Fatal(err)
+	}
+	all, err := s.GetAllSchedules()
+	if err != nil || len(all) != 1 {
+		t.Fatalf("GetAllSchedules = %+v, %v", all, err)
+	}
+	sc := all[0]
+	if sc.CommandName != "build" || sc.Spec != "*/5 * * * *" || sc.Dir != "/tmp" || sc.CatchUp != models.CatchUpOnce || !sc.LastRun.Equal(at) {
+		t.Errorf("schedule %+v", sc)
+	}
+	if err := s.DeleteSchedule(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ = s.GetAllSchedules(); len(all) != 0 {
+		t.Errorf("deleted schedule still listed: %+v", all)
+	}
+}
+
+func testProfiles(t *testing.T, s storage.Store) {
+	if err := s.SaveEnvProfile(&models.EnvProfile{Name: "dev", Vars: []string{"A=1"}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEnvProfile(&models.EnvProfile{Name: "dev", Vars: []string{"A=2", "B=3"}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.GetEnvProfileByName("dev")
+	if err != nil || p == nil || !slices.Equal(p.Vars, []string{"A=2", "B=3"}) {
+		t.Fatalf("GetEnvProfileByName = %+v, %v", p, err)
+	}
+	if all, _ := s.GetEnvProfiles(); len(all) != 1 {
+		t.Errorf("saving twice made %d profiles", len(all))
+	}
+	if err := s.DeleteEnvProfile(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = s.GetEnvProfileByName("dev"); p != nil {
+		t.Errorf("deleted profile still found: %+v", p)
+	}
+}
+
+func testSecrets(t *testing.T, s storage.Store) {
+	if salt, verifier, err := s.SecretKey(); err != nil || salt != nil || verifier != nil {
+		t.Errorf("SecretKey of a new store = %v, %v, %v", salt, verifier, err)
+	}
+	if err := s.SetSecretKey([]byte("salt"), []byte("verifier")); err != nil {
+		t.Fatal(err)
+	}
+	if salt, verifier, _ := s.SecretKey(); !bytes.Equal(salt, []byte("salt")) || !bytes.Equal(verifier, []byte("verifier")) {
+		t.Errorf("SecretKey = %q, %q", salt, verifier)
+	}
+
+	if err := s.PutSecret("token", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutSecret("token", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.SecretValue("token"); err != nil || string(v) != "two" {
+		t.Errorf("SecretValue = %q, %v", v, err)
+	}
+	if v, _ := s.SecretValue("missing"); v != nil {
+		t.Errorf("SecretValue(missing) = %q", v)
+	}
+	if list, _ := s.Secrets(); len(list) != 1 || list[0].Name != "token" {
+		t.Errorf("Secrets = %+v", list)
+	}
+	if err := s.DeleteSecret("token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteSecret("token"); err != storage.ErrNotFound {
+		t.Errorf("deleting a missing secret: %v", err)
+	}
+}
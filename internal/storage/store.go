@@ -0,0 +1,148 @@
+// Package storage defines the Store interface the TUI and the commands use
+// to reach the vault, so they don't depend on a particular backend. The
+// SQLite backend lives in package db; Memory keeps everything in memory.
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// JournalSize is how many operations are kept for undo/redo.
+const JournalSize = 100
+
+// RunHistorySize is how many runs are kept per command.
+const RunHistorySize = 50
+
+var (
+	// ErrNotFound is returned when deleting something that doesn't exist.
+	// Lookups return nil instead.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNothingToUndo and ErrNothingToRedo are returned when the journal
+	// has no operation in the requested direction.
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Operation is one undoable change to the vault, possibly touching several commands.
+type Operation struct {
+	ID        int
+	Kind      string // add, edit, delete, ...
+	Label     string
+	Undone    bool
+	CreatedAt time.Time
+}
+
+// Batch is a set of changes to commands that are made together: updates
+// first, then deletes, then inserts.
+type Batch struct {
+	Update []*models.Command
+	Delete []int
+	Insert []*models.Command
+}
+
+// CommandStore holds the saved commands. Deleting moves them to the trash;
+// add, edit and delete are journaled for undo. InsertCommand and
+// UpdateCommand normalize the command they are given before saving it.
+type CommandStore interface {
+	InsertCommand(c *models.Command) (int64, error)
+	// InsertCommands adds several commands as a single undoable operation.
+	// None is added when one of them can't be.
+	InsertCommands(cs []*models.Command) ([]int64, error)
+	// ApplyBatch makes the changes of b as a single undoable operation of
+	// the given kind and returns the ids of the inserted commands. Nothing
+	// changes when one of them can't be made.
+	ApplyBatch(kind string, b Batch) ([]int64, error)
+	GetAllCommands() ([]models.Command, error)
+	// SearchCommands returns the live commands whose name, note, body, tags
+	// or aliases contain query, ignoring case.
+	SearchCommands(query string) ([]models.Command, error)
+	GetByName(name string) (*models.Command, error)
+	// GetByAlias returns the live command with the given alias, or nil.
+	GetByAlias(alias string) (*models.Command, error)
+	GetByID(id int) (*models.Command, error)
+	UpdateCommand(c *models.Command) error
+	DeleteCommand(id int) error
+	DeleteCommands(ids []int) error
+	IncrementUsage(id int) error
+	// SetPinned pins a command to the top of the list, or unpins it.
+	// Like usage counts, pins are not journaled.
+	SetPinned(id int, pinned bool) error
+	// SetAliases replaces the aliases of a command. An alias can't be the
+	// alias of another command or the name of a live one. Aliases are not
+	// journaled either.
+	SetAliases(id int, aliases []string) error
+}
+
+// TrashStore holds deleted commands until they are restored or purged.
+type TrashStore interface {
+	TrashedCommands() ([]models.Command, error)
+	GetTrashedByName(name string) (*models.Command, error)
+	RestoreCommand(id int, name string) (string, error)
+	PurgeCommand(id int) error
+	EmptyTrash() (int64, error)
+	PurgeTrash(retention time.Duration) (int64, error)
+}
+
+// HistoryStore keeps the versions of every command, the undo journal and
+// the recorded runs.
+type HistoryStore interface {
+	Versions(commandID int) ([]models.Version, error)
+	RollbackCommand(commandID, versionID int) error
+	Undo() (*Operation, error)
+	Redo() (*Operation, error)
+	Operations() ([]Operation, error)
+	InsertRun(r *models.Run) error
+	Runs(commandID, limit int) ([]models.Run, error)
+}
+
+// PlaybookStore holds playbooks with their steps.
+type PlaybookStore interface {
+	InsertPlaybook(p *models.Playbook) (int64, error)
+	UpdatePlaybook(p *models.Playbook) error
+	DeletePlaybook(id int) error
+	GetAllPlaybooks() ([]models.Playbook, error)
+	GetPlaybookByName(name string) (*models.Playbook, error)
+}
+
+// ScheduleStore holds the schedules run by the daemon.
+type ScheduleStore interface {
+	InsertSchedule(sc *models.Schedule) (int64, error)
+	DeleteSchedule(id int) error
+	GetAllSchedules() ([]models.Schedule, error)
+	SetScheduleLastRun(id int, at time.Time) error
+}
+
+// ProfileStore holds the environment profiles.
+type ProfileStore interface {
+	SaveEnvProfile(p *models.EnvProfile) error
+	DeleteEnvProfile(id int) error
+	GetEnvProfiles() ([]models.EnvProfile, error)
+	GetEnvProfileByName(name string) (*models.EnvProfile, error)
+}
+
+// SecretStore holds encrypted secret values; package secrets does the
+// encryption.
+type SecretStore interface {
+	SecretKey() (salt, verifier []byte, err error)
+	SetSecretKey(salt, verifier []byte) error
+	PutSecret(name string, value []byte) error
+	SecretValue(name string) ([]byte, error)
+	DeleteSecret(name string) error
+	Secrets() ([]models.Secret, error)
+}
+
+// Store is everything a vault backend provides.
+type Store interface {
+	CommandStore
+	TrashStore
+	HistoryStore
+	PlaybookStore
+	ScheduleStore
+	ProfileStore
+	SecretStore
+	Close() error
+}
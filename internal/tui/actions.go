@@ -2,10 +2,22 @@ package tui
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/editor"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/project"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/watch"
 )
 
 func (m *model) reloadCommands() {
@@ -16,11 +28,58 @@ func (m *model) reloadCommands() {
 		return
 	}
 	m.commands = commands
+	if m.project != nil {
+		m.commands = append(m.commands, m.project.Commands...)
+	}
+	m.pinned = models.SortPinned(m.commands)
 	if m.selected >= len(m.commands) {
 		m.selected = max(0, len(m.commands)-1)
 	}
 }
 
+func (m *model) reloadTrash() {
+	trash, err := m.store.TrashedCommands()
+	if err != nil {
+		m.footerMsg = "DB error: " + err.Error()
+		m.trash = nil
+		return
+	}
+	m.trash = trash
+	if m.selectedTrash >= len(m.trash) {
+		m.selectedTrash = max(0, len(m.trash)-1)
+	}
+}
+
+func (m *model) reloadVersions() {
+	if len(m.commands) == 0 {
+		m.versions = nil
+		return
+	}
+	versions, err := m.store.Versions(m.commands[m.selected].ID)
+	if err != nil {
+		m.footerMsg = "DB error: " + err.Error()
+		m.versions = nil
+		return
+	}
+	m.versions = versions
+	if m.selectedVersion >= len(m.versions) {
+		m.selectedVersion = max(0, len(m.versions)-1)
+	}
+}
+
+func (m *model) reloadPlaybooks() {
+	playbooks, err := m.store.GetAllPlaybooks()
+	if err != nil {
+		m.footerMsg = "DB error: " + err.Error()
+		m.playbooks = nil
+		return
+	}
+	m.playbooks = playbooks
+	if m.selectedPlaybook >= len(m.playbooks) {
+		m.selectedPlaybook = max(0, len(m.playbooks)-1)
+	}
+}
+
 func (m *model) reloadFiles() {
 	files, err := os.ReadDir(m.currentPath)
 	if err != nil {
@@ -28,41 +87,434 @@ func (m *model) reloadFiles() {
 		return
 	}
 	m.files = files
+	m.loadProject()
 }
 
-// run command in external shell (cmd /C), blocking and returning to TUI after completion.
-func (m *model) runSelectedCommand() tea.Cmd {
-	return func() tea.Msg {
-		if len(m.commands) == 0 {
-			return cmdFinishedMsg{err: nil, output: []byte("No command to run.")} // No command to run, just finish
+// loadProject picks up the project of the current path, so that moving
+// around in the file browser brings its commands into the list.
+func (m *model) loadProject() {
+	p, err := project.Load(m.currentPath)
+	if err != nil {
+		m.footerMsg = "Project error: " + err.Error()
+	}
+	m.project = p
+	m.reloadCommands()
+}
+
+// workDir is where c runs: the root of its project, or the current path.
+func (m *model) workDir(c models.Command) string {
+	if c.Project != "" {
+		return c.Project
+	}
+	return m.currentPath
+}
+
+// inProject reports whether the selected command comes from a project
+// file, which is where it gets changed, and says so in the footer.
+func (m *model) inProject() bool {
+	c := m.commands[m.selected]
+	if c.Project == "" {
+		return false
+	}
+	m.footerMsg = c.Name + " comes from " + filepath.Join(c.Project, project.FileName) + " - change it there"
+	return true
+}
+
+// togglePin pins the selected command, or unpins it, keeping it selected.
+func (m *model) togglePin() {
+	c := m.commands[m.selected]
+	if err := m.store.SetPinned(c.ID, !c.Pinned()); err != nil {
+		m.footerMsg = "DB error: " + err.Error()
+		return
+	}
+	m.reloadCommands()
+	m.selectCommand(c.ID)
+	if c.Pinned() {
+		m.footerMsg = "Unpinned " + c.Name
+	} else {
+		m.footerMsg = fmt.Sprintf("Pinned %s - press [%d] to run it", c.Name, m.selected+1)
+		if m.selected >= 9 {
+			m.footerMsg = "Pinned " + c.Name
 		}
-		c := m.commands[m.selected]
+	}
+}
+
+// recordUsage counts a run of c; project commands are not kept in the vault.
+func (m *model) recordUsage(c models.Command) {
+	if c.Project == "" {
 		_ = m.store.IncrementUsage(c.ID)
+	}
+}
 
-		var out bytes.Buffer
-		cmd := exec.Command("cmd", "/C", c.CommandStr) // #nosec G204
-		cmd.Dir = m.currentPath
-		cmd.Stdout = &out
-		cmd.Stderr = &out
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+// startJob runs c in its working directory as a background job.
+func (m *model) startJob(c models.Command) tea.Cmd {
+	// Placeholders can only take their defaults here; values come from 'cmd-vault run --set'.
+	body, err := runner.Expand(c.CommandStr, nil)
+	if err != nil {
+		m.footerMsg = c.Name + ": " + err.Error() + " - use 'cmd-vault run --set'"
+		return nil
+	}
+	body, secretVars, err := m.resolveSecrets(body, c.Interpreter)
+	if err != nil {
+		m.footerMsg = c.Name + ": " + err.Error()
+		return nil
+	}
+	m.nextJobID++
+	j, err := runner.StartJob(m.nextJobID, c.Name, body, c.Interpreter, m.workDir(c), runner.WithEnv(m.environ(c), secretVars))
+	if err != nil {
+		m.footerMsg = "Failed to start " + c.Name + ": " + err.Error()
+		return nil
+	}
+	m.recordUsage(c)
+	m.reloadCommands()
+	m.jobs = append(m.jobs, j)
+	m.footerMsg = fmt.Sprintf("Started job #%d: %s - [J] Jobs", j.ID, j.Name)
+	m.setOutput(fmt.Sprintf("Job #%d %s is running in the background.", j.ID, j.Name))
+	return waitJob(j)
+}
+
+// showPreview puts what running c in its working directory would do in the output panel.
+func (m *model) showPreview(c models.Command) {
+	body, err := runner.Expand(c.CommandStr, nil)
+	note := ""
+	if err != nil {
+		body = c.CommandStr
+		note = "\nNote: " + err.Error() + "; fill them with 'cmd-vault run --set name=value'.\n"
+	}
+	p, err := runner.NewPreview(body, c.Interpreter, m.workDir(c), append(m.profileVars(), c.Env...))
+	if err != nil {
+		m.setOutput("Preview failed: " + err.Error())
+		return
+	}
+	out := "Preview of " + c.Name + " (not run)\n\n" + p.String() + note
+	if reasons := m.checker.Check(body); len(reasons) > 0 {
+		out += "\nWarning: looks dangerous (" + strings.Join(reasons, ", ") + ")\n"
+	}
+	m.setOutput(out)
+	m.outputViewport.GotoTop()
+}
+
+// profileVars returns the variables of the active environment profile.
+func (m *model) profileVars() []string {
+	if m.profile == nil {
+		return nil
+	}
+	return m.profile.Vars
+}
+
+// environ returns the environment c runs with: the active profile with the
+// variables of c on top, or nil when neither sets anything.
+func (m *model) environ(c models.Command) []string {
+	return runner.Environ(m.profileVars(), c.Env)
+}
+
+// resolveSecrets turns the secret references of body into environment
+// variables of interpreter and returns the variables to add. startRun
+// unlocks the secrets before any run that needs them.
+func (m *model) resolveSecrets(body, interpreter string) (string, []string, error) {
+	if len(runner.SecretRefs(body)) == 0 {
+		return body, nil, nil
+	}
+	if m.secrets == nil {
+		return "", nil, errors.New("secrets are locked")
+	}
+	return runner.ResolveSecrets(body, interpreter, m.secrets.Get)
+}
+
+// waitJob reports j as a jobFinishedMsg once it exits.
+func waitJob(j *runner.Job) tea.Cmd {
+	return func() tea.Msg {
+		<-j.Done()
+		return jobFinishedMsg{job: j}
+	}
+}
+
+// tickJobs schedules the next refresh of the jobs panel unless one is pending.
+func (m *model) tickJobs() tea.Cmd {
+	if m.jobTicking {
+		return nil
+	}
+	m.jobTicking = true
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg { return jobTickMsg{} })
+}
+
+// showJobOutput puts the output of the selected job in the output panel,
+// following new output while the panel is scrolled to the bottom.
+func (m *model) showJobOutput() {
+	if len(m.jobs) == 0 {
+		m.setOutput("No jobs.")
+		return
+	}
+	j := m.jobs[m.selectedJob]
+	follow := m.outputViewport.AtBottom()
+	out := string(j.Output())
+	if err := j.Err(); err != nil {
+		out += "\n\nError: " + err.Error()
+	}
+	m.setOutput(out)
+	if follow {
+		m.outputViewport.GotoBottom()
+	}
+}
 
-		return cmdFinishedMsg{err: err, output: out.Bytes()}
+// clearFinishedJobs drops every job that is no longer running.
+func (m *model) clearFinishedJobs() {
+	running := m.jobs[:0]
+	for _, j := range m.jobs {
+		if j.Status() == runner.JobRunning {
+			running = append(running, j)
+		}
+	}
+	m.jobs = running
+	if m.selectedJob >= len(m.jobs) {
+		m.selectedJob = max(0, len(m.jobs)-1)
 	}
 }
 
 // runCustomCommand executes a given command string in the current path.
 func (m *model) runCustomCommand(commandStr string) tea.Cmd {
+	return func() tea.Msg {
+		out, err := runScript(commandStr, "", m.currentPath, runner.Environ(m.profileVars()))
+		// We don't increment usage as this is a one-off command
+		return cmdFinishedMsg{err: err, output: out}
+	}
+}
+
+// runScript runs body with the given interpreter in dir and env and returns the combined output.
+func runScript(body, interpreter, dir string, env []string) ([]byte, error) {
+	script, err := runner.Prepare(body, interpreter, dir, env)
+	if err != nil {
+		return nil, err
+	}
+	defer script.Cleanup()
+
+	var out bytes.Buffer
+	script.Cmd.Stdout = &out
+	script.Cmd.Stderr = &out
+	script.Cmd.Stdin = os.Stdin
+	err = script.Cmd.Run()
+	return out.Bytes(), err
+}
+
+// openCmdInEditor hands the command body of the add/edit form to $EDITOR.
+// The edited text comes back as an editorFinishedMsg.
+func (m *model) openCmdInEditor() tea.Cmd {
+	in, err := runner.Lookup(strings.TrimSpace(m.interpInput.Value()))
+	ext := in.Ext
+	if err != nil {
+		ext = ".txt"
+	}
+	path, err := editor.WriteTemp(m.cmdInput.Value(), ext)
+	if err != nil {
+		return func() tea.Msg { return editorFinishedMsg{err: err} }
+	}
+	return tea.ExecProcess(editor.Command(path), func(err error) tea.Msg {
+		defer os.Remove(path)
+		if err != nil {
+			return editorFinishedMsg{err: err}
+		}
+		content, err := os.ReadFile(path)
+		return editorFinishedMsg{content: strings.TrimRight(string(content), "\r\n"), err: err}
+	})
+}
+
+// editSelectedInEditor writes the selected command as a document and opens it
+// in $EDITOR. The file is kept until the edit is saved or abandoned so that a
+// document that fails to parse can be re-opened with the user's changes.
+func (m *model) editSelectedInEditor() tea.Cmd {
+	c := m.commands[m.selected]
+	m.editCommand = &c
+	path, err := editor.WriteTemp(document.Encode(&c), ".md")
+	if err != nil {
+		return func() tea.Msg { return docEditedMsg{err: err} }
+	}
+	m.docPath = path
+	return m.reopenDocEditor()
+}
+
+func (m *model) reopenDocEditor() tea.Cmd {
+	return tea.ExecProcess(editor.Command(m.docPath), func(err error) tea.Msg {
+		return docEditedMsg{err: err}
+	})
+}
+
+// discardDoc removes the document file of an editor session.
+func (m *model) discardDoc() {
+	if m.docPath != "" {
+		os.Remove(m.docPath)
+		m.docPath = ""
+	}
+}
+
+// startPlaybook resolves the steps of p and runs the first one.
+func (m *model) startPlaybook(p models.Playbook) tea.Cmd {
+	steps := runner.PlaybookSteps(&p, m.currentPath, m.profileVars(), m.store.GetByID)
+	for i := range steps {
+		if steps[i].Err != nil {
+			continue
+		}
+		body, secretVars, err := m.resolveSecrets(steps[i].Body, steps[i].Interpreter)
+		if err != nil {
+			steps[i].Err = err
+		}
+		steps[i].Body, steps[i].Env = body, runner.WithEnv(steps[i].Env, secretVars)
+	}
+	m.playbookRun = &playbookRun{playbook: p, steps: steps}
+	m.setOutput(fmt.Sprintf("Playbook %s (%d steps)\n", p.Name, len(p.Steps)))
+	return m.runPlaybookStep(0)
+}
+
+// runPlaybookStep runs step i of the current playbook in the background.
+func (m *model) runPlaybookStep(i int) tea.Cmd {
+	st := m.playbookRun.steps[i]
 	return func() tea.Msg {
 		var out bytes.Buffer
-		cmd := exec.Command("cmd", "/C", commandStr) // #nosec G204
-		cmd.Dir = m.currentPath
-		cmd.Stdout = &out
-		cmd.Stderr = &out
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		start := time.Now()
+		err := st.Run(&out, os.Stdin)
+		return playbookStepMsg{index: i, output: out.Bytes(), err: err, elapsed: time.Since(start)}
+	}
+}
 
-		// We don't increment usage as this is a one-off command
-		return cmdFinishedMsg{err: err, output: out.Bytes()}
+// watchDebounce is how long files must stay unchanged before a watched command re-runs.
+const watchDebounce = 300 * time.Millisecond
+
+// watchLogSize is how many iterations of a watch session the output panel keeps.
+const watchLogSize = 20
+
+// startWatch runs c in its working directory and again whenever a file below it changes.
+func (m *model) startWatch(c models.Command) tea.Cmd {
+	dir := m.workDir(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watch.Watcher{Root: dir, Debounce: watchDebounce}
+	changes, err := w.Watch(ctx)
+	if err != nil {
+		cancel()
+		m.footerMsg = "Watch failed: " + err.Error()
+		return nil
+	}
+	m.watch = &watchSession{command: c, dir: dir, cancel: cancel, changes: changes}
+	m.footerMsg = fmt.Sprintf("Watching %s for changes to re-run %s - [w] stop", dir, c.Name)
+	return tea.Batch(m.runWatchIteration(nil), waitWatchChange(m.watch))
+}
+
+// stopWatch ends the watch session and kills its running iteration.
+func (m *model) stopWatch() {
+	if m.watch == nil {
+		return
+	}
+	m.watch.cancel()
+	if m.watch.job != nil {
+		m.watch.job.Cancel()
+	}
+	m.watch = nil
+}
+
+// runWatchIteration starts the next run of the watched command, stopping the
+// previous one if it is still running.
+func (m *model) runWatchIteration(files []string) tea.Cmd {
+	ws := m.watch
+	if ws.job != nil && ws.job.Status() == runner.JobRunning {
+		ws.job.Cancel()
+		ws.finishEntry(ws.job, fmt.Sprintf("[%d] canceled", ws.iteration))
+	}
+	ws.iteration++
+	header := fmt.Sprintf("── [%d] %s", ws.iteration, ws.command.Name)
+	if len(files) > 0 {
+		header += " (changed: " + strings.Join(files, ", ") + ")"
+	}
+	body, secretVars, err := m.resolveSecrets(ws.command.CommandStr, ws.command.Interpreter)
+	var job *runner.Job
+	if err == nil {
+		job, err = runner.StartJob(ws.iteration, ws.command.Name, body, ws.command.Interpreter, ws.dir, runner.WithEnv(m.environ(ws.command), secretVars))
+	}
+	if err != nil {
+		ws.job = nil
+		m.appendWatchLog(header + "\n[" + fmt.Sprint(ws.iteration) + "] failed to start: " + err.Error())
+		return nil
+	}
+	m.recordUsage(ws.command)
+	ws.job = job
+	m.appendWatchLog(header + "\nrunning...")
+	return func() tea.Msg {
+		<-job.Done()
+		return watchRunDoneMsg{session: ws, job: job}
+	}
+}
+
+// finishEntry replaces the "running..." line of the latest iteration with
+// the output of job followed by status.
+func (ws *watchSession) finishEntry(job *runner.Job, status string) {
+	last := len(ws.log) - 1
+	header, _, _ := strings.Cut(ws.log[last], "\n")
+	ws.log[last] = header + "\n" + string(job.Output()) + status
+}
+
+// waitWatchChange waits for the next batch of changed files of ws.
+func waitWatchChange(ws *watchSession) tea.Cmd {
+	return func() tea.Msg {
+		files, ok := <-ws.changes
+		if !ok {
+			return nil
+		}
+		return watchChangeMsg{session: ws, files: files}
+	}
+}
+
+// appendWatchLog adds an iteration to the watch log and shows it when the
+// output panel belongs to the command list.
+func (m *model) appendWatchLog(entry string) {
+	ws := m.watch
+	ws.log = append(ws.log, entry)
+	if len(ws.log) > watchLogSize {
+		ws.log = ws.log[len(ws.log)-watchLogSize:]
+	}
+	m.showWatchLog()
+}
+
+func (m *model) showWatchLog() {
+	if m.watch == nil || m.state != stateNormal {
+		return
+	}
+	m.setOutput(strings.Join(m.watch.log, "\n\n"))
+	m.outputViewport.GotoBottom()
+}
+
+// markedDirList returns the marked directories in a stable order.
+func (m *model) markedDirList() []string {
+	dirs := make([]string, 0, len(m.markedDirs))
+	for dir := range m.markedDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// runInMarkedDirs runs c in every marked directory in the background.
+func (m *model) runInMarkedDirs(c models.Command) tea.Cmd {
+	dirs := m.markedDirList()
+	jobs := m.cfg.ParallelJobs
+	body, secretVars, err := m.resolveSecrets(c.CommandStr, c.Interpreter)
+	if err != nil {
+		return func() tea.Msg { return cmdFinishedMsg{err: err} }
+	}
+	env := runner.WithEnv(m.environ(c), secretVars)
+	m.recordUsage(c)
+	return func() tea.Msg {
+		return dirRunFinishedMsg{name: c.Name, results: runner.RunInDirs(body, c.Interpreter, env, dirs, jobs)}
+	}
+}
+
+// showDirResult puts the output of the selected directory result in the output panel.
+func (m *model) showDirResult() {
+	if len(m.dirResults) == 0 {
+		m.setOutput("")
+		return
+	}
+	res := m.dirResults[m.selectedResult]
+	out := string(res.Output)
+	if res.Err != nil {
+		out += "\n\nError: " + res.Err.Error()
 	}
+	m.setOutput(out)
+	m.outputViewport.GotoTop()
 }
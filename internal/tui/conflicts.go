@@ -0,0 +1,155 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/kanekitakitos/cmd-vault/internal/document"
+	"github.com/kanekitakitos/cmd-vault/internal/gitsync"
+)
+
+const conflictFooter = "↑/↓: Select | l: Keep Local | r: Keep Remote | Enter: Sync | q: Cancel"
+
+// conflictModel lets the user pick a side for every sync conflict.
+type conflictModel struct {
+	conflicts []*gitsync.Conflict
+	selected  int
+	width     int
+	height    int
+	footerMsg string
+	done      bool
+}
+
+// ResolveConflicts shows the conflicts of a sync and lets the user keep the
+// local or the remote version of each command. It reports false when the
+// user cancelled the sync.
+func ResolveConflicts(conflicts []*gitsync.Conflict) (bool, error) {
+	p := tea.NewProgram(conflictModel{conflicts: conflicts}, tea.WithAltScreen())
+	final, err := p.Run()
+	if err != nil {
+		return false, err
+	}
+	fm, ok := final.(conflictModel)
+	return ok && fm.done, nil
+}
+
+func (m conflictModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m conflictModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		m.footerMsg = ""
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			if m.selected > 0 {
+				m.selected--
+			}
+		case "down", "j":
+			if m.selected < len(m.conflicts)-1 {
+				m.selected++
+			}
+		case "l":
+			m.choose(gitsync.KeepLocal)
+		case "r":
+			m.choose(gitsync.KeepRemote)
+		case "enter":
+			for i, c := range m.conflicts {
+				if c.Choice == gitsync.Unresolved {
+					m.selected = i
+					m.footerMsg = "Pick a side for " + c.Name + " first"
+					return m, nil
+				}
+			}
+			m.done = true
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+// choose resolves the selected conflict and moves on to the next one.
+func (m *conflictModel) choose(choice gitsync.Choice) {
+	m.conflicts[m.selected].Choice = choice
+	if m.selected < len(m.conflicts)-1 {
+		m.selected++
+	}
+}
+
+func (m conflictModel) View() string {
+	if m.width == 0 || m.height == 0 {
+		return "Initializing..."
+	}
+	footer := conflictFooter
+	if m.footerMsg != "" {
+		footer = m.footerMsg
+	}
+	leftWidth := int(float32(m.width-4) * 0.35)
+	rightWidth := m.width - 4 - leftWidth
+	height := m.height - 4
+	left := panelStyle.Width(leftWidth).Height(height).Render(renderConflictList(m.conflicts, m.selected))
+	right := panelStyle.Width(rightWidth).Height(height).Render(renderConflict(m.conflicts[m.selected]))
+	return lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.JoinHorizontal(lipgloss.Top, left, right),
+		footerStyle.Width(m.width).Render(footer))
+}
+
+func renderConflictList(conflicts []*gitsync.Conflict, selected int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Sync Conflicts (%d)", len(conflicts))))
+	b.WriteString("\n")
+	for i, c := range conflicts {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		mark := "[ ]"
+		switch c.Choice {
+		case gitsync.KeepLocal:
+			mark = "[L]"
+		case gitsync.KeepRemote:
+			mark = "[R]"
+		}
+		b.WriteString(style.Render(prefix+mark+" "+c.Name) + "\n")
+	}
+	return b.String()
+}
+
+// renderConflict explains a conflict and shows how the remote version
+// differs from the local one.
+func renderConflict(c *gitsync.Conflict) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(c.Name) + "\n")
+	switch {
+	case c.Local == nil:
+		b.WriteString(warningStyle.Render("Deleted here, edited on the remote.") + "\n\n")
+		b.WriteString(document.Encode(c.Remote))
+		return b.String()
+	case c.Remote == nil:
+		b.WriteString(warningStyle.Render("Edited here, deleted on the remote.") + "\n\n")
+		b.WriteString(document.Encode(c.Local))
+		return b.String()
+	case len(c.Fields) > 0:
+		b.WriteString(warningStyle.Render("Both sides changed: "+strings.Join(c.Fields, ", ")) + "\n")
+	}
+	b.WriteString(diffDelStyle.Render("- local") + "  " + diffAddStyle.Render("+ remote") + "\n\n")
+	for _, line := range strings.Split(strings.TrimSuffix(document.Diff(c.Local, c.Remote), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			line = diffAddStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = diffDelStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
@@ -11,28 +11,72 @@ func (m *model) handleTab() {
 		m.noteInput.Focus()
 	} else if m.noteInput.Focused() {
 		m.noteInput.Blur()
+		m.interpInput.Focus()
+	} else if m.interpInput.Focused() {
+		m.interpInput.Blur()
+		m.tagsInput.Focus()
+	} else if m.tagsInput.Focused() {
+		m.tagsInput.Blur()
+		m.envInput.Focus()
+	} else if m.envInput.Focused() {
+		m.envInput.Blur()
 		m.nameInput.Focus()
 	}
 }
 
-func (m *model) handleVerticalNav(key string) {
+// handleVerticalNav moves focus between fields and reports whether it did.
+// Inside the command textarea the arrows move the cursor between lines and
+// only leave the field from its first or last line.
+func (m *model) handleVerticalNav(key string) bool {
 	if key == "down" {
 		if m.nameInput.Focused() {
 			m.nameInput.Blur()
 			m.cmdInput.Focus()
-		} else if m.cmdInput.Focused() {
+		} else if m.cmdInput.Focused() && m.cmdInput.Line() >= m.cmdInput.LineCount()-1 {
 			m.cmdInput.Blur()
 			m.noteInput.Focus()
+		} else if m.noteInput.Focused() {
+			m.noteInput.Blur()
+			m.interpInput.Focus()
+		} else if m.interpInput.Focused() {
+			m.interpInput.Blur()
+			m.tagsInput.Focus()
+		} else if m.tagsInput.Focused() {
+			m.tagsInput.Blur()
+			m.envInput.Focus()
+		} else {
+			return false
 		}
 	} else if key == "up" {
-		if m.noteInput.Focused() {
+		if m.envInput.Focused() {
+			m.envInput.Blur()
+			m.tagsInput.Focus()
+		} else if m.tagsInput.Focused() {
+			m.tagsInput.Blur()
+			m.interpInput.Focus()
+		} else if m.interpInput.Focused() {
+			m.interpInput.Blur()
+			m.noteInput.Focus()
+		} else if m.noteInput.Focused() {
 			m.noteInput.Blur()
 			m.cmdInput.Focus()
-		} else if m.cmdInput.Focused() {
+		} else if m.cmdInput.Focused() && m.cmdInput.Line() == 0 {
 			m.cmdInput.Blur()
 			m.nameInput.Focus()
+		} else {
+			return false
 		}
 	}
+	return true
+}
+
+func (m *model) blurInputs() {
+	m.nameInput.Blur()
+	m.cmdInput.Blur()
+	m.noteInput.Blur()
+	m.interpInput.Blur()
+	m.tagsInput.Blur()
+	m.envInput.Blur()
 }
 
 func (m model) updateInputs(msg tea.Msg) (model, tea.Cmd) {
@@ -44,5 +88,11 @@ func (m model) updateInputs(msg tea.Msg) (model, tea.Cmd) {
 	cmds = append(cmds, newCmd)
 	m.noteInput, newCmd = m.noteInput.Update(msg)
 	cmds = append(cmds, newCmd)
+	m.interpInput, newCmd = m.interpInput.Update(msg)
+	cmds = append(cmds, newCmd)
+	m.tagsInput, newCmd = m.tagsInput.Update(msg)
+	cmds = append(cmds, newCmd)
+	m.envInput, newCmd = m.envInput.Update(msg)
+	cmds = append(cmds, newCmd)
 	return m, tea.Batch(cmds...)
 }
@@ -1,15 +1,25 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"os"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/kanekitakitos/cmd-vault/internal/db"
+	"github.com/kanekitakitos/cmd-vault/internal/config"
 	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/project"
+	"github.com/kanekitakitos/cmd-vault/internal/redact"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/safety"
+	"github.com/kanekitakitos/cmd-vault/internal/secrets"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
 )
 
 type viewMode int
@@ -30,43 +40,204 @@ const (
 	stateOutputFocus
 	stateContextHelp
 	stateSelectCmdToPaste
+	stateConfirmReEdit
+	stateTrash
+	stateConfirmPurge
+	stateVersions
+	stateSelectPlaybook
+	stateSelectCmdForDirs
+	stateDirResults
+	stateJobs
+	stateConfirmDangerous
+	stateSelectEnvProfile
+	stateUnlockSecrets
+	stateSelectVault
+	stateUnlockVault
+	stateMoveCommand
 )
 
+// runAction is something the user asked to run that may need confirmation.
+type runAction int
+
+const (
+	runAsJob runAction = iota
+	runWatched
+	runInDirs
+	runPlaybook
+)
+
+// pendingRun is a run waiting for the user to type the name of a dangerous
+// command or the secrets passphrase.
+type pendingRun struct {
+	action   runAction
+	command  models.Command
+	playbook models.Playbook
+	name     string // what has to be typed to confirm
+	reasons  []string
+	back     state // where to return when cancelled
+	mismatch bool  // the last typed name was wrong
+}
+
 // cmdFinishedMsg is sent when a command finishes running.
 type cmdFinishedMsg struct {
 	err    error
 	output []byte
 }
 
+// playbookStepMsg is sent when one step of a running playbook finishes.
+type playbookStepMsg struct {
+	index   int
+	output  []byte
+	err     error
+	elapsed time.Duration
+}
+
+// playbookRun tracks a playbook executing in the TUI.
+type playbookRun struct {
+	playbook models.Playbook
+	steps    []runner.Step
+	failed   int
+}
+
+// dirRunFinishedMsg is sent when a command has run in all marked directories.
+type dirRunFinishedMsg struct {
+	name    string
+	results []runner.DirResult
+}
+
+// jobFinishedMsg is sent when a background job exits.
+type jobFinishedMsg struct {
+	job *runner.Job
+}
+
+// jobTickMsg refreshes the jobs panel while it is open.
+type jobTickMsg struct{}
+
+// watchSession re-runs a command in the TUI whenever files change.
+type watchSession struct {
+	command   models.Command
+	dir       string
+	cancel    context.CancelFunc
+	changes   <-chan []string
+	job       *runner.Job
+	iteration int
+	log       []string // output and status of the latest iterations
+}
+
+// watchChangeMsg carries a batch of changed files from a watch session.
+type watchChangeMsg struct {
+	session *watchSession
+	files   []string
+}
+
+// watchRunDoneMsg is sent when an iteration of a watch session exits.
+type watchRunDoneMsg struct {
+	session *watchSession
+	job     *runner.Job
+}
+
+// docEditedMsg is sent when $EDITOR exits after editing a command document.
+type docEditedMsg struct {
+	err error
+}
+
+// editorFinishedMsg carries the command body back from $EDITOR.
+type editorFinishedMsg struct {
+	content string
+	err     error
+}
+
 type model struct {
-	store         *db.Store
+	store         storage.Store
+	cfg           config.Config
+	checker       *safety.Checker
+	redactor      *redact.Redactor
 	viewMode      viewMode
 	commands      []models.Command
+	pinned        int // the first pinned entries of commands are pinned
 	selected      int
+	folder        string          // selected folder of the tree, "" when a command is selected
+	collapsed     map[string]bool // folders of the tree whose contents are hidden
+	trash         []models.Command
+	selectedTrash int
 	width         int
 	height        int
 	state         state
 	previousState state
 
+	// edit history of the selected command
+	versions        []models.Version
+	selectedVersion int
+
+	// playbooks
+	playbooks        []models.Playbook
+	selectedPlaybook int
+	playbookRun      *playbookRun
+
+	// background jobs
+	jobs        []*runner.Job
+	selectedJob int
+	nextJobID   int
+	jobTicking  bool
+
+	// watch mode
+	watch *watchSession
+
+	// environment profile applied to every run, nil for none
+	profile         *models.EnvProfile
+	profiles        []models.EnvProfile
+	selectedProfile int
+
+	// named vaults to switch between
+	vaults        Vaults
+	vaultNames    []string
+	selectedVault int
+	switchingTo   string // vault waiting for its passphrase
+
 	// file browser
 	files        []os.DirEntry
 	selectedFile int
 	currentPath  string
+	markedDirs   map[string]bool
+
+	// project of the current path, whose commands follow the vault's
+	project *project.Project
+
+	// results of running a command across the marked directories
+	dirRunName     string
+	dirResults     []runner.DirResult
+	selectedResult int
 
 	// actions panel
 	actions        []string
 	selectedAction int
 
 	// inputs for add/edit
-	nameInput textinput.Model
-	cmdInput  textinput.Model
-	noteInput textinput.Model
+	nameInput   textinput.Model
+	cmdInput    textarea.Model
+	noteInput   textinput.Model
+	interpInput textinput.Model
+	tagsInput   textinput.Model
+	envInput    textinput.Model
 
 	// input for one-off run
 	runInput textinput.Model
 
+	// typed confirmation of a dangerous run
+	pending      *pendingRun
+	confirmInput textinput.Model
+
+	// folder to move the selected command to
+	folderInput textinput.Model
+
+	// secrets, unlocked with passInput the first time a run needs them
+	secrets   *secrets.Vault
+	passInput textinput.Model
+
 	// temp for edit
 	editCommand *models.Command
+	// document file being edited in $EDITOR
+	docPath string
 
 	// message / footer
 	footerMsg        string
@@ -77,16 +248,29 @@ type model struct {
 	outputViewport viewport.Model
 }
 
-func RunTUI(store *db.Store) error {
-	m := initialModel(store)
+// RunTUI runs the interactive interface until the user quits. profile is the
+// environment profile to start with and may be nil.
+//
+// The user may switch to another of the vaults while the TUI runs, so
+// RunTUI takes over store and closes whichever vault is open when it exits.
+func RunTUI(store storage.Store, cfg config.Config, profile *models.EnvProfile, vaults Vaults) error {
+	m := initialModel(store, cfg)
+	m.profile = profile
+	m.vaults = vaults
 	p := tea.NewProgram(m, tea.WithAltScreen())
-	if err := p.Start(); err != nil {
-		return err
+	final, err := p.Run()
+	if fm, ok := final.(model); ok {
+		// Don't leave background jobs running after the TUI is gone.
+		for _, j := range fm.jobs {
+			j.Cancel()
+		}
+		fm.stopWatch()
+		store = fm.store
 	}
-	return nil
+	return errors.Join(err, store.Close())
 }
 
-func initialModel(store *db.Store) model {
+func initialModel(store storage.Store, cfg config.Config) model {
 	name := textinput.New()
 	name.Placeholder = "name (unique)"
 	name.CharLimit = 64
@@ -94,28 +278,75 @@ func initialModel(store *db.Store) model {
 	// Set initial focus
 	name.Focus()
 
-	cmdi := textinput.New()
-	cmdi.Placeholder = "command (e.g. echo %PATH%)"
-	cmdi.CharLimit = 256
-	cmdi.Width = 50
+	// Command bodies may be whole scripts, so the textarea has no length cap.
+	cmdi := textarea.New()
+	cmdi.Placeholder = "command or script (e.g. echo %PATH%)"
+	cmdi.CharLimit = 0
+	cmdi.MaxHeight = 0
+	cmdi.SetWidth(60)
+	cmdi.SetHeight(8)
 
 	note := textinput.New()
 	note.Placeholder = "note (required)"
 	note.CharLimit = 512
 	note.Width = 60
 
+	interp := textinput.New()
+	interp.Placeholder = "interpreter (default: " + runner.DefaultInterpreter() + ")"
+	interp.CharLimit = 32
+	interp.Width = 30
+
+	tags := textinput.New()
+	tags.Placeholder = "tags (comma separated)"
+	tags.CharLimit = 256
+	tags.Width = 50
+
+	env := textinput.New()
+	env.Placeholder = `environment (KEY=value; KEY2=a\;b)`
+	env.CharLimit = 1024
+	env.Width = 50
+
 	run := textinput.New()
 	run.Placeholder = "command to run in current path..."
 	run.CharLimit = 256
 	run.Width = 60
 
+	confirm := textinput.New()
+	confirm.CharLimit = 64
+	confirm.Width = 30
+
+	folder := textinput.New()
+	folder.Placeholder = "folder, e.g. k8s/logs"
+	folder.CharLimit = 64
+	folder.Width = 30
+
+	pass := textinput.New()
+	pass.Placeholder = "passphrase"
+	pass.EchoMode = textinput.EchoPassword
+	pass.CharLimit = 256
+	pass.Width = 30
+
 	wd, err := os.Getwd()
 	if err != nil {
 		wd = "." // Fallback to relative path on error
 	}
 
+	// The config was validated when it was loaded; without it only the
+	// built-in rules apply.
+	checker, err := cfg.Checker()
+	if err != nil {
+		checker, _ = safety.New(nil)
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		redactor, _ = redact.New(nil)
+	}
+
 	m := model{
 		store:            store,
+		cfg:              cfg,
+		checker:          checker,
+		redactor:         redactor,
 		selected:         0,
 		state:            stateNormal,
 		nameInput:        name,
@@ -124,15 +355,24 @@ func initialModel(store *db.Store) model {
 		outputViewport:   viewport.New(80, 20), // Will be resized
 		cmdInput:         cmdi,
 		noteInput:        note,
+		interpInput:      interp,
+		tagsInput:        tags,
+		envInput:         env,
 		runInput:         run,
+		confirmInput:     confirm,
+		folderInput:      folder,
+		collapsed:        map[string]bool{},
+		passInput:        pass,
 		currentPath:      wd,
+		markedDirs:       map[string]bool{},
 		actions:          []string{"Add Command", "Edit Command", "Delete Command"},
 		selectedAction:   0,
 	}
 	m.outputViewport.SetContent(m.commandOutput)
 
-	m.reloadCommands()
 	m.reloadFiles()
+	m.reloadCommands()
+	m.selectFirst()
 	return m
 }
 
@@ -149,7 +389,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.String() == "ctrl+c" {
 			return m, tea.Quit
 		}
-		if msg.String() == "q" && m.state != stateAdd && m.state != stateEdit && m.state != stateRunInPath && m.state != stateOutputFocus {
+		if msg.String() == "q" && m.state != stateAdd && m.state != stateEdit && m.state != stateRunInPath && m.state != stateOutputFocus && m.state != stateConfirmReEdit && m.state != stateConfirmDangerous && m.state != stateUnlockSecrets && m.state != stateUnlockVault && m.state != stateMoveCommand {
 			return m, tea.Quit
 		}
 		switch m.state {
@@ -177,6 +417,34 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateContextHelp(msg)
 		case stateSelectCmdToPaste:
 			return m.updateSelectCmdToPaste(msg)
+		case stateConfirmReEdit:
+			return m.updateConfirmReEdit(msg)
+		case stateTrash:
+			return m.updateTrash(msg)
+		case stateConfirmPurge:
+			return m.updateConfirmPurge(msg)
+		case stateVersions:
+			return m.updateVersions(msg)
+		case stateSelectPlaybook:
+			return m.updateSelectPlaybook(msg)
+		case stateSelectCmdForDirs:
+			return m.updateSelectCmdForDirs(msg)
+		case stateDirResults:
+			return m.updateDirResults(msg)
+		case stateJobs:
+			return m.updateJobs(msg)
+		case stateConfirmDangerous:
+			return m.updateConfirmDangerous(msg)
+		case stateSelectEnvProfile:
+			return m.updateSelectEnvProfile(msg)
+		case stateUnlockSecrets:
+			return m.updateUnlockSecrets(msg)
+		case stateSelectVault:
+			return m.updateSelectVault(msg)
+		case stateUnlockVault:
+			return m.updateUnlockVault(msg)
+		case stateMoveCommand:
+			return m.updateMoveCommand(msg)
 		case stateRunningCmd:
 			return m, nil
 		}
@@ -195,17 +463,44 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			outputStr = string(msg.output)
 		}
 
-		m.rawCommandOutput = outputStr // Store the raw, unwrapped output
-
-		// Wrap the output string to fit the panel width to prevent breaking the layout.
-		outputPanelWidth := m.getOutputPanelWidth()
-		wrappedOutput := lipgloss.NewStyle().Width(outputPanelWidth).Render(outputStr)
-
-		m.commandOutput = wrappedOutput // Keep the full, wrapped output for now
-		m.outputViewport.SetContent(wrappedOutput)
+		m.setOutput(outputStr)
 		m.outputViewport.GotoTop() // Scroll to top to see the new output
 		m.reloadCommands()
 		return m, nil
+	case dirRunFinishedMsg:
+		m.state = stateDirResults
+		m.dirRunName = msg.name
+		m.dirResults = msg.results
+		m.selectedResult = 0
+		m.showDirResult()
+		m.reloadCommands()
+		m.footerMsg = dirResultsFooter
+		return m, nil
+	case jobFinishedMsg:
+		return m.handleJobFinished(msg)
+	case jobTickMsg:
+		m.jobTicking = false
+		if m.state == stateJobs || (m.state == stateOutputFocus && m.previousState == stateJobs) {
+			m.showJobOutput()
+			return m, m.tickJobs()
+		}
+		return m, nil
+	case watchChangeMsg:
+		return m.handleWatchChange(msg)
+	case watchRunDoneMsg:
+		return m.handleWatchRunDone(msg)
+	case playbookStepMsg:
+		return m.handlePlaybookStep(msg)
+	case docEditedMsg:
+		return m.handleDocEdited(msg)
+	case editorFinishedMsg:
+		if msg.err != nil {
+			m.footerMsg = "Editor error: " + msg.err.Error()
+			return m, nil
+		}
+		m.cmdInput.SetValue(msg.content)
+		m.footerMsg = "Command updated from editor"
+		return m, nil
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -226,6 +521,20 @@ func (m model) View() string {
 	return m.renderView()
 }
 
+// setOutput replaces the output panel content with outputStr, masking
+// secrets first.
+func (m *model) setOutput(outputStr string) {
+	outputStr = m.redactor.Redact(outputStr)
+	m.rawCommandOutput = outputStr // Store the raw, unwrapped output
+
+	// Wrap the output string to fit the panel width to prevent breaking the layout.
+	outputPanelWidth := m.getOutputPanelWidth()
+	wrappedOutput := lipgloss.NewStyle().Width(outputPanelWidth).Render(outputStr)
+
+	m.commandOutput = wrappedOutput // Keep the full, wrapped output for now
+	m.outputViewport.SetContent(wrappedOutput)
+}
+
 // getOutputPanelWidth calculates the width of the output panel based on the current view mode and window size.
 // This is used to wrap long lines in the command output correctly.
 func (m *model) getOutputPanelWidth() int {
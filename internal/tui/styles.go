@@ -23,4 +23,14 @@ var (
 	titleStyle = lipgloss.NewStyle().
 			Foreground(primaryColor).
 			Bold(true)
+	lineNumberStyle = lipgloss.NewStyle().
+			Foreground(secondaryColor)
+	diffAddStyle = lipgloss.NewStyle().
+			Foreground(primaryColor).
+			Bold(true)
+	diffDelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#CD3232"))
+	warningStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#CD3232")).
+			Bold(true)
 )
@@ -0,0 +1,289 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+)
+
+// listRow is one line of the command list: a command, or a folder of the
+// tree that names like k8s/logs/tail make.
+type listRow struct {
+	folder  string // full path of a folder row, "" for a command row
+	command int    // index into commands of a command row
+	depth   int
+}
+
+// folderNode is a folder of the command tree while it is being built.
+type folderNode struct {
+	folders  map[string]*folderNode
+	commands []int
+}
+
+// buildRows lays out the pinned commands, then the others as a tree.
+// Folders come before the commands next to them and the contents of
+// collapsed folders are left out.
+func buildRows(commands []models.Command, pinned int, collapsed map[string]bool) []listRow {
+	var rows []listRow
+	root := &folderNode{folders: map[string]*folderNode{}}
+	for i := range commands {
+		if i < pinned {
+			rows = append(rows, listRow{command: i})
+			continue
+		}
+		node := root
+		if folder := models.Folder(commands[i].Name); folder != "" {
+			for _, part := range strings.Split(folder, "/") {
+				child := node.folders[part]
+				if child == nil {
+					child = &folderNode{folders: map[string]*folderNode{}}
+					node.folders[part] = child
+				}
+				node = child
+			}
+		}
+		node.commands = append(node.commands, i)
+	}
+	var walk func(node *folderNode, path string, depth int)
+	walk = func(node *folderNode, path string, depth int) {
+		names := make([]string, 0, len(node.folders))
+		for name := range node.folders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			full := name
+			if path != "" {
+				full = path + "/" + name
+			}
+			rows = append(rows, listRow{folder: full, depth: depth})
+			if !collapsed[full] {
+				walk(node.folders[name], full, depth+1)
+			}
+		}
+		for _, i := range node.commands {
+			rows = append(rows, listRow{command: i, depth: depth})
+		}
+	}
+	walk(root, "", 0)
+	return rows
+}
+
+func (m model) listRows() []listRow {
+	return buildRows(m.commands, m.pinned, m.collapsed)
+}
+
+// selectedRow finds the row of the selected folder or command. A command
+// hidden in a collapsed folder is represented by the outermost such folder.
+func (m model) selectedRow(rows []listRow) int {
+	if m.folder != "" {
+		for i, r := range rows {
+			if r.folder == m.folder {
+				return i
+			}
+		}
+	}
+	if m.selected >= len(m.commands) {
+		return 0
+	}
+	hidden := ""
+	if m.selected >= m.pinned {
+		name := m.commands[m.selected].Name
+		for folder := models.Folder(name); folder != ""; folder = models.Folder(folder) {
+			if m.collapsed[folder] {
+				hidden = folder
+			}
+		}
+	}
+	for i, r := range rows {
+		if (hidden == "" && r.folder == "" && r.command == m.selected) || (hidden != "" && r.folder == hidden) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (m *model) selectRow(r listRow) {
+	m.folder = r.folder
+	if r.folder == "" {
+		m.selected = r.command
+	}
+}
+
+// syncSelection makes the selection point at a visible row again after
+// folders were collapsed or commands reloaded.
+func (m *model) syncSelection() {
+	rows := m.listRows()
+	if len(rows) == 0 {
+		m.folder = ""
+		return
+	}
+	m.selectRow(rows[m.selectedRow(rows)])
+}
+
+// selectFirst selects the top row of the list.
+func (m *model) selectFirst() {
+	m.folder = ""
+	m.selected = 0
+	if rows := m.listRows(); len(rows) > 0 {
+		m.selectRow(rows[0])
+	}
+}
+
+// selectCommand selects the command with the given id, expanding the
+// folders it is in.
+func (m *model) selectCommand(id int) {
+	for i := range m.commands {
+		if m.commands[i].ID != id {
+			continue
+		}
+		m.selected, m.folder = i, ""
+		for folder := models.Folder(m.commands[i].Name); folder != ""; folder = models.Folder(folder) {
+			delete(m.collapsed, folder)
+		}
+	}
+}
+
+func (m *model) moveSelection(delta int) {
+	rows := m.listRows()
+	if len(rows) == 0 {
+		return
+	}
+	i := m.selectedRow(rows) + delta
+	if i >= 0 && i < len(rows) {
+		m.selectRow(rows[i])
+	}
+}
+
+// current returns the selected command, or nil when there is none or a
+// folder is selected.
+func (m model) current() *models.Command {
+	if m.folder != "" || len(m.commands) == 0 {
+		return nil
+	}
+	return &m.commands[m.selected]
+}
+
+// collapseOrParent collapses the selected folder, or else moves up to the
+// folder of the selection.
+func (m *model) collapseOrParent() {
+	if m.folder != "" && !m.collapsed[m.folder] {
+		m.collapsed[m.folder] = true
+		return
+	}
+	var parent string
+	switch {
+	case m.folder != "":
+		parent = models.Folder(m.folder)
+	case len(m.commands) > 0 && m.selected >= m.pinned:
+		parent = models.Folder(m.commands[m.selected].Name)
+	}
+	if parent != "" {
+		m.folder = parent
+	}
+}
+
+// expandOrEnter expands the selected folder, or moves into it when it is
+// already expanded.
+func (m *model) expandOrEnter() {
+	if m.folder == "" {
+		return
+	}
+	if m.collapsed[m.folder] {
+		delete(m.collapsed, m.folder)
+		return
+	}
+	m.moveSelection(1)
+}
+
+func (m *model) toggleFolder() {
+	if m.collapsed[m.folder] {
+		delete(m.collapsed, m.folder)
+	} else {
+		m.collapsed[m.folder] = true
+	}
+}
+
+// folderCommands returns the commands in folder and its subfolders,
+// leaving out the pinned ones.
+func folderCommands(commands []models.Command, pinned int, folder string) []models.Command {
+	var out []models.Command
+	for _, c := range commands[pinned:] {
+		if models.InFolder(c.Name, folder) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// openMoveCommand asks for the folder to move the selected command to.
+func (m model) openMoveCommand() (tea.Model, tea.Cmd) {
+	c := m.current()
+	if c == nil {
+		m.footerMsg = "Select a command to move"
+		return m, nil
+	}
+	if m.inProject() {
+		return m, nil
+	}
+	m.state = stateMoveCommand
+	m.folderInput.SetValue(models.Folder(c.Name))
+	m.folderInput.CursorEnd()
+	m.footerMsg = "Move " + c.Name + " - type a folder (empty for the top level) and press Enter, Esc to cancel"
+	return m, m.folderInput.Focus()
+}
+
+func (m model) updateMoveCommand(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		c := *m.current()
+		name := models.MoveToFolder(c.Name, m.folderInput.Value())
+		m.state = stateNormal
+		m.folderInput.Blur()
+		if name == c.Name {
+			m.footerMsg = c.Name + " is already there"
+			return m, nil
+		}
+		old := c.Name
+		c.Name = name
+		if err := m.store.UpdateCommand(&c); err != nil {
+			m.footerMsg = "Move failed: " + err.Error()
+			return m, nil
+		}
+		m.reloadCommands()
+		m.selectCommand(c.ID)
+		m.footerMsg = fmt.Sprintf("Moved %s to %s", old, name)
+		return m, nil
+	case "esc":
+		m.state = stateNormal
+		m.folderInput.Blur()
+		m.footerMsg = "Move cancelled"
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.folderInput, cmd = m.folderInput.Update(msg)
+	return m, cmd
+}
+
+func renderMoveCommand(name, input string) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Move Command") + "\n\n")
+	b.WriteString("Folder for " + name + ":\n")
+	b.WriteString(input + "\n")
+	b.WriteString("\nEnter to move, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
+func renderFolder(folder string, commands []models.Command) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(folder+"/") + "\n")
+	b.WriteString(lineNumberStyle.Render(fmt.Sprintf("%d commands", len(commands))) + "\n")
+	for _, c := range commands {
+		b.WriteString("  " + strings.TrimPrefix(c.Name, folder+"/") + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
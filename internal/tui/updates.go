@@ -1,69 +1,208 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/atotto/clipboard"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kanekitakitos/cmd-vault/internal/document"
 	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/secrets"
 )
 
 func (m model) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.syncSelection()
 	switch msg.String() {
 	case "up", "k":
-		if m.selected > 0 {
-			m.selected--
-		}
+		m.moveSelection(-1)
 	case "down", "j":
-		if m.selected < len(m.commands)-1 {
-			m.selected++
+		m.moveSelection(1)
+	case "left":
+		m.collapseOrParent()
+	case "right":
+		m.expandOrEnter()
+	case "enter":
+		if m.folder != "" {
+			m.toggleFolder()
 		}
+	case "m":
+		return m.openMoveCommand()
 	case "tab":
 		m.viewMode = (m.viewMode + 1) % 2 // Toggles between 0 and 1
-		m.selected = 0
+		m.selectFirst()
 	case "a", "A":
 		m.state = stateAdd
 		m.nameInput.SetValue("")
 		m.cmdInput.SetValue("")
 		m.noteInput.SetValue("")
-		m.footerMsg = "Add mode - fill fields and press Enter to save, Esc to cancel"
+		m.interpInput.SetValue("")
+		m.tagsInput.SetValue("")
+		m.envInput.SetValue("")
+		m.footerMsg = "Add mode - fill fields and press Ctrl+S to save, Esc to cancel"
 		return m, m.nameInput.Focus()
 	case "e", "E":
-		if len(m.commands) == 0 {
+		if m.current() == nil {
 			m.footerMsg = "No command to edit"
 			return m, nil
 		}
+		if m.inProject() {
+			return m, nil
+		}
 		m.state = stateEdit
 		c := m.commands[m.selected]
 		m.editCommand = &c
 		m.nameInput.SetValue(c.Name)
 		m.cmdInput.SetValue(c.CommandStr)
 		m.noteInput.SetValue(c.Note)
-		m.footerMsg = "Edit mode - change fields and press Enter to save, Esc to cancel"
+		m.interpInput.SetValue(c.Interpreter)
+		m.tagsInput.SetValue(strings.Join(c.Tags, ", "))
+		m.envInput.SetValue(models.FormatEnvLine(c.Env))
+		m.footerMsg = "Edit mode - change fields and press Ctrl+S to save, Esc to cancel"
 		return m, m.nameInput.Focus()
+	case "v":
+		if m.current() == nil {
+			m.footerMsg = "No command to edit"
+			return m, nil
+		}
+		if m.inProject() {
+			return m, nil
+		}
+		cmd := m.editSelectedInEditor()
+		return m, cmd
 	case "d", "D":
-		if len(m.commands) == 0 {
+		if m.current() == nil {
 			m.footerMsg = "No command to delete"
 			return m, nil
 		}
+		if m.inProject() {
+			return m, nil
+		}
 		m.state = stateConfirmDelete
 		m.footerMsg = "Confirm delete? (y)es / (n)o"
 	case "r", "R":
-		if len(m.commands) == 0 {
+		if m.current() == nil {
 			m.footerMsg = "No command to run"
 			return m, nil
 		}
-		m.previousState = m.state
-		m.state = stateRunningCmd
-		return m, m.runSelectedCommand()
+		return m.guardRun(&pendingRun{action: runAsJob, command: m.commands[m.selected]})
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		n := int(msg.String()[0] - '0')
+		if n > m.pinned {
+			m.footerMsg = fmt.Sprintf("No pinned command %d - pin one with [f]", n)
+			return m, nil
+		}
+		return m.guardRun(&pendingRun{action: runAsJob, command: m.commands[n-1]})
+	case "f", "F":
+		if m.current() == nil {
+			m.footerMsg = "No command to pin"
+			return m, nil
+		}
+		if m.inProject() {
+			return m, nil
+		}
+		m.togglePin()
+	case "p":
+		if m.current() == nil {
+			m.footerMsg = "No command to preview"
+			return m, nil
+		}
+		m.showPreview(m.commands[m.selected])
+		m.footerMsg = "Preview - nothing was run"
+	case "w", "W":
+		if m.watch != nil {
+			name := m.watch.command.Name
+			m.stopWatch()
+			m.footerMsg = "Stopped watching " + name
+			return m, nil
+		}
+		if m.current() == nil {
+			m.footerMsg = "No command to watch"
+			return m, nil
+		}
+		return m.guardRun(&pendingRun{action: runWatched, command: m.commands[m.selected]})
+	case "J":
+		if len(m.jobs) == 0 {
+			m.footerMsg = "No jobs - press [r] to run a command in the background"
+			return m, nil
+		}
+		m.state = stateJobs
+		m.selectedJob = len(m.jobs) - 1
+		m.showJobOutput()
+		m.outputViewport.GotoBottom()
+		m.footerMsg = jobsFooter
+		cmd := m.tickJobs()
+		return m, cmd
+	case "u", "U":
+		op, err := m.store.Undo()
+		if err != nil {
+			m.footerMsg = "Undo failed: " + err.Error()
+			return m, nil
+		}
+		m.reloadCommands()
+		m.footerMsg = "Undid: " + op.Label
+	case "ctrl+r":
+		op, err := m.store.Redo()
+		if err != nil {
+			m.footerMsg = "Redo failed: " + err.Error()
+			return m, nil
+		}
+		m.reloadCommands()
+		m.footerMsg = "Redid: " + op.Label
+	case "h", "H":
+		if m.current() == nil {
+			m.footerMsg = "No command selected"
+			return m, nil
+		}
+		if m.inProject() {
+			return m, nil
+		}
+		m.state = stateVersions
+		m.selectedVersion = 0
+		m.reloadVersions()
+		m.footerMsg = versionsFooter
+	case "P":
+		m.reloadPlaybooks()
+		if len(m.playbooks) == 0 {
+			m.footerMsg = "No playbooks - create one with 'cmd-vault playbook add'"
+			return m, nil
+		}
+		m.state = stateSelectPlaybook
+	case "$":
+		profiles, err := m.store.GetEnvProfiles()
+		if err != nil {
+			m.footerMsg = "DB error: " + err.Error()
+			return m, nil
+		}
+		if len(profiles) == 0 {
+			m.footerMsg = "No environment profiles - create one with 'cmd-vault env set'"
+			return m, nil
+		}
+		m.profiles = profiles
+		m.selectedProfile = 0
+		for i, p := range profiles {
+			if m.profile != nil && p.ID == m.profile.ID {
+				m.selectedProfile = i + 1
+			}
+		}
+		m.state = stateSelectEnvProfile
+	case "V":
+		return m.openVaultPicker()
+	case "t", "T":
+		m.state = stateTrash
+		m.selectedTrash = 0
+		m.reloadTrash()
+		m.footerMsg = trashFooter
 	case "s", "S":
 		m.state = stateFileBrowser
 		m.selectedFile = 0
 		m.reloadFiles()
-		m.footerMsg = "File Browser - [Arrows] to navigate, [s] to exit, [r] to run"
+		m.footerMsg = fileBrowserFooter
 	case "?":
 		m.state = stateHelp
 	case "x", "X":
@@ -74,11 +213,13 @@ func (m model) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "o", "O":
 		m.previousState = m.state
 		m.state = stateOutputFocus
-		m.footerMsg = "Output Focus - [↑/↓] to scroll, [Esc] or [o] to exit"
+		m.footerMsg = outputFocusFooter
 	}
 	return m, nil
 }
 
+const fileBrowserFooter = "File Browser - [Arrows] to navigate, [s] to exit, [r] to run, [space] mark dir, [M] run in marked"
+
 func (m model) updateFileBrowser(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "up", "k":
@@ -125,6 +266,26 @@ func (m model) updateFileBrowser(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "c", "C":
 		clipboard.WriteAll(m.currentPath)
 		m.footerMsg = fmt.Sprintf("Path copied: %s", m.currentPath)
+	case " ", "m":
+		if len(m.files) > 0 && m.files[m.selectedFile].IsDir() {
+			dir := filepath.Join(m.currentPath, m.files[m.selectedFile].Name())
+			if m.markedDirs[dir] {
+				delete(m.markedDirs, dir)
+			} else {
+				m.markedDirs[dir] = true
+			}
+			m.footerMsg = fmt.Sprintf("%d director(ies) marked - [M] run a saved command in them", len(m.markedDirs))
+		}
+	case "M":
+		if len(m.markedDirs) == 0 {
+			m.footerMsg = "Mark directories with [space] first"
+			return m, nil
+		}
+		if len(m.commands) == 0 {
+			m.footerMsg = "No command to run"
+			return m, nil
+		}
+		m.state = stateSelectCmdForDirs
 
 	}
 	return m, nil
@@ -179,7 +340,7 @@ func (m model) updateRunInPath(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, m.runCustomCommand(commandStr)
 	case "esc", "alt+q":
 		m.state = stateFileBrowser
-		m.footerMsg = "File Browser - [Arrows] to navigate, [s] to exit, [r] to run"
+		m.footerMsg = fileBrowserFooter
 		m.runInput.Blur()
 		return m, nil
 	case "p", "P":
@@ -192,13 +353,27 @@ func (m model) updateRunInPath(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+const outputFocusFooter = "Output Focus - [↑/↓] to scroll, [c] copy, [Esc] or [o] to exit"
+
 func (m model) updateOutputFocus(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg.String() {
+	case "c":
+		// The output panel only ever holds redacted text.
+		if err := clipboard.WriteAll(m.rawCommandOutput); err != nil {
+			m.footerMsg = "Copy failed: " + err.Error()
+		} else {
+			m.footerMsg = "Output copied to clipboard"
+		}
+		return m, nil
 	case "esc", "o", "O", "q":
 		m.state = m.previousState
 		if m.state == stateFileBrowser {
-			m.footerMsg = "File Browser - [Arrows] to navigate, [s] to exit, [r] to run"
+			m.footerMsg = fileBrowserFooter
+		} else if m.state == stateDirResults {
+			m.footerMsg = dirResultsFooter
+		} else if m.state == stateJobs {
+			m.footerMsg = jobsFooter
 		} else {
 			m.footerMsg = ""
 		}
@@ -211,7 +386,7 @@ func (m model) updateContextHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	// Any key press exits context help
 	m.state = m.previousState
 	if m.state == stateFileBrowser {
-		m.footerMsg = "File Browser - [Arrows] to navigate, [s] to exit, [r] to run"
+		m.footerMsg = fileBrowserFooter
 	} else {
 		m.footerMsg = ""
 	}
@@ -243,112 +418,347 @@ func (m model) updateSelectCmdToPaste(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func (m model) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "enter":
-		name := strings.TrimSpace(m.nameInput.Value())
-		cmdStr := strings.TrimSpace(m.cmdInput.Value())
-		note := strings.TrimSpace(m.noteInput.Value())
-		if name == "" || note == "" {
-			m.footerMsg = "Name and Note required"
-			return m, nil
+// guardRun starts p right away, or first asks the user to type the name of
+// the command or playbook when it looks dangerous.
+func (m model) guardRun(p *pendingRun) (tea.Model, tea.Cmd) {
+	if p.action == runPlaybook {
+		p.name = p.playbook.Name
+		for _, st := range p.playbook.Steps {
+			c, err := m.store.GetByID(st.CommandID)
+			if err != nil || c == nil {
+				continue
+			}
+			for _, r := range m.checker.Check(c.CommandStr) {
+				p.reasons = append(p.reasons, c.Name+": "+r)
+			}
 		}
-		existing, err := m.store.GetByName(name)
+	} else {
+		p.name = p.command.Name
+		p.reasons = m.checker.Check(p.command.CommandStr)
+	}
+	if len(p.reasons) == 0 {
+		return m.startRun(p)
+	}
+	m.pending = p
+	m.state = stateConfirmDangerous
+	m.confirmInput.SetValue("")
+	m.confirmInput.Placeholder = p.name
+	m.footerMsg = "Dangerous command - type its name and press Enter to run, Esc to cancel"
+	return m, m.confirmInput.Focus()
+}
+
+// startRun performs a run that needs no further confirmation, asking for
+// the secrets passphrase first when the run uses secrets.
+func (m model) startRun(p *pendingRun) (tea.Model, tea.Cmd) {
+	if m.secrets == nil && m.usesSecrets(p) {
+		initialized, err := secrets.Initialized(m.store)
 		if err != nil {
 			m.footerMsg = "DB error: " + err.Error()
 			return m, nil
 		}
-		if existing != nil {
-			m.footerMsg = "Name already exists"
+		if !initialized {
+			m.state = p.back
+			m.footerMsg = "No secrets stored - add them with 'cmd-vault secret set'"
 			return m, nil
 		}
-		c := &models.Command{
-			Name:       name,
-			CommandStr: cmdStr,
-			Note:       note,
-			CreatedAt:  time.Now(),
-		}
-		if _, err := m.store.InsertCommand(c); err != nil {
-			m.footerMsg = "Failed to insert: " + err.Error()
-			return m, nil
-		}
-		m.reloadCommands()
+		m.pending = p
+		m.state = stateUnlockSecrets
+		m.passInput.SetValue("")
+		m.footerMsg = "Enter the secrets passphrase and press Enter, Esc to cancel"
+		return m, m.passInput.Focus()
+	}
+	var cmd tea.Cmd
+	switch p.action {
+	case runAsJob:
 		m.state = stateNormal
-		m.footerMsg = "Added."
-		m.nameInput.Blur()
-	case "esc":
+		cmd = m.startJob(p.command)
+	case runWatched:
 		m.state = stateNormal
-		m.footerMsg = "Cancelled add"
-		m.nameInput.Blur()
-	case "tab":
-		m.handleTab()
-	case "q":
-		m.previousState = m.state
-		m.state = stateConfirmCancel
-		m.footerMsg = "Discard changes? (y/n)"
-	case "up", "down":
-		m.handleVerticalNav(msg.String())
+		cmd = m.startWatch(p.command)
+	case runInDirs:
+		m.previousState = stateFileBrowser
+		m.state = stateRunningCmd
+		m.footerMsg = fmt.Sprintf("Running %s in %d directories...", p.command.Name, len(m.markedDirs))
+		cmd = m.runInMarkedDirs(p.command)
+	case runPlaybook:
+		m.previousState = stateNormal
+		m.state = stateRunningCmd
+		m.footerMsg = "Running playbook " + p.playbook.Name + "..."
+		cmd = m.startPlaybook(p.playbook)
 	}
-	var newCmd tea.Cmd
-	m, newCmd = m.updateInputs(msg)
-	return m, newCmd
+	return m, cmd
 }
 
-func (m model) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+// usesSecrets reports whether anything p runs refers to a secret.
+func (m model) usesSecrets(p *pendingRun) bool {
+	if p.action != runPlaybook {
+		return len(runner.SecretRefs(p.command.CommandStr)) > 0
+	}
+	for _, st := range p.playbook.Steps {
+		c, err := m.store.GetByID(st.CommandID)
+		if err == nil && c != nil && len(runner.SecretRefs(c.CommandStr)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m model) updateUnlockSecrets(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
-		if m.editCommand == nil {
-			m.footerMsg = "Nothing to edit"
-			m.state = stateNormal
+		v, err := secrets.Unlock(m.store, m.passInput.Value())
+		if err != nil {
+			m.passInput.SetValue("")
+			m.footerMsg = "Unlock failed: " + err.Error()
 			return m, nil
 		}
-		name := strings.TrimSpace(m.nameInput.Value())
-		cmdStr := strings.TrimSpace(m.cmdInput.Value())
-		note := strings.TrimSpace(m.noteInput.Value())
-		if name == "" || note == "" {
-			m.footerMsg = "Name and Note required"
-			return m, nil
+		m.secrets = v
+		if values, err := v.Values(); err == nil {
+			m.redactor.AddValues(values...)
 		}
-		if name != m.editCommand.Name {
-			existing, err := m.store.GetByName(name)
-			if err != nil {
-				m.footerMsg = "DB error: " + err.Error()
-				return m, nil
-			}
-			if existing != nil {
-				m.footerMsg = "Name already exists"
-				return m, nil
-			}
+		p := m.pending
+		m.pending = nil
+		m.passInput.Blur()
+		m.passInput.SetValue("")
+		return m.startRun(p)
+	case "esc":
+		m.state = m.pending.back
+		m.pending = nil
+		m.passInput.Blur()
+		m.passInput.SetValue("")
+		if m.state == stateFileBrowser {
+			m.footerMsg = fileBrowserFooter
+		} else {
+			m.footerMsg = "Run cancelled"
 		}
-		m.editCommand.Name = name
-		m.editCommand.CommandStr = cmdStr
-		m.editCommand.Note = note
-		if err := m.store.UpdateCommand(m.editCommand); err != nil {
-			m.footerMsg = "Update failed: " + err.Error()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.passInput, cmd = m.passInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateConfirmDangerous(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		p := m.pending
+		if strings.TrimSpace(m.confirmInput.Value()) != p.name {
+			p.mismatch = true
 			return m, nil
 		}
-		m.reloadCommands()
-		m.state = stateNormal
-		m.footerMsg = "Saved."
-		m.nameInput.Blur()
+		m.pending = nil
+		m.confirmInput.Blur()
+		return m.startRun(p)
 	case "esc":
-		m.state = stateNormal
-		m.footerMsg = "Cancelled edit"
-		m.nameInput.Blur()
+		m.state = m.pending.back
+		m.pending = nil
+		m.confirmInput.Blur()
+		if m.state == stateFileBrowser {
+			m.footerMsg = fileBrowserFooter
+		} else {
+			m.footerMsg = "Run cancelled"
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.confirmInput, cmd = m.confirmInput.Update(msg)
+	return m, cmd
+}
+
+// readForm trims the add/edit form values and validates them.
+func (m *model) readForm() (*models.Command, bool) {
+	c := &models.Command{
+		Name:        strings.TrimSpace(m.nameInput.Value()),
+		CommandStr:  strings.TrimSpace(m.cmdInput.Value()),
+		Note:        strings.TrimSpace(m.noteInput.Value()),
+		Interpreter: strings.ToLower(strings.TrimSpace(m.interpInput.Value())),
+		Tags:        models.ParseTags(m.tagsInput.Value()),
+	}
+	if c.Name == "" || c.Note == "" {
+		m.footerMsg = "Name and Note required"
+		return nil, false
+	}
+	env, err := models.ParseEnvLine(m.envInput.Value())
+	if err != nil {
+		m.footerMsg = err.Error()
+		return nil, false
+	}
+	c.Env = env
+	if err := document.Validate(c); err != nil {
+		m.footerMsg = err.Error()
+		return nil, false
+	}
+	return c, true
+}
+
+// updateForm handles the keys shared by the add and edit forms. Enter saves
+// except inside the command textarea, where it starts a new line; Ctrl+S
+// always saves and Ctrl+E opens the command body in $EDITOR.
+func (m model) updateForm(msg tea.KeyMsg, save func(model) (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+s":
+		return save(m)
+	case "enter":
+		if !m.cmdInput.Focused() {
+			return save(m)
+		}
+	case "ctrl+e":
+		m.footerMsg = "Opening editor..."
+		return m, m.openCmdInEditor()
+	case "esc":
+		return m.cancelForm(), nil
 	case "tab":
 		m.handleTab()
+		return m, nil
 	case "q":
 		m.previousState = m.state
 		m.state = stateConfirmCancel
 		m.footerMsg = "Discard changes? (y/n)"
 	case "up", "down":
-		m.handleVerticalNav(msg.String())
+		if m.handleVerticalNav(msg.String()) {
+			return m, nil
+		}
 	}
 	var newCmd tea.Cmd
 	m, newCmd = m.updateInputs(msg)
 	return m, newCmd
 }
 
+func (m model) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.updateForm(msg, model.saveAdd)
+}
+
+func (m model) saveAdd() (tea.Model, tea.Cmd) {
+	c, ok := m.readForm()
+	if !ok {
+		return m, nil
+	}
+	existing, err := m.store.GetByName(c.Name)
+	if err != nil {
+		m.footerMsg = "DB error: " + err.Error()
+		return m, nil
+	}
+	if existing != nil {
+		m.footerMsg = "Name already exists"
+		return m, nil
+	}
+	c.CreatedAt = time.Now()
+	if _, err := m.store.InsertCommand(c); err != nil {
+		m.footerMsg = "Failed to insert: " + err.Error()
+		return m, nil
+	}
+	m.reloadCommands()
+	m.state = stateNormal
+	m.footerMsg = "Added."
+	m.blurInputs()
+	return m, nil
+}
+
+func (m model) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.updateForm(msg, model.saveEdit)
+}
+
+func (m model) saveEdit() (tea.Model, tea.Cmd) {
+	if m.editCommand == nil {
+		m.footerMsg = "Nothing to edit"
+		m.state = stateNormal
+		return m, nil
+	}
+	edited, ok := m.readForm()
+	if !ok {
+		return m, nil
+	}
+	if !m.applyEdit(edited) {
+		return m, nil
+	}
+	m.state = stateNormal
+	m.footerMsg = "Saved."
+	m.blurInputs()
+	return m, nil
+}
+
+// applyEdit copies the editable fields of edited onto m.editCommand and saves
+// it, reporting problems in the footer.
+func (m *model) applyEdit(edited *models.Command) bool {
+	if edited.Name != m.editCommand.Name {
+		existing, err := m.store.GetByName(edited.Name)
+		if err != nil {
+			m.footerMsg = "DB error: " + err.Error()
+			return false
+		}
+		if existing != nil {
+			m.footerMsg = "Name already exists"
+			return false
+		}
+	}
+	m.editCommand.Name = edited.Name
+	m.editCommand.CommandStr = edited.CommandStr
+	m.editCommand.Note = edited.Note
+	m.editCommand.Interpreter = edited.Interpreter
+	m.editCommand.Tags = edited.Tags
+	m.editCommand.Env = edited.Env
+	if err := m.store.UpdateCommand(m.editCommand); err != nil {
+		m.footerMsg = "Update failed: " + err.Error()
+		return false
+	}
+	m.reloadCommands()
+	return true
+}
+
+// handleDocEdited parses the document returned by $EDITOR and saves it, or
+// offers to re-open it when it doesn't parse.
+func (m model) handleDocEdited(msg docEditedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.discardDoc()
+		m.footerMsg = "Editor error: " + msg.err.Error()
+		return m, nil
+	}
+	data, err := os.ReadFile(m.docPath)
+	if err != nil {
+		m.discardDoc()
+		m.footerMsg = "Editor error: " + err.Error()
+		return m, nil
+	}
+	edited, err := document.Decode(string(data))
+	if err == nil && !m.applyEdit(edited) {
+		err = errors.New(m.footerMsg)
+	}
+	if err != nil {
+		m.state = stateConfirmReEdit
+		m.footerMsg = "Invalid document: " + err.Error() + " - re-edit? (y/n)"
+		return m, nil
+	}
+	m.discardDoc()
+	m.state = stateNormal
+	m.footerMsg = "Saved."
+	return m, nil
+}
+
+func (m model) updateConfirmReEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y", "enter":
+		m.state = stateNormal
+		return m, m.reopenDocEditor()
+	case "n", "N", "esc", "q":
+		m.discardDoc()
+		m.state = stateNormal
+		m.footerMsg = "Edit discarded"
+	}
+	return m, nil
+}
+
+// cancelForm leaves the add/edit form without saving.
+func (m model) cancelForm() model {
+	if m.state == stateEdit {
+		m.footerMsg = "Cancelled edit"
+	} else {
+		m.footerMsg = "Cancelled add"
+	}
+	m.state = stateNormal
+	m.blurInputs()
+	return m
+}
+
 func (m model) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "y", "Y":
@@ -371,14 +781,336 @@ func (m model) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+const versionsFooter = "History - [r] Roll back to version  [Esc/h] Back"
+
+func (m model) updateVersions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedVersion > 0 {
+			m.selectedVersion--
+		}
+	case "down", "j":
+		if m.selectedVersion < len(m.versions)-1 {
+			m.selectedVersion++
+		}
+	case "r", "R", "enter":
+		if len(m.versions) == 0 {
+			return m, nil
+		}
+		v := m.versions[m.selectedVersion]
+		if m.selectedVersion == 0 {
+			m.footerMsg = "Already at the latest version"
+			return m, nil
+		}
+		if err := m.store.RollbackCommand(m.commands[m.selected].ID, v.ID); err != nil {
+			m.footerMsg = "Rollback failed: " + err.Error()
+			return m, nil
+		}
+		m.reloadCommands()
+		m.selectedVersion = 0
+		m.reloadVersions()
+		m.footerMsg = fmt.Sprintf("Rolled back to version %d", v.Number)
+	case "esc", "h", "H":
+		m.state = stateNormal
+		m.footerMsg = ""
+	}
+	return m, nil
+}
+
+func (m model) updateSelectPlaybook(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedPlaybook > 0 {
+			m.selectedPlaybook--
+		}
+	case "down", "j":
+		if m.selectedPlaybook < len(m.playbooks)-1 {
+			m.selectedPlaybook++
+		}
+	case "enter":
+		return m.guardRun(&pendingRun{action: runPlaybook, playbook: m.playbooks[m.selectedPlaybook]})
+	case "esc", "P":
+		m.state = stateNormal
+	}
+	return m, nil
+}
+
+// updateSelectEnvProfile picks the environment profile applied to every run.
+// The first entry of the picker stands for no profile.
+func (m model) updateSelectEnvProfile(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedProfile > 0 {
+			m.selectedProfile--
+		}
+	case "down", "j":
+		if m.selectedProfile < len(m.profiles) {
+			m.selectedProfile++
+		}
+	case "enter":
+		m.state = stateNormal
+		if m.selectedProfile == 0 {
+			m.profile = nil
+			m.footerMsg = "No environment profile"
+			return m, nil
+		}
+		p := m.profiles[m.selectedProfile-1]
+		m.profile = &p
+		m.footerMsg = "Using environment profile " + p.Name
+	case "esc", "$":
+		m.state = stateNormal
+	}
+	return m, nil
+}
+
+// handlePlaybookStep reports a finished step in the output panel and starts
+// the next one, stopping at the first failure unless the step allows errors.
+func (m model) handlePlaybookStep(msg playbookStepMsg) (tea.Model, tea.Cmd) {
+	run := m.playbookRun
+	if run == nil {
+		return m, nil
+	}
+	st := run.steps[msg.index]
+	total := len(run.steps)
+	status := "ok"
+	if msg.err != nil {
+		status = "FAILED: " + msg.err.Error()
+		run.failed++
+	} else {
+		_ = m.store.IncrementUsage(run.playbook.Steps[msg.index].CommandID)
+	}
+	out := m.rawCommandOutput + fmt.Sprintf("\n[%d/%d] %s - %s (%s)\n", msg.index+1, total, st.Name, status, msg.elapsed.Round(time.Millisecond))
+	out += string(msg.output)
+	stop := msg.err != nil && !st.ContinueOnError
+	if stop || msg.index+1 == total {
+		switch {
+		case stop:
+			out += fmt.Sprintf("\nPlaybook stopped at step %d.", msg.index+1)
+		case run.failed > 0:
+			out += fmt.Sprintf("\nPlaybook finished with %d failed step(s).", run.failed)
+		default:
+			out += "\nPlaybook finished."
+		}
+		m.setOutput(out)
+		m.outputViewport.GotoBottom()
+		m.playbookRun = nil
+		m.state = stateNormal
+		m.footerMsg = ""
+		m.reloadCommands()
+		return m, nil
+	}
+	m.setOutput(out)
+	m.outputViewport.GotoBottom()
+	m.footerMsg = fmt.Sprintf("Running playbook %s - step %d/%d", run.playbook.Name, msg.index+2, total)
+	return m, m.runPlaybookStep(msg.index + 1)
+}
+
+func (m model) updateSelectCmdForDirs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case "down", "j":
+		if m.selected < len(m.commands)-1 {
+			m.selected++
+		}
+	case "enter":
+		return m.guardRun(&pendingRun{action: runInDirs, command: m.commands[m.selected], back: stateFileBrowser})
+	case "esc":
+		m.state = stateFileBrowser
+		m.footerMsg = fileBrowserFooter
+	}
+	return m, nil
+}
+
+const dirResultsFooter = "Results - [↑/↓] Select directory  [o] Scroll output  [Esc] Back to files"
+
+func (m model) updateDirResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedResult > 0 {
+			m.selectedResult--
+			m.showDirResult()
+		}
+	case "down", "j":
+		if m.selectedResult < len(m.dirResults)-1 {
+			m.selectedResult++
+			m.showDirResult()
+		}
+	case "o", "O":
+		m.previousState = m.state
+		m.state = stateOutputFocus
+		m.footerMsg = outputFocusFooter
+	case "esc":
+		m.state = stateFileBrowser
+		m.footerMsg = fileBrowserFooter
+	}
+	return m, nil
+}
+
+const jobsFooter = "Jobs - [↑/↓] Select  [c] Cancel  [D] Clear finished  [o] Scroll output  [Esc/J] Back"
+
+func (m model) updateJobs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedJob > 0 {
+			m.selectedJob--
+			m.showJobOutput()
+			m.outputViewport.GotoBottom()
+		}
+	case "down", "j":
+		if m.selectedJob < len(m.jobs)-1 {
+			m.selectedJob++
+			m.showJobOutput()
+			m.outputViewport.GotoBottom()
+		}
+	case "c", "C":
+		if len(m.jobs) == 0 {
+			return m, nil
+		}
+		j := m.jobs[m.selectedJob]
+		if j.Status() != runner.JobRunning {
+			m.footerMsg = fmt.Sprintf("Job #%d is not running", j.ID)
+			return m, nil
+		}
+		if err := j.Cancel(); err != nil {
+			m.footerMsg = "Cancel failed: " + err.Error()
+			return m, nil
+		}
+		m.footerMsg = fmt.Sprintf("Cancelling job #%d...", j.ID)
+	case "D":
+		m.clearFinishedJobs()
+		m.showJobOutput()
+		m.footerMsg = jobsFooter
+	case "o", "O":
+		m.previousState = m.state
+		m.state = stateOutputFocus
+		m.footerMsg = outputFocusFooter
+	case "esc", "J":
+		m.state = stateNormal
+		m.footerMsg = ""
+	}
+	return m, nil
+}
+
+// handleJobFinished reports a finished background job in the footer.
+func (m model) handleJobFinished(msg jobFinishedMsg) (tea.Model, tea.Cmd) {
+	j := msg.job
+	status := j.Status()
+	if m.state == stateJobs || (m.state == stateOutputFocus && m.previousState == stateJobs) {
+		m.showJobOutput()
+		return m, nil
+	}
+	if m.state == stateNormal && len(m.jobs) > 0 && m.jobs[len(m.jobs)-1] == j {
+		// The last job started is what the output panel is showing.
+		out := string(j.Output())
+		if err := j.Err(); err != nil {
+			out += "\n\nError: " + err.Error()
+		}
+		m.setOutput(out)
+		m.outputViewport.GotoTop()
+	}
+	m.footerMsg = fmt.Sprintf("Job #%d %s %s (%s)", j.ID, j.Name, status, j.Elapsed().Round(time.Millisecond))
+	return m, nil
+}
+
+// handleWatchChange re-runs the watched command after files changed.
+func (m model) handleWatchChange(msg watchChangeMsg) (tea.Model, tea.Cmd) {
+	if m.watch == nil || msg.session != m.watch {
+		return m, nil
+	}
+	cmd := m.runWatchIteration(msg.files)
+	return m, tea.Batch(cmd, waitWatchChange(m.watch))
+}
+
+// handleWatchRunDone records the status of a finished watch iteration.
+func (m model) handleWatchRunDone(msg watchRunDoneMsg) (tea.Model, tea.Cmd) {
+	ws := m.watch
+	if ws == nil || msg.session != ws || msg.job != ws.job {
+		// A canceled iteration or one of a session that was stopped.
+		return m, nil
+	}
+	j := msg.job
+	status := fmt.Sprintf("[%d] ok (%s)", j.ID, j.Elapsed().Round(time.Millisecond))
+	if err := j.Err(); err != nil {
+		status = fmt.Sprintf("[%d] FAILED (%s): %v", j.ID, j.Elapsed().Round(time.Millisecond), err)
+	}
+	ws.finishEntry(j, status)
+	m.showWatchLog()
+	m.reloadCommands()
+	return m, nil
+}
+
+const trashFooter = "Trash - [r] Restore  [d] Delete forever  [Esc/t] Back"
+
+func (m model) updateTrash(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedTrash > 0 {
+			m.selectedTrash--
+		}
+	case "down", "j":
+		if m.selectedTrash < len(m.trash)-1 {
+			m.selectedTrash++
+		}
+	case "r", "R", "enter":
+		if len(m.trash) == 0 {
+			m.footerMsg = "Trash is empty"
+			return m, nil
+		}
+		c := m.trash[m.selectedTrash]
+		name, err := m.store.RestoreCommand(c.ID, "")
+		if err != nil {
+			m.footerMsg = "Restore failed: " + err.Error()
+			return m, nil
+		}
+		m.reloadTrash()
+		m.reloadCommands()
+		if name != c.Name {
+			m.footerMsg = fmt.Sprintf("Restored as %s (name %s is taken)", name, c.Name)
+		} else {
+			m.footerMsg = "Restored " + name
+		}
+	case "d", "D":
+		if len(m.trash) == 0 {
+			m.footerMsg = "Trash is empty"
+			return m, nil
+		}
+		m.state = stateConfirmPurge
+		m.footerMsg = "Delete forever? (y)es / (n)o"
+	case "esc", "t", "T":
+		m.state = stateNormal
+		m.footerMsg = ""
+	}
+	return m, nil
+}
+
+func (m model) updateConfirmPurge(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		if len(m.trash) > 0 {
+			if err := m.store.PurgeCommand(m.trash[m.selectedTrash].ID); err != nil {
+				m.footerMsg = "Delete failed: " + err.Error()
+			} else {
+				m.footerMsg = "Deleted forever."
+			}
+			m.reloadTrash()
+		}
+		m.state = stateTrash
+	case "n", "N", "esc", "q":
+		m.state = stateTrash
+		m.footerMsg = trashFooter
+	}
+	return m, nil
+}
+
 func (m model) updateConfirmCancel(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "y", "Y", "enter":
 		m.state = stateNormal
 		m.footerMsg = "Cancelled"
-		m.nameInput.Blur()
-		m.cmdInput.Blur()
-		m.noteInput.Blur()
+		m.blurInputs()
 	case "n", "N", "esc", "q":
 		m.state = m.previousState
 		m.footerMsg = "Continuing..."
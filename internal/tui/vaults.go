@@ -0,0 +1,158 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/kanekitakitos/cmd-vault/internal/storage"
+)
+
+// ErrLocked is returned by Vaults.Open for an encrypted vault when no
+// passphrase was given and its key isn't cached.
+var ErrLocked = errors.New("the vault is locked")
+
+// Vaults lets the TUI switch between the named vaults of the config.
+type Vaults struct {
+	// Current is the name of the open vault, "" when it isn't registered.
+	Current string
+	// Open opens the vault at location, unlocking it with passphrase when
+	// it is encrypted.
+	Open func(location, passphrase string) (storage.Store, error)
+}
+
+// openVaultPicker lists the named vaults, starting at the current one.
+func (m model) openVaultPicker() (tea.Model, tea.Cmd) {
+	names := m.cfg.VaultNames()
+	if len(names) == 0 || m.vaults.Open == nil {
+		m.footerMsg = `No named vaults - add them under "vaults" in the config file`
+		return m, nil
+	}
+	m.vaultNames = names
+	m.selectedVault = 0
+	for i, name := range names {
+		if name == m.vaults.Current {
+			m.selectedVault = i
+		}
+	}
+	m.state = stateSelectVault
+	return m, nil
+}
+
+func (m model) updateSelectVault(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		if m.selectedVault > 0 {
+			m.selectedVault--
+		}
+	case "down", "j":
+		if m.selectedVault < len(m.vaultNames)-1 {
+			m.selectedVault++
+		}
+	case "enter":
+		name := m.vaultNames[m.selectedVault]
+		m.state = stateNormal
+		if name == m.vaults.Current {
+			m.footerMsg = "Already using vault " + name
+			return m, nil
+		}
+		err := m.switchVault(name, "")
+		if errors.Is(err, ErrLocked) {
+			m.switchingTo = name
+			m.state = stateUnlockVault
+			m.passInput.SetValue("")
+			m.footerMsg = "Enter the passphrase of vault " + name + " and press Enter, Esc to cancel"
+			return m, m.passInput.Focus()
+		}
+		if err != nil {
+			m.footerMsg = "Can't open vault " + name + ": " + err.Error()
+		}
+	case "esc", "V":
+		m.state = stateNormal
+	}
+	return m, nil
+}
+
+func (m model) updateUnlockVault(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if err := m.switchVault(m.switchingTo, m.passInput.Value()); err != nil {
+			m.passInput.SetValue("")
+			m.footerMsg = "Unlock failed: " + err.Error()
+			return m, nil
+		}
+		m.state = stateNormal
+		m.switchingTo = ""
+		m.passInput.Blur()
+		m.passInput.SetValue("")
+		return m, nil
+	case "esc":
+		m.state = stateNormal
+		m.switchingTo = ""
+		m.passInput.Blur()
+		m.passInput.SetValue("")
+		m.footerMsg = "Vault switch cancelled"
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.passInput, cmd = m.passInput.Update(msg)
+	return m, cmd
+}
+
+// switchVault opens the vault called name in place of the current one.
+// Unlocked secrets and the environment profile belong to the old vault and
+// are dropped; background jobs keep running.
+func (m *model) switchVault(name, passphrase string) error {
+	store, err := m.vaults.Open(m.cfg.Vaults[name], passphrase)
+	if err != nil {
+		return err
+	}
+	m.stopWatch()
+	closeErr := m.store.Close()
+	m.store = store
+	m.vaults.Current = name
+	m.secrets = nil
+	m.profile = nil
+	m.playbooks = nil
+	m.reloadCommands()
+	m.selectFirst()
+	m.footerMsg = "Switched to vault " + name
+	if closeErr != nil {
+		m.footerMsg += " (closing the previous one failed: " + closeErr.Error() + ")"
+	}
+	return nil
+}
+
+func renderVaultPicker(names []string, selected int, vaults map[string]string, current string) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Vaults") + "\n\n")
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	for i, name := range names {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		line := prefix + name + strings.Repeat(" ", width-len(name)) + "  " + vaults[name]
+		if name == current {
+			line += " *"
+		}
+		b.WriteString(style.Render(line) + "\n")
+	}
+	b.WriteString("\nUse ↑/↓ to navigate, Enter to switch, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
+func renderUnlockVault(name, input string) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Unlock Vault") + "\n\n")
+	b.WriteString(name + " is encrypted. Passphrase:\n")
+	b.WriteString(input + "\n")
+	b.WriteString("\nEnter to unlock, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
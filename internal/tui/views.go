@@ -3,10 +3,16 @@ package tui
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/kanekitakitos/cmd-vault/internal/document"
 	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/runner"
+	"github.com/kanekitakitos/cmd-vault/internal/safety"
 )
 
 func (m model) renderView() string {
@@ -38,16 +44,27 @@ func (m model) viewVertical() string {
 	// Subtract a margin to prevent panels from touching the window edges
 	panelWidth := m.width - 2
 
-	listContent := renderList(m.commands, m.selected, panelWidth-4)
+	listContent := m.renderListPanel(panelWidth - 4)
 	listPanelRendered := panelStyle.Copy().Width(panelWidth).Render(listContent)
 	listHeight := lipgloss.Height(listPanelRendered)
 
 	detailsContent := "No commands"
-	if len(m.commands) > 0 {
-		detailsContent = renderDetails(&m.commands[m.selected]) + "\n" + renderNote(&m.commands[m.selected], panelWidth-2)
+	if c := m.detailsCommand(); c != nil {
+		detailsContent = renderDetails(c) + "\n" + renderNote(c, panelWidth-2)
+	} else if f := m.detailsFolder(); f != "" {
+		detailsContent = renderFolder(f, folderCommands(m.commands, m.pinned, f))
 	} else if m.state == stateContextHelp {
 		detailsContent = renderHelpContent()
 	}
+	if m.state == stateVersions {
+		detailsContent = renderVersionDiff(m.versions, m.selectedVersion)
+	}
+	if m.showingDirResults() && len(m.dirResults) > 0 {
+		detailsContent = renderDirResultDetails(m.dirResults[m.selectedResult])
+	}
+	if m.showingJobs() && len(m.jobs) > 0 {
+		detailsContent = renderJobDetails(m.jobs[m.selectedJob])
+	}
 	detailsPanelRendered := panelStyle.Copy().Width(panelWidth).Render(detailsContent)
 	detailsHeight := lipgloss.Height(detailsPanelRendered)
 
@@ -70,19 +87,29 @@ func (m model) viewNormalHorizontal() string {
 	leftPanelWidth := int(float32(availableWidth) * 0.35)
 	rightPanelWidth := availableWidth - leftPanelWidth
 
-	leftContent := renderList(m.commands, m.selected, leftPanelWidth-2)
+	leftContent := m.renderListPanel(leftPanelWidth - 2)
 	leftPanel := panelStyle.Copy().
 		Width(leftPanelWidth).
 		Height(mainPanelHeight).
 		Render(leftContent)
 
 	detailsContent := "No commands available."
-	if len(m.commands) > 0 {
-		c := &m.commands[m.selected]
+	if c := m.detailsCommand(); c != nil {
 		detailsContent = lipgloss.JoinVertical(lipgloss.Left, renderDetails(c), renderNote(c, rightPanelWidth-2))
+	} else if f := m.detailsFolder(); f != "" {
+		detailsContent = renderFolder(f, folderCommands(m.commands, m.pinned, f))
 	} else if m.state == stateContextHelp {
 		detailsContent = renderHelpContent()
 	}
+	if m.state == stateVersions {
+		detailsContent = renderVersionDiff(m.versions, m.selectedVersion)
+	}
+	if m.showingDirResults() && len(m.dirResults) > 0 {
+		detailsContent = renderDirResultDetails(m.dirResults[m.selectedResult])
+	}
+	if m.showingJobs() && len(m.jobs) > 0 {
+		detailsContent = renderJobDetails(m.jobs[m.selectedJob])
+	}
 
 	detailsPanelRendered := panelStyle.Copy().Width(rightPanelWidth).Render(detailsContent)
 	detailsHeight := lipgloss.Height(detailsPanelRendered)
@@ -107,7 +134,7 @@ func (m model) viewFileBrowser() string {
 	leftPanelWidth := int(float32(m.width) * 0.35)
 	rightPanelWidth := m.width - 4 - leftPanelWidth
 
-	leftContent := renderFileBrowser(m.files, m.selectedFile, m.currentPath, leftPanelWidth-2)
+	leftContent := renderFileBrowser(m.files, m.selectedFile, m.currentPath, m.markedDirs, leftPanelWidth-2)
 	leftPanel := panelStyle.Copy().
 		Width(leftPanelWidth).
 		Height(mainPanelHeight).
@@ -164,16 +191,40 @@ func (m model) viewOverlay() string {
 		}
 		form := lipgloss.JoinVertical(lipgloss.Left,
 			titleStyle.Render(title),
-			"Name: "+m.nameInput.View(),
-			"Cmd:  "+m.cmdInput.View(),
-			"Note: "+m.noteInput.View(),
-			"\nPress Enter to save, Esc to cancel",
+			"Name:  "+m.nameInput.View(),
+			"Cmd:",
+			m.cmdInput.View(),
+			"Note:  "+m.noteInput.View(),
+			"Shell: "+m.interpInput.View(),
+			"Tags:  "+m.tagsInput.View(),
+			"Env:   "+m.envInput.View(),
+			"\nCtrl+S to save, Ctrl+E to open Cmd in $EDITOR, Esc to cancel",
 		)
 		return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(form))
+	case stateConfirmDangerous:
+		return renderConfirmDangerous(m.pending, m.confirmInput.View())
+	case stateUnlockSecrets:
+		return renderUnlockSecrets(m.pending.name, m.passInput.View())
+	case stateSelectVault:
+		return renderVaultPicker(m.vaultNames, m.selectedVault, m.cfg.Vaults, m.vaults.Current)
+	case stateUnlockVault:
+		return renderUnlockVault(m.switchingTo, m.passInput.View())
+	case stateMoveCommand:
+		return renderMoveCommand(m.commands[m.selected].Name, m.folderInput.View())
 	case stateConfirmDelete:
 		return borderStyle.Render(lipgloss.NewStyle().Padding(1).SetString("Confirm delete? (y/n)").String())
+	case stateSelectCmdForDirs:
+		return renderCommandPicker(fmt.Sprintf("Run in %d Marked Directories", len(m.markedDirs)), m.commands, m.selected)
+	case stateSelectPlaybook:
+		return renderPlaybookPicker(m.playbooks, m.selectedPlaybook)
+	case stateSelectEnvProfile:
+		return renderProfilePicker(m.profiles, m.selectedProfile, m.profile)
+	case stateConfirmPurge:
+		return borderStyle.Render(lipgloss.NewStyle().Padding(1).SetString("Delete forever? (y/n)").String())
 	case stateConfirmCancel:
 		return borderStyle.Render(lipgloss.NewStyle().Padding(1).SetString("Discard changes? (y/n)").String())
+	case stateConfirmReEdit:
+		return borderStyle.Render(lipgloss.NewStyle().Padding(1).Width(60).SetString(m.footerMsg).String())
 	case stateRunningCmd:
 		return "" // No longer an overlay, handled inline
 	}
@@ -181,17 +232,74 @@ func (m model) viewOverlay() string {
 }
 
 func (m *model) getFooterContent() string {
+	env := ""
+	if m.vaults.Current != "" {
+		env = "[Vault: " + m.vaults.Current + "]  "
+	}
+	if m.profile != nil {
+		env += "[Env: " + m.profile.Name + "]  "
+	}
 	if m.state == stateFileBrowser {
-		return "[S] Exit Files  [X] Help  [Q] Quit  " + m.footerMsg
+		return env + "[S] Exit Files  [X] Help  [Q] Quit  " + m.footerMsg
+	}
+	return env + "[R] Run  [S] Files  [X] Help  [Q] Quit  " + m.footerMsg
+}
+
+// renderListPanel renders the left-hand list: the trash while it is open,
+// the saved commands otherwise.
+func (m model) renderListPanel(width int) string {
+	if m.state == stateTrash || m.state == stateConfirmPurge {
+		return renderTrashList(m.trash, m.selectedTrash, width)
+	}
+	if m.state == stateVersions {
+		return renderVersionList(m.versions, m.selectedVersion)
+	}
+	if m.showingDirResults() {
+		return renderDirResults(m.dirRunName, m.dirResults, m.selectedResult, width)
+	}
+	if m.showingJobs() {
+		return renderJobList(m.jobs, m.selectedJob, width)
+	}
+	rows := m.listRows()
+	return renderList(m.commands, rows, m.selectedRow(rows), m.pinned, m.collapsed, m.checker, width)
+}
+
+// showingDirResults reports whether the per-directory results of a run are on screen.
+func (m model) showingDirResults() bool {
+	return m.state == stateDirResults || (m.state == stateOutputFocus && m.previousState == stateDirResults)
+}
+
+// showingJobs reports whether the jobs panel is on screen.
+func (m model) showingJobs() bool {
+	return m.state == stateJobs || (m.state == stateOutputFocus && m.previousState == stateJobs)
+}
+
+// detailsCommand returns the command shown in the details panel, if any.
+func (m model) detailsCommand() *models.Command {
+	if m.state == stateTrash || m.state == stateConfirmPurge {
+		if len(m.trash) == 0 {
+			return nil
+		}
+		return &m.trash[m.selectedTrash]
+	}
+	return m.current()
+}
+
+// detailsFolder returns the folder shown in the details panel, if any.
+func (m model) detailsFolder() string {
+	if m.state == stateTrash || m.state == stateConfirmPurge {
+		return ""
 	}
-	return "[R] Run  [S] Files  [X] Help  [Q] Quit  " + m.footerMsg
+	return m.folder
 }
 
-func renderList(commands []models.Command, selected int, width int) string {
+func renderTrashList(commands []models.Command, selected int, width int) string {
 	var b strings.Builder
-	title := titleStyle.Render("Commands")
-	b.WriteString(title)
+	b.WriteString(titleStyle.Render("Trash"))
 	b.WriteString("\n")
+	if len(commands) == 0 {
+		b.WriteString("  (empty)\n")
+	}
 	for i, c := range commands {
 		style := lipgloss.NewStyle()
 		prefix := "  "
@@ -200,13 +308,121 @@ func renderList(commands []models.Command, selected int, width int) string {
 			prefix = "→ "
 		}
 		name := c.Name
+		when := c.DeletedAt.Local().Format("01-02 15:04")
+		name = truncate(name, width-lipgloss.Width(prefix)-len(when)-1)
+		b.WriteString(style.Render(fmt.Sprintf("%s%s %s", prefix, name, when)))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func renderVersionList(versions []models.Version, selected int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("History"))
+	b.WriteString("\n")
+	for i, v := range versions {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		line := fmt.Sprintf("%sv%d %s", prefix, v.Number, v.CreatedAt.Local().Format("2006-01-02 15:04"))
+		if i == 0 {
+			line += " (current)"
+		}
+		b.WriteString(style.Render(line))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderVersionDiff shows what the selected version changed compared to the one before it.
+func renderVersionDiff(versions []models.Version, selected int) string {
+	if len(versions) == 0 {
+		return "No history recorded."
+	}
+	v := versions[selected]
+	var previous *models.Command
+	if selected+1 < len(versions) {
+		previous = &versions[selected+1].Command
+	}
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Changes in v%d", v.Number)) + "\n")
+	for _, line := range strings.Split(strings.TrimSuffix(document.Diff(previous, &v.Command), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			line = diffAddStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = diffDelStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// renderList shows the first pinned commands in their own section, numbered
+// for the 1-9 keys, above the tree of the others.
+func renderList(commands []models.Command, rows []listRow, selected, pinned int, collapsed map[string]bool, checker *safety.Checker, width int) string {
+	var b strings.Builder
+	if pinned > 0 {
+		b.WriteString(titleStyle.Render("Pinned"))
+	} else {
+		b.WriteString(titleStyle.Render("Commands"))
+	}
+	b.WriteString("\n")
+	for i, r := range rows {
+		if i == pinned && pinned > 0 {
+			b.WriteString("\n" + titleStyle.Render("Commands") + "\n")
+		}
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		prefix += strings.Repeat("  ", r.depth)
+		if r.folder != "" {
+			marker := "▾ "
+			if collapsed[r.folder] {
+				marker = "▸ "
+			}
+			count := fmt.Sprintf(" (%d)", len(folderCommands(commands, pinned, r.folder)))
+			b.WriteString(style.Render(prefix + marker + models.BaseName(r.folder) + "/"))
+			b.WriteString(lineNumberStyle.Render(count))
+			b.WriteString("\n")
+			continue
+		}
+		c := commands[r.command]
+		name := models.BaseName(c.Name)
+		if r.command < pinned {
+			name = c.Name
+			if r.command < 9 {
+				prefix += fmt.Sprintf("[%d] ", r.command+1)
+			} else {
+				prefix += "    "
+			}
+		}
 		usage := fmt.Sprintf("(%d)", c.UsageCount)
-		availableWidth := width - len(prefix) - len(usage) - 1
-		if len(name) > availableWidth {
-			name = name[:availableWidth-3] + "..."
+		// Project commands are marked with their project, risky ones get a
+		// badge after the usage count.
+		source := ""
+		if c.Project != "" {
+			source = " [" + filepath.Base(c.Project) + "]"
+		}
+		badge := ""
+		if checker.Dangerous(c.CommandStr) {
+			badge = " !"
 		}
+		name = truncate(name, width-lipgloss.Width(prefix)-len(usage)-lipgloss.Width(source)-len(badge)-1)
 		line := fmt.Sprintf("%s%s %s", prefix, name, usage)
 		b.WriteString(style.Render(line))
+		if source != "" {
+			b.WriteString(lineNumberStyle.Render(source))
+		}
+		if badge != "" {
+			b.WriteString(warningStyle.Render(badge))
+		}
 		b.WriteString("\n")
 	}
 	return b.String()
@@ -216,7 +432,39 @@ func renderDetails(c *models.Command) string {
 	if c == nil {
 		return "No command selected"
 	}
-	return fmt.Sprintf("%s\n%s", titleStyle.Render(c.Name), c.CommandStr)
+	interp := c.Interpreter
+	if interp == "" {
+		interp = runner.DefaultInterpreter() + " (default)"
+	}
+	meta := "shell: " + interp
+	if len(c.Aliases) > 0 {
+		meta += "  aliases: " + strings.Join(c.Aliases, ", ")
+	}
+	if len(c.Tags) > 0 {
+		meta += "  tags: " + strings.Join(c.Tags, ", ")
+	}
+	if len(c.Env) > 0 {
+		meta += "  env: " + strings.Join(c.Env, " ")
+	}
+	if c.Project != "" {
+		meta += "  project: " + c.Project
+	}
+	return fmt.Sprintf("%s\n%s\n%s", titleStyle.Render(c.Name), lineNumberStyle.Render(meta), numberLines(c.CommandStr))
+}
+
+// numberLines prefixes each line of a command body with its line number.
+func numberLines(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	width := len(fmt.Sprint(len(lines)))
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(lineNumberStyle.Render(fmt.Sprintf("%*d ", width, i+1)))
+		b.WriteString(line)
+	}
+	return b.String()
 }
 
 func renderNote(c *models.Command, width int) string {
@@ -226,7 +474,7 @@ func renderNote(c *models.Command, width int) string {
 	return lipgloss.NewStyle().Width(width).Render(c.Note)
 }
 
-func renderFileBrowser(files []os.DirEntry, selected int, path string, width int) string {
+func renderFileBrowser(files []os.DirEntry, selected int, path string, marked map[string]bool, width int) string {
 	var b strings.Builder
 	b.WriteString(titleStyle.Render("Explorer: "+path) + "\n")
 	dirStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("99"))
@@ -239,7 +487,11 @@ func renderFileBrowser(files []os.DirEntry, selected int, path string, width int
 		}
 		name := f.Name()
 		if f.IsDir() {
-			name = dirStyle.Render(name + "/")
+			mark := ""
+			if marked[filepath.Join(path, name)] {
+				mark = "[x] "
+			}
+			name = dirStyle.Render(mark + name + "/")
 		} else {
 			name = style.Render(name)
 		}
@@ -277,11 +529,28 @@ type helpBinding struct {
 
 var helpBindings = []helpBinding{
 	{Key: "↑/k, ↓/j", Description: "Navigate lists"},
-	{Key: "r", Description: "Run command (or enter mini-terminal)"},
+	{Key: "r", Description: "Run command in the background (or enter mini-terminal)"},
+	{Key: "p", Description: "Preview exactly what the command would run"},
+	{Key: "J", Description: "Show background jobs (cancel, view output)"},
+	{Key: "w", Description: "Watch: re-run command when files change (w again stops)"},
 	{Key: "s", Description: "Open/close file browser"},
-	{Key: "o", Description: "Focus/scroll output panel"},
+	{Key: "o", Description: "Focus/scroll output panel (c copies it)"},
 	{Key: "a, e, d", Description: "Add, Edit, Delete command"},
+	{Key: "←, →, enter", Description: "Collapse, expand or toggle a folder (names like k8s/logs/tail)"},
+	{Key: "m", Description: "Move command to another folder"},
+	{Key: "f", Description: "Pin/unpin command at the top of the list"},
+	{Key: "1-9", Description: "Run the pinned command with that number"},
+	{Key: "u, ctrl+r", Description: "Undo, Redo last change"},
+	{Key: "P", Description: "Run a playbook"},
+	{Key: "$", Description: "Choose the environment profile for runs"},
+	{Key: "V", Description: "Switch to another named vault"},
+	{Key: "h", Description: "Show edit history, diff and roll back"},
+	{Key: "t", Description: "Open trash (restore / delete forever)"},
+	{Key: "v", Description: "Edit command as a document in $EDITOR"},
+	{Key: "ctrl+s", Description: "Save command (in add/edit form)"},
+	{Key: "ctrl+e", Description: "Open command in $EDITOR (in add/edit form)"},
 	{Key: "c", Description: "Copy current path (in browser)"},
+	{Key: "space, M", Description: "Mark dirs, run a command in all of them (in browser)"},
 	{Key: "p", Description: "Paste saved command (in mini-terminal)"},
 	{Key: "x", Description: "Show/hide contextual help"},
 	{Key: "q", Description: "Quit program"},
@@ -324,6 +593,167 @@ func renderActionsPanel(actions []string, selected int) string {
 	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
 }
 
+func renderCommandPicker(title string, commands []models.Command, selected int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(title) + "\n\n")
+	for i, c := range commands {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		b.WriteString(style.Render(fmt.Sprintf("%s%s", prefix, c.Name)) + "\n")
+	}
+	b.WriteString("\nUse ↑/↓ to navigate, Enter to run, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
+func renderDirResults(name string, results []runner.DirResult, selected int, width int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Results: "+name) + "\n")
+	for i, res := range results {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		status := "ok "
+		if res.Err != nil {
+			status = "ERR"
+			if i != selected {
+				style = style.Foreground(diffDelStyle.GetForeground())
+			}
+		}
+		dir := filepath.Base(res.Dir)
+		suffix := fmt.Sprintf(" %d %s", res.ExitCode, res.Duration.Round(time.Millisecond))
+		dir = truncate(dir, width-lipgloss.Width(prefix)-len(status)-1-len(suffix))
+		b.WriteString(style.Render(fmt.Sprintf("%s%s %s%s", prefix, status, dir, suffix)) + "\n")
+	}
+	return b.String()
+}
+
+// truncate shortens s to at most width terminal cells, ending it with "..."
+// when something was cut. Names too wide for even that are left out.
+func truncate(s string, width int) string {
+	return ansi.Truncate(s, max(width, 0), "...")
+}
+
+func renderDirResultDetails(res runner.DirResult) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Directory") + "\n")
+	b.WriteString(fmt.Sprintf("Path:      %s\n", res.Dir))
+	b.WriteString(fmt.Sprintf("Exit code: %d\n", res.ExitCode))
+	b.WriteString(fmt.Sprintf("Duration:  %s\n", res.Duration.Round(time.Millisecond)))
+	if res.Err != nil {
+		b.WriteString(fmt.Sprintf("Error:     %v\n", res.Err))
+	}
+	return b.String()
+}
+
+func renderJobList(jobs []*runner.Job, selected int, width int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Jobs") + "\n")
+	for i, j := range jobs {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		status := j.Status()
+		if status == runner.JobFailed && i != selected {
+			style = style.Foreground(diffDelStyle.GetForeground())
+		}
+		name := fmt.Sprintf("#%d %s", j.ID, j.Name)
+		suffix := fmt.Sprintf(" %s %s", status, j.Elapsed().Round(time.Second))
+		name = truncate(name, width-lipgloss.Width(prefix)-len(suffix))
+		b.WriteString(style.Render(prefix+name+suffix) + "\n")
+	}
+	return b.String()
+}
+
+func renderJobDetails(j *runner.Job) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Job #%d: %s", j.ID, j.Name)) + "\n")
+	b.WriteString(fmt.Sprintf("Status:    %s\n", j.Status()))
+	b.WriteString(fmt.Sprintf("Directory: %s\n", j.Dir))
+	b.WriteString(fmt.Sprintf("Started:   %s\n", j.Started.Format("15:04:05")))
+	b.WriteString(fmt.Sprintf("Elapsed:   %s\n", j.Elapsed().Round(time.Millisecond)))
+	if err := j.Err(); err != nil {
+		b.WriteString(fmt.Sprintf("Error:     %v\n", err))
+	}
+	return b.String()
+}
+
+func renderPlaybookPicker(playbooks []models.Playbook, selected int) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Run Playbook") + "\n\n")
+	for i, p := range playbooks {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		names := make([]string, len(p.Steps))
+		for j, st := range p.Steps {
+			names[j] = st.CommandName
+		}
+		b.WriteString(style.Render(fmt.Sprintf("%s%s: %s", prefix, p.Name, strings.Join(names, " → "))) + "\n")
+	}
+	b.WriteString("\nUse ↑/↓ to navigate, Enter to run, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
+func renderProfilePicker(profiles []models.EnvProfile, selected int, active *models.EnvProfile) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Environment Profile") + "\n\n")
+	names := []string{"(none)"}
+	for _, p := range profiles {
+		names = append(names, fmt.Sprintf("%s (%d vars)", p.Name, len(p.Vars)))
+	}
+	for i, name := range names {
+		style := lipgloss.NewStyle()
+		prefix := "  "
+		if i == selected {
+			style = style.Foreground(primaryColor).Bold(true)
+			prefix = "→ "
+		}
+		if (i == 0 && active == nil) || (i > 0 && active != nil && profiles[i-1].ID == active.ID) {
+			name += " *"
+		}
+		b.WriteString(style.Render(prefix+name) + "\n")
+	}
+	b.WriteString("\nUse ↑/↓ to navigate, Enter to use, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
+func renderConfirmDangerous(p *pendingRun, input string) string {
+	var b strings.Builder
+	b.WriteString(warningStyle.Render("Dangerous: "+p.name) + "\n\n")
+	for _, r := range p.reasons {
+		b.WriteString("  - " + r + "\n")
+	}
+	b.WriteString("\nType " + titleStyle.Render(p.name) + " to run it:\n")
+	b.WriteString(input + "\n")
+	if p.mismatch {
+		b.WriteString(warningStyle.Render("Name does not match.") + "\n")
+	}
+	b.WriteString("\nEnter to run, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
+func renderUnlockSecrets(name, input string) string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render("Unlock Secrets") + "\n\n")
+	b.WriteString(name + " uses secrets. Passphrase:\n")
+	b.WriteString(input + "\n")
+	b.WriteString("\nEnter to unlock and run, Esc to cancel.")
+	return borderStyle.Render(lipgloss.NewStyle().Padding(1).Render(b.String()))
+}
+
 func renderSelectCmdToPaste(commands []models.Command, selected int) string {
 	var b strings.Builder
 	b.WriteString(titleStyle.Render("Select Command to Paste") + "\n\n")
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/kanekitakitos/cmd-vault/internal/models"
+	"github.com/kanekitakitos/cmd-vault/internal/safety"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"deploy", 10, "deploy"},
+		{"deploy", 6, "deploy"},
+		{"deploy-production", 10, "deploy-..."},
+		{"déploiement-prod", 8, "déplo..."},
+		{"日本語のコマンド", 7, "日本..."},
+		{"deploy", 3, "..."},
+		{"deploy", 0, ""},
+		{"deploy", -5, ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.width); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestRenderListNarrow(t *testing.T) {
+	commands := []models.Command{
+		{ID: 1, Name: "ops/k8s/logs/tail-the-production-cluster-logs", UsageCount: 12},
+		{ID: 2, Name: "ops/デプロイ/本番環境へのデプロイ", UsageCount: 3},
+		{ID: 3, Name: "a-rather-long-name-at-the-top-level", Project: "/src/app/.cmd-vault.json"},
+	}
+	checker, err := safety.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := buildRows(commands, 0, map[string]bool{})
+	for width := 0; width <= 40; width++ {
+		out := renderList(commands, rows, len(rows)-1, 0, map[string]bool{}, checker, width)
+		for _, line := range strings.Split(out, "\n") {
+			if !strings.Contains(line, "tail") && !strings.Contains(line, "本番") {
+				continue
+			}
+			// Command lines keep to the width once it fits the prefix and usage.
+			if w := lipgloss.Width(line); width >= 20 && w > width {
+				t.Errorf("width %d: %q is %d wide", width, line, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultInterval is how often the tree is scanned for changes.
+const DefaultInterval = 500 * time.Millisecond
+
+// Watcher polls a directory tree for changed files.
+type Watcher struct {
+	Root string
+	// Globs select the files to watch by base name or by path relative to
+	// Root; no globs means every file.
+	Globs []string
+	// Interval is the time between scans, DefaultInterval when zero.
+	Interval time.Duration
+	// Debounce is how long the tree has to stay unchanged before a batch of
+	// changes is reported.
+	Debounce time.Duration
+}
+
+// Watch scans the tree until ctx is done and sends the sorted paths of
+// changed, added or removed files, relative to Root, once changes settle.
+func (w *Watcher) Watch(ctx context.Context) (<-chan []string, error) {
+	for _, g := range w.Globs {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return nil, err
+		}
+	}
+	prev, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	out := make(chan []string)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		pending := map[string]bool{}
+		var lastChange time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur, err := w.scan()
+			if err != nil {
+				continue
+			}
+			if changed := diff(prev, cur); len(changed) > 0 {
+				for _, p := range changed {
+					pending[p] = true
+				}
+				lastChange = time.Now()
+			}
+			prev = cur
+			if len(pending) == 0 || time.Since(lastChange) < w.Debounce {
+				continue
+			}
+			files := make([]string, 0, len(pending))
+			for p := range pending {
+				files = append(files, p)
+			}
+			sort.Strings(files)
+			pending = map[string]bool{}
+			select {
+			case out <- files:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// scan records the size and modification time of every watched file.
+// Hidden directories such as .git are skipped.
+func (w *Watcher) scan() (map[string]fileState, error) {
+	files := map[string]fileState{}
+	err := filepath.WalkDir(w.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == w.Root {
+				return err
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(w.Root, path)
+		if d.IsDir() {
+			if rel != "." && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !w.matches(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[rel] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+func (w *Watcher) matches(rel string) bool {
+	if len(w.Globs) == 0 {
+		return true
+	}
+	base := filepath.Base(rel)
+	for _, g := range w.Globs {
+		if ok, _ := filepath.Match(g, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(g, filepath.ToSlash(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// diff lists the files that differ between two scans.
+func diff(prev, cur map[string]fileState) []string {
+	var changed []string
+	for p, st := range cur {
+		if old, ok := prev[p]; !ok || old.size != st.size || !old.modTime.Equal(st.modTime) {
+			changed = append(changed, p)
+		}
+	}
+	for p := range prev {
+		if _, ok := cur[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
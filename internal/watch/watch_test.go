@@ -0,0 +1,126 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		globs []string
+		rel   string
+		want  bool
+	}{
+		{nil, "anything.txt", true},
+		{[]string{"*.go"}, "main.go", true},
+		{[]string{"*.go"}, filepath.Join("cmd", "run.go"), true},
+		{[]string{"*.go"}, "README.md", false},
+		{[]string{"cmd/*.go"}, filepath.Join("cmd", "run.go"), true},
+		{[]string{"cmd/*.go"}, "run.go", false},
+		{[]string{"*.md", "*.go"}, "README.md", true},
+	}
+	for _, tt := range tests {
+		w := &Watcher{Globs: tt.globs}
+		if got := w.matches(tt.rel); got != tt.want {
+			t.Errorf("globs %v: matches(%q) = %v, want %v", tt.globs, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestScanAndDiff(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "a.go"), "package a")
+	write(t, filepath.Join(root, "sub", "b.go"), "package b")
+	write(t, filepath.Join(root, "notes.md"), "notes")
+	write(t, filepath.Join(root, ".git", "HEAD"), "ref")
+	w := &Watcher{Root: root, Globs: []string{"*.go"}}
+
+	before, err := w.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for p := range before {
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	if want := []string{"a.go", filepath.Join("sub", "b.go")}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("scanned %v, want %v", files, want)
+	}
+
+	write(t, filepath.Join(root, "a.go"), "package a // changed")
+	write(t, filepath.Join(root, "c.go"), "package c")
+	if err := os.Remove(filepath.Join(root, "sub", "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(root, "notes.md"), "more notes")
+	after, err := w.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := diff(before, after)
+	sort.Strings(changed)
+	if want := []string{"a.go", "c.go", filepath.Join("sub", "b.go")}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed %v, want %v", changed, want)
+	}
+	if changed := diff(after, after); len(changed) != 0 {
+		t.Errorf("an unchanged tree reports %v", changed)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	root := t.TempDir()
+	w := &Watcher{Root: root, Interval: 10 * time.Millisecond, Debounce: 50 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := w.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes made in quick succession come in one batch.
+	write(t, filepath.Join(root, "b.txt"), "b")
+	write(t, filepath.Join(root, "a.txt"), "a")
+	select {
+	case files := <-changes:
+		if want := []string{"a.txt", "b.txt"}; !reflect.DeepEqual(files, want) {
+			t.Errorf("changes %v, want %v", files, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no changes reported")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Error("changes reported after the context was done")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the channel wasn't closed")
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	if _, err := (&Watcher{Root: t.TempDir(), Globs: []string{"["}}).Watch(context.Background()); err == nil {
+		t.Error("Watch accepted a bad glob")
+	}
+	if _, err := (&Watcher{Root: filepath.Join(t.TempDir(), "missing")}).Watch(context.Background()); err == nil {
+		t.Error("Watch accepted a missing directory")
+	}
+}